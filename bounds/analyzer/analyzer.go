@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dsfalves/gdsim/bounds"
+	"github.com/dsfalves/gdsim/file"
+	"github.com/dsfalves/gdsim/job"
+	"github.com/dsfalves/gdsim/network"
+	"github.com/dsfalves/gdsim/topology"
+)
+
+// job results printed by gdsim, as the job id, its submission and the tasks it ran
+var resultLine = regexp.MustCompile(`^(\S+) (\d+) \[(.*)\]$`)
+
+// tasks in a job result, whose last field is the time the task ended
+var taskTuple = regexp.MustCompile(`\(([^()]*)\)`)
+
+func load(topologyName, filesName, jobsName string) (*topology.Topology, []job.Job, error) {
+	nw := network.NewSimpleNetwork()
+	reader, err := os.Open(topologyName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("problem opening %v: %v", topologyName, err)
+	}
+	defer reader.Close()
+	topo, err := topology.LoadFifo(reader, &nw)
+	if err != nil {
+		return nil, nil, err
+	}
+	filesReader, err := os.Open(filesName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("problem opening %v: %v", filesName, err)
+	}
+	defer filesReader.Close()
+	files, err := file.Load(filesReader, topo, &nw)
+	if err != nil {
+		return nil, nil, err
+	}
+	jobsReader, err := os.Open(jobsName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("problem opening %v: %v", jobsName, err)
+	}
+	defer jobsReader.Close()
+	jobs, err := job.Load(jobsReader, files)
+	return topo, jobs, err
+}
+
+// Tasks a job ran according to the results of a run
+type result struct {
+	end   float64 // time the last of them ended
+	tasks int
+}
+
+/*
+Reads the results printed by gdsim in filename, returning the tasks each job that ran a task ran.
+Other lines, such as the files printed before the results, are skipped.
+*/
+func loadResults(filename string) (map[string]result, error) {
+	reader, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("problem opening %v: %v", filename, err)
+	}
+	defer reader.Close()
+	res := make(map[string]result)
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		match := resultLine.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		for _, task := range taskTuple.FindAllStringSubmatch(match[3], -1) {
+			fields := strings.Split(task[1], ", ")
+			end, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("failure to read results of job %v in %v: %v", match[1], filename, err)
+			}
+			r := res[match[1]]
+			res[match[1]] = result{end: math.Max(r.end, end), tasks: r.tasks + 1}
+		}
+	}
+	return res, scanner.Err()
+}
+
+/*
+Returns the makespan and total completion time of the jobs that ran all their tasks, including those of
+later stages, according to results, and how many jobs did not.
+*/
+func measure(jobs []job.Job, results map[string]result) (makespan, completion float64, unfinished int) {
+	first, last := math.Inf(1), 0.0
+	for _, j := range jobs {
+		first = math.Min(first, float64(j.Submission))
+		tasks := len(j.Tasks)
+		for _, s := range j.Stages {
+			tasks += len(s.Tasks)
+		}
+		r, ok := results[j.Id]
+		if !ok || r.tasks < tasks {
+			unfinished++
+			continue
+		}
+		last = math.Max(last, r.end)
+		completion += r.end - float64(j.Submission)
+	}
+	return math.Max(last-first, 0), completion, unfinished
+}
+
+func main() {
+	topologyName := flag.String("topology", "default.topo", "topology description file")
+	filesName := flag.String("files", "trace.files", "files description file")
+	flag.Parse()
+	if flag.NArg() < 1 {
+		log.Fatal("missing job trace")
+	}
+
+	topo, jobs, err := load(*topologyName, *filesName, flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	b, err := bounds.Compute(*topo, jobs)
+	if err != nil {
+		log.Printf("LP bound left out: %v", err)
+	}
+
+	fmt.Println("# bound makespan total_completion")
+	fmt.Printf("work %.1f -\n", b.Work)
+	fmt.Printf("critical_path %.1f %.1f\n", b.CriticalPath, b.PathCompletion)
+	fmt.Printf("lp %.1f -\n", b.LP)
+	fmt.Printf("srpt - %.1f\n", b.SRPTCompletion)
+	fmt.Printf("best %.1f %.1f\n", b.Makespan(), b.Completion())
+	if flag.NArg() == 1 {
+		return
+	}
+	fmt.Println("# results makespan makespan_ratio total_completion total_completion_ratio unfinished")
+	for _, filename := range flag.Args()[1:] {
+		results, err := loadResults(filename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		makespan, completion, unfinished := measure(jobs, results)
+		fmt.Printf("%s %.1f %.3f %.1f %.3f %d\n", filename, makespan, makespan/b.Makespan(), completion, completion/b.Completion(), unfinished)
+	}
+}
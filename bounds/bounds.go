@@ -0,0 +1,402 @@
+/*
+The package bounds computes lower bounds on the makespan and total completion time of a set of jobs in a
+topology, which no scheduler can beat, to tell how far the schedules found by a simulation are from optimal.
+*/
+package bounds
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/dsfalves/gdsim/file"
+	"github.com/dsfalves/gdsim/job"
+	"github.com/dsfalves/gdsim/topology"
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/optimize/convex/lp"
+)
+
+// maximum number of release times considered for each data center by the linear relaxation
+const maxThresholds = 32
+
+/*
+Bounds are lower bounds, in seconds, on the makespan of a set of jobs, the time between the first submission
+and the last completion, and on their total completion time, the sum over the jobs of the time between
+their submission and completion.
+*/
+type Bounds struct {
+	Work           float64 // makespan if the work of the jobs was spread over every core as soon as submitted
+	CriticalPath   float64 // makespan if every job ran its longest chain of tasks as soon as its inputs could arrive
+	LP             float64 // optimal makespan of the relaxation where jobs are split between data centers
+	PathCompletion float64 // total completion time if every job ran its longest chain of tasks as soon as its inputs could arrive
+	SRPTCompletion float64 // total completion time of SRPT on a single machine as fast as every core together
+}
+
+// Makespan returns the tightest of the bounds on the makespan.
+func (b Bounds) Makespan() float64 {
+	return math.Max(b.Work, math.Max(b.CriticalPath, b.LP))
+}
+
+// Completion returns the tightest of the bounds on the total completion time.
+func (b Bounds) Completion() float64 {
+	return math.Max(b.PathCompletion, b.SRPTCompletion)
+}
+
+// What a job requires from the topology, as far as the bounds are concerned
+type jobInfo struct {
+	release float64
+	work    float64   // core-seconds the tasks of the job take on reference cores
+	chain   float64   // seconds the longest chain of tasks of the job takes on reference cores
+	ready   []float64 // earliest time the job can start in each data center, -1 where it cannot run
+}
+
+/*
+Compute returns the bounds for jobs in t, as loaded and before any simulation. Tasks run for their duration
+on reference cores, and the CPU speed of nodes, shrinking CPUs of malleable jobs, input transfers, and the
+data centers where jobs may run are taken into account; memory, anti-affinity, shuffles, output shipping,
+scheduling windows and capacity changes are not, so the bounds hold whatever they are.
+A file can only reach a data center that does not store it once a job reading it is submitted, and then only
+after the time to send it over the fastest link into that data center.
+Jobs that cannot run in any data center are left out. If the linear relaxation cannot be solved, its bound is 0
+and the error is returned along with the other bounds.
+*/
+func Compute(t topology.Topology, jobs []job.Job) (Bounds, error) {
+	capacity, fastest := capacities(t)
+	infos := describe(t, jobs, capacity)
+	if len(infos) == 0 {
+		return Bounds{}, nil
+	}
+	var total float64
+	for _, c := range capacity {
+		total += c
+	}
+	sort.SliceStable(infos, func(i, k int) bool { return infos[i].release < infos[k].release })
+	var b Bounds
+	b.Work = workBound(infos, total)
+	b.CriticalPath, b.PathCompletion = pathBounds(infos, capacity, fastest)
+	b.SRPTCompletion = srptBound(infos, total)
+	var err error
+	b.LP, err = lpBound(infos, capacity)
+	return b, err
+}
+
+// Returns the capacity of each data center of t, as its cores weighted by their speed, and its fastest node.
+func capacities(t topology.Topology) (capacity, fastest []float64) {
+	capacity = make([]float64, len(t.DataCenters))
+	fastest = make([]float64, len(t.DataCenters))
+	for d, dc := range t.DataCenters {
+		for _, n := range dc.Nodes() {
+			capacity[d] += float64(n.Cores()) * n.Speed()
+			fastest[d] = math.Max(fastest[d], n.Speed())
+		}
+	}
+	return capacity, fastest
+}
+
+// Returns every task of j, runnable or not.
+func tasks(j job.Job) []job.Task {
+	res := append([]job.Task{}, j.Tasks...)
+	for _, s := range j.Stages {
+		res = append(res, s.Tasks...)
+	}
+	return res
+}
+
+// Returns the fewest core-seconds the tasks of j can take on reference cores, over the CPUs they may run with.
+func work(j job.Job) float64 {
+	least := float64(j.Cpus)
+	for cpus := j.MinCpus; cpus > 0 && cpus < j.Cpus; cpus++ {
+		least = math.Min(least, float64(cpus)*j.Stretch(cpus))
+	}
+	var res float64
+	for _, task := range tasks(j) {
+		res += float64(task.Duration) * least
+	}
+	return res
+}
+
+// Returns the seconds the longest chain of tasks of j takes on reference cores, each stage lasting as its longest task.
+func chain(j job.Job) float64 {
+	longest := make(map[string]float64)
+	for _, task := range tasks(j) {
+		longest[task.Stage] = math.Max(longest[task.Stage], float64(task.Duration))
+	}
+	res := longest[""]
+	// parents come before their children, so their chains are known when the children are reached
+	for _, s := range j.Stages {
+		var parents float64
+		for _, p := range s.Parents {
+			parents = math.Max(parents, longest[p])
+		}
+		longest[s.Id] += parents
+		res = math.Max(res, longest[s.Id])
+	}
+	return res
+}
+
+/*
+Returns whether tasks of j may run in dc, according to the data centers allowed and forbidden for j
+and the data centers where its inputs must not be stored.
+*/
+func permitted(j job.Job, dc topology.DataCenter) bool {
+	if !j.Permits(dc.Id()) {
+		return false
+	}
+	fc, ok := dc.Container().(*file.FileContainer)
+	if !ok {
+		return true
+	}
+	for _, f := range j.TaskInputs(job.Task{}) {
+		if !fc.Has(f.Id()) && !fc.Permits(f.Id()) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the least time to send f to the data center of t with index to, 0 if it is stored there.
+func transfer(f file.File, t topology.Topology, to int) float64 {
+	if t.DataCenters[to].Container().Has(f.Id()) {
+		return 0
+	}
+	res := math.Inf(1)
+	for from := range t.DataCenters {
+		if from != to && t.Speeds[from][to] > 0 {
+			res = math.Min(res, float64(f.Size()/t.Speeds[from][to]))
+		}
+	}
+	if math.IsInf(res, 1) {
+		return 0
+	}
+	return res
+}
+
+// Returns what each job requires from t, leaving out those that cannot run in any data center with capacity.
+func describe(t topology.Topology, jobs []job.Job, capacity []float64) []jobInfo {
+	read := make(map[string]float64) // earliest submission of a job reading each file
+	for _, j := range jobs {
+		for _, f := range j.TaskInputs(job.Task{}) {
+			if first, ok := read[f.Id()]; !ok || float64(j.Submission) < first {
+				read[f.Id()] = float64(j.Submission)
+			}
+		}
+	}
+	res := make([]jobInfo, 0, len(jobs))
+	for _, j := range jobs {
+		info := jobInfo{release: float64(j.Submission), work: work(j), chain: chain(j), ready: make([]float64, len(t.DataCenters))}
+		runnable := false
+		for d, dc := range t.DataCenters {
+			info.ready[d] = -1
+			if capacity[d] == 0 || !permitted(j, dc) {
+				continue
+			}
+			info.ready[d] = info.release
+			for _, f := range j.TaskInputs(job.Task{}) {
+				info.ready[d] = math.Max(info.ready[d], read[f.Id()]+transfer(f, t, d))
+			}
+			runnable = true
+		}
+		if runnable {
+			res = append(res, info)
+		}
+	}
+	return res
+}
+
+/*
+Returns the bound on makespan from the work of jobs, sorted by release, over the total capacity of the topology:
+the work of the jobs released at or after any release cannot be done before that release.
+*/
+func workBound(jobs []jobInfo, total float64) float64 {
+	var res, left float64
+	for i := len(jobs) - 1; i >= 0; i-- {
+		left += jobs[i].work
+		if i == 0 || jobs[i-1].release < jobs[i].release {
+			res = math.Max(res, jobs[i].release-jobs[0].release+left/total)
+		}
+	}
+	return res
+}
+
+/*
+Returns the bounds on makespan and total completion time from the longest chain of tasks of each job of jobs,
+sorted by release, run on the fastest node of the data centers where it may run, as soon as it can start in any.
+*/
+func pathBounds(jobs []jobInfo, capacity, fastest []float64) (makespan, completion float64) {
+	for _, j := range jobs {
+		start, speed := math.Inf(1), 0.0
+		for d, ready := range j.ready {
+			if ready >= 0 {
+				start = math.Min(start, ready)
+				speed = math.Max(speed, fastest[d])
+			}
+		}
+		end := start + j.chain/speed
+		makespan = math.Max(makespan, end-jobs[0].release)
+		completion += end - j.release
+	}
+	return makespan, completion
+}
+
+// A job being run by SRPT
+type srptJob struct {
+	left, release float64
+}
+
+type srptHeap []srptJob
+
+func (h srptHeap) Len() int           { return len(h) }
+func (h srptHeap) Less(i, j int) bool { return h[i].left < h[j].left }
+func (h srptHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *srptHeap) Push(x interface{}) {
+	*h = append(*h, x.(srptJob))
+}
+
+func (h *srptHeap) Pop() interface{} {
+	old := *h
+	res := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return res
+}
+
+/*
+Returns the total completion time of jobs, sorted by release, when run by preemptive SRPT on a single
+machine as fast as the total capacity of the topology, which is optimal for that machine.
+*/
+func srptBound(jobs []jobInfo, total float64) float64 {
+	var res, now float64
+	running := &srptHeap{}
+	for i := 0; i < len(jobs) || running.Len() > 0; {
+		if running.Len() == 0 {
+			now = math.Max(now, jobs[i].release)
+		}
+		for ; i < len(jobs) && jobs[i].release <= now; i++ {
+			heap.Push(running, srptJob{left: jobs[i].work / total, release: jobs[i].release})
+		}
+		next := math.Inf(1)
+		if i < len(jobs) {
+			next = jobs[i].release
+		}
+		top := &(*running)[0]
+		if now+top.left <= next {
+			now += top.left
+			res += now - top.release
+			heap.Pop(running)
+			continue
+		}
+		top.left -= next - now
+		now = next
+	}
+	return res
+}
+
+// Returns at most maxThresholds of the distinct values, always including the smallest.
+func thresholds(values []float64) []float64 {
+	sort.Float64s(values)
+	distinct := values[:0]
+	for i, v := range values {
+		if i == 0 || v > distinct[len(distinct)-1] {
+			distinct = append(distinct, v)
+		}
+	}
+	if len(distinct) <= maxThresholds {
+		return distinct
+	}
+	res := make([]float64, maxThresholds)
+	for i := range res {
+		res[i] = distinct[i*(len(distinct)-1)/(maxThresholds-1)]
+	}
+	return res
+}
+
+/*
+Returns the optimal makespan of a linear relaxation where the work of each job of jobs, sorted by release,
+may be split among the data centers where it may run. For each data center and each of up to maxThresholds
+times when jobs become ready to start there, the share of work in the data center of the jobs ready at
+or after that time cannot be done before it. Jobs ready at the same thresholds are merged, which keeps the
+optimum while making the program smaller.
+*/
+func lpBound(jobs []jobInfo, capacity []float64) (float64, error) {
+	limits := make([][]float64, len(capacity))
+	for d := range capacity {
+		values := make([]float64, 0, len(jobs))
+		for _, j := range jobs {
+			if j.ready[d] >= 0 {
+				values = append(values, j.ready[d])
+			}
+		}
+		limits[d] = thresholds(values)
+	}
+	// jobs are merged into classes ready at the same thresholds of each data center, -1 where they cannot run
+	type class struct {
+		work    float64
+		buckets []int
+	}
+	var classes []*class
+	index := make(map[string]*class)
+	for _, j := range jobs {
+		buckets := make([]int, len(capacity))
+		for d, ready := range j.ready {
+			buckets[d] = sort.Search(len(limits[d]), func(i int) bool { return limits[d][i] > ready }) - 1
+		}
+		key := fmt.Sprint(buckets)
+		if index[key] == nil {
+			index[key] = &class{buckets: buckets}
+			classes = append(classes, index[key])
+		}
+		index[key].work += j.work
+	}
+
+	// columns hold the share of each class in each data center it may run in, the makespan, and then the surplus of each row
+	columns := make([][]int, len(classes))
+	n := 0
+	for k, c := range classes {
+		columns[k] = make([]int, len(capacity))
+		for d, bucket := range c.buckets {
+			columns[k][d] = -1
+			if bucket >= 0 {
+				columns[k][d] = n
+				n++
+			}
+		}
+	}
+	makespan := n
+	rows := 0
+	for _, l := range limits {
+		rows += len(l)
+	}
+	a := mat.NewDense(rows+len(classes), n+1+rows, nil)
+	b := make([]float64, rows+len(classes))
+	row := 0
+	for d, l := range limits {
+		for i, limit := range l {
+			a.Set(row, makespan, 1)
+			a.Set(row, n+1+row, -1)
+			for k, c := range classes {
+				if c.buckets[d] >= i {
+					a.Set(row, columns[k][d], -c.work/capacity[d])
+				}
+			}
+			b[row] = limit - jobs[0].release
+			row++
+		}
+	}
+	for k := range classes {
+		for _, column := range columns[k] {
+			if column >= 0 {
+				a.Set(row, column, 1)
+			}
+		}
+		b[row] = 1
+		row++
+	}
+	c := make([]float64, n+1+rows)
+	c[makespan] = 1
+	res, _, err := lp.Simplex(c, a, b, 1e-10, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failure to solve linear relaxation: %v", err)
+	}
+	return res, nil
+}
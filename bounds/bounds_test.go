@@ -0,0 +1,87 @@
+package bounds
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/dsfalves/gdsim/file"
+	"github.com/dsfalves/gdsim/job"
+	"github.com/dsfalves/gdsim/network"
+	"github.com/dsfalves/gdsim/topology"
+)
+
+func TestCompute(t *testing.T) {
+	nw := network.NewSimpleNetwork()
+	topo, err := topology.NewFifo([][2]int{{1, 4}, {1, 4}}, [][]uint64{{0, 100}, {100, 0}}, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	files, err := file.Load(strings.NewReader("f1 1000 0\n"), topo, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	jobs, err := job.Load(strings.NewReader("j0 2 0 f1 10 10\nj1 4 5 f1 20\nj2 2 5 f1 10 forbidden=DC0,DC1\n"), files)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	b, err := Compute(*topo, jobs)
+	if err != nil {
+		t.Fatalf("error '%v' while computing bounds, expected nil", err)
+	}
+	expected := Bounds{Work: 15, CriticalPath: 25, LP: 20, PathCompletion: 30, SRPTCompletion: 15}
+	for _, c := range []struct {
+		name          string
+		found, wanted float64
+	}{
+		{"work", b.Work, expected.Work},
+		{"critical path", b.CriticalPath, expected.CriticalPath},
+		{"LP", b.LP, expected.LP},
+		{"critical path completion", b.PathCompletion, expected.PathCompletion},
+		{"SRPT completion", b.SRPTCompletion, expected.SRPTCompletion},
+	} {
+		if math.Abs(c.found-c.wanted) > 1e-6 {
+			t.Errorf("expected %s bound %v, found %v", c.name, c.wanted, c.found)
+		}
+	}
+	if b.Makespan() != 25 || b.Completion() != 30 {
+		t.Errorf("expected makespan bound 25 and total completion bound 30, found %v and %v", b.Makespan(), b.Completion())
+	}
+
+	if b, err := Compute(*topo, nil); err != nil || b != (Bounds{}) {
+		t.Errorf("expected no bounds without jobs, found %+v and error '%v'", b, err)
+	}
+}
+
+func TestChain(t *testing.T) {
+	j := job.Job{
+		Tasks: []job.Task{{Duration: 4}, {Duration: 5, Stage: "a"}},
+		Stages: []job.Stage{
+			{Id: "a"},
+			{Id: "b", Parents: []string{"a"}, Tasks: []job.Task{{Duration: 7, Stage: "b"}, {Duration: 3, Stage: "b"}}},
+			{Id: "c", Tasks: []job.Task{{Duration: 9, Stage: "c"}}},
+		},
+	}
+	if c := chain(j); c != 12 {
+		t.Errorf("expected longest chain of 12 seconds, found %v", c)
+	}
+	j.Cpus, j.MinCpus, j.Speedup = 4, 1, job.AmdahlSpeedup{Serial: 0.5}
+	// with 1 CPU a task takes (0.5+0.5)/(0.5+0.125) = 1.6 times longer, using 1.6 core-seconds for every 4
+	if w := work(j); math.Abs(w-1.6*28) > 1e-6 {
+		t.Errorf("expected %v core-seconds of work, found %v", 1.6*28, w)
+	}
+}
+
+func TestThresholds(t *testing.T) {
+	if l := thresholds([]float64{5, 0, 5, 3}); len(l) != 3 || l[0] != 0 || l[1] != 3 || l[2] != 5 {
+		t.Errorf("expected thresholds [0 3 5], found %v", l)
+	}
+	values := make([]float64, 100)
+	for i := range values {
+		values[i] = float64(99 - i)
+	}
+	l := thresholds(values)
+	if len(l) != maxThresholds || l[0] != 0 || l[len(l)-1] != 99 {
+		t.Errorf("expected %d thresholds from 0 to 99, found %v", maxThresholds, l)
+	}
+}
@@ -0,0 +1,68 @@
+package file
+
+import "fmt"
+
+// AccessInfo holds the access history of a file stored in a FileContainer
+type AccessInfo struct {
+	// Last is the time of the most recent access
+	Last uint64
+	// Count is the number of accesses since the file was stored
+	Count uint64
+	// Size of the file in bytes
+	Size uint64
+}
+
+// EvictionPolicy is an interface to model how a full FileContainer chooses which replicas to remove
+type EvictionPolicy interface {
+	// Value should return how valuable it is to keep a file after an access, given its access history.
+	// Files with the lowest value are evicted first.
+	Value(info AccessInfo) float64
+
+	// Evicted informs the policy that a file with the given value was evicted
+	Evicted(value float64)
+}
+
+// LRU evicts the least recently used file.
+type LRU struct{}
+
+func (LRU) Value(info AccessInfo) float64 { return float64(info.Last) }
+func (LRU) Evicted(value float64)         {}
+
+// LFU evicts the least frequently used file.
+type LFU struct{}
+
+func (LFU) Value(info AccessInfo) float64 { return float64(info.Count) }
+func (LFU) Evicted(value float64)         {}
+
+/*
+GDSF implements Greedy-Dual-Size-Frequency, which evicts the file with the lowest
+frequency per byte, aged by the value of the files evicted before it.
+*/
+type GDSF struct {
+	inflation float64
+}
+
+func (p *GDSF) Value(info AccessInfo) float64 {
+	size := float64(info.Size)
+	if size == 0 {
+		size = 1
+	}
+	return p.inflation + float64(info.Count)/size
+}
+
+func (p *GDSF) Evicted(value float64) {
+	p.inflation = value
+}
+
+// NewEvictionPolicy returns the eviction policy identified by name: "lru", "lfu" or "gdsf".
+func NewEvictionPolicy(name string) (EvictionPolicy, error) {
+	switch name {
+	case "lru":
+		return LRU{}, nil
+	case "lfu":
+		return LFU{}, nil
+	case "gdsf":
+		return &GDSF{}, nil
+	}
+	return nil, fmt.Errorf("unknown eviction policy %v", name)
+}
@@ -0,0 +1,110 @@
+package file
+
+import (
+	"testing"
+
+	"github.com/dsfalves/gdsim/network"
+)
+
+func newTestContainer(id string, capacity uint64, policy EvictionPolicy, db SimpleFileDatabase) *FileContainer {
+	var fc FileContainer
+	fc.Init(id)
+	fc.SetDatabase(db)
+	nw := network.NewSimpleNetwork()
+	fc.SetNetwork(&nw)
+	fc.SetCapacity(capacity)
+	fc.SetEvictionPolicy(policy)
+	return &fc
+}
+
+func TestEviction(t *testing.T) {
+	db := InitSimpleFileDatabase()
+	origin := newTestContainer("DC0", 0, LRU{}, db)
+	fc := newTestContainer("DC1", 10, LRU{}, db)
+	files := []File{New("f1", 4), New("f2", 4), New("f3", 4), New("only", 2)}
+	for _, f := range files[:3] {
+		origin.Add(f.Id(), f)
+	}
+
+	fc.Add("only", files[3])
+	fc.touch("only", 0)
+	fc.Add("f1", files[0])
+	fc.touch("f1", 1)
+	fc.Add("f2", files[1])
+	fc.touch("f2", 2)
+	fc.touch("f1", 3)
+	if used := fc.Used(); used != 10 {
+		t.Fatalf("expected 10 bytes used, found %d", used)
+	}
+
+	fc.Add("f3", files[2])
+	if fc.Has("f2") {
+		t.Errorf("expected least recently used f2 to be evicted")
+	}
+	if !fc.Has("f1") || !fc.Has("f3") || !fc.Has("only") {
+		t.Errorf("expected f1, f3 and only to be stored, found %v", fc.files)
+	}
+	if locations := db.Location("f2"); len(locations) != 1 || locations[0] != "DC0" {
+		t.Errorf("expected f2 to be only in DC0 after eviction, found %v", locations)
+	}
+	if used := fc.Used(); used != 10 {
+		t.Errorf("expected 10 bytes used, found %d", used)
+	}
+
+	big := New("big", 9)
+	origin.Add("big", big)
+	fc.Add("big", big)
+	if fc.Has("big") {
+		t.Errorf("expected replica larger than evictable space to be rejected")
+	}
+	if !fc.Has("f1") || !fc.Has("f3") {
+		t.Errorf("expected no eviction when replica does not fit, found %v", fc.files)
+	}
+}
+
+func TestAccessEviction(t *testing.T) {
+	db := InitSimpleFileDatabase()
+	origin := newTestContainer("DC0", 0, LRU{}, db)
+	fc := newTestContainer("DC1", 8, LRU{}, db)
+	files := []File{New("f1", 4), New("f2", 4), New("f3", 4)}
+	for _, f := range files {
+		origin.Add(f.Id(), f)
+	}
+	fc.Add("f1", files[0])
+	fc.touch("f1", 1)
+	fc.Add("f2", files[1])
+	fc.touch("f2", 2)
+	// tasks reading the local copy of f1 make it the most recently used
+	fc.Access(3, "f1")
+	fc.Add("f3", files[2])
+	if !fc.Has("f1") || fc.Has("f2") {
+		t.Errorf("expected f2 to be evicted after f1 was accessed, found %v", fc.files)
+	}
+}
+
+func TestEvictionPolicies(t *testing.T) {
+	frequent := AccessInfo{Last: 1, Count: 5, Size: 100}
+	recent := AccessInfo{Last: 9, Count: 1, Size: 1}
+	if !(LRU{}.Value(frequent) < LRU{}.Value(recent)) {
+		t.Errorf("expected LRU to value recent access more")
+	}
+	if !(LFU{}.Value(recent) < LFU{}.Value(frequent)) {
+		t.Errorf("expected LFU to value frequent access more")
+	}
+	gdsf := &GDSF{}
+	if !(gdsf.Value(frequent) < gdsf.Value(recent)) {
+		t.Errorf("expected GDSF to value small files more")
+	}
+	gdsf.Evicted(10)
+	if v := gdsf.Value(frequent); v != 10.05 {
+		t.Errorf("expected GDSF value to be inflated by evicted value, found %v", v)
+	}
+	for _, name := range []string{"lru", "lfu", "gdsf"} {
+		if _, err := NewEvictionPolicy(name); err != nil {
+			t.Errorf("expected NewEvictionPolicy(%v) to succeed, found %v", name, err)
+		}
+	}
+	if _, err := NewEvictionPolicy("fifo"); err == nil {
+		t.Errorf("expected error for unknown eviction policy")
+	}
+}
@@ -4,14 +4,25 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/dsfalves/gdsim/log"
+	"github.com/dsfalves/gdsim/metrics"
 	"github.com/dsfalves/gdsim/network"
 	"github.com/dsfalves/gdsim/scheduler/event"
 	"github.com/dsfalves/gdsim/topology"
 )
 
+var logger log.Context
+var stats metrics.Context
+
+func init() {
+	logger = log.New("file")
+	stats = metrics.New("file")
+}
+
 type File struct {
 	id   string
 	size uint64
@@ -60,15 +71,45 @@ func (db SimpleFileDatabase) Record(fileId, locationId string) {
 	if !ok {
 		locationList = make([]string, 0)
 	}
+	for _, location := range locationList {
+		if location == locationId {
+			return
+		}
+	}
 	db[fileId] = append(locationList, locationId)
 }
 
+// Removes a datacenter location of a file from SimpleFileDatabase
+func (db SimpleFileDatabase) Remove(fileId, locationId string) {
+	locationList := db[fileId]
+	for i, location := range locationList {
+		if location == locationId {
+			db[fileId] = append(locationList[:i], locationList[i+1:]...)
+			return
+		}
+	}
+}
+
+type replica struct {
+	info  AccessInfo
+	value float64
+}
+
 // FileContainer implements the Container interface from the topology module
 type FileContainer struct {
-	id    string
-	files map[string]File
-	db    topology.Database
-	nw    network.Network
+	id        string
+	files     map[string]File
+	db        topology.Database
+	nw        network.Network
+	capacity  uint64 /* storage capacity in bytes, 0 if not limited */
+	used      uint64
+	policy    EvictionPolicy
+	replicas  map[string]*replica
+	now       uint64 /* time of the latest access */
+	accesses  map[string]uint64
+	source    SourceSelection
+	stripes   int /* maximum number of sources of a transfer */
+	residency Residency
 }
 
 // FileContainer setters for data members
@@ -80,71 +121,374 @@ func (fc *FileContainer) SetNetwork(nw network.Network) {
 	fc.nw = nw
 }
 
+func (fc *FileContainer) SetResidency(residency Residency) {
+	fc.residency = residency
+}
+
+// SetCapacity limits the storage of fc to capacity bytes; 0 means no limit.
+func (fc *FileContainer) SetCapacity(capacity uint64) {
+	fc.capacity = capacity
+}
+
+func (fc *FileContainer) SetEvictionPolicy(policy EvictionPolicy) {
+	fc.policy = policy
+}
+
+func (fc *FileContainer) SetSourceSelection(source SourceSelection) {
+	fc.source = source
+}
+
+/*
+SetStripes makes fc copy files from up to stripes sources at once, each sending a part of the file.
+Sources are chosen in the order of preference of the source selection of fc.
+*/
+func (fc *FileContainer) SetStripes(stripes int) {
+	if stripes < 1 {
+		stripes = 1
+	}
+	fc.stripes = stripes
+}
+
 // end of FileContainer setters
 
 // Contructor for FileContainer
 func (fc *FileContainer) Init(id string) {
 	fc.id = id
 	fc.files = make(map[string]File)
+	fc.replicas = make(map[string]*replica)
+	fc.accesses = make(map[string]uint64)
+	fc.policy = LRU{}
+	fc.source = HighestBandwidth{}
+	fc.stripes = 1
+}
+
+// Used returns how many bytes are stored in fc.
+func (fc *FileContainer) Used() uint64 {
+	return fc.used
+}
+
+/*
+Access records that a task running in the data center of fc at time now requires the file with given id,
+whether or not fc has a copy of it. A copy in fc becomes more valuable to keep for the eviction policy.
+*/
+func (fc *FileContainer) Access(now uint64, id string) {
+	fc.accesses[id]++
+	fc.touch(id, now)
 }
 
-func (fc FileContainer) Add(id string, data topology.Data) {
+// Accesses returns how many times each file was accessed in fc.
+func (fc *FileContainer) Accesses() map[string]uint64 {
+	accesses := make(map[string]uint64, len(fc.accesses))
+	for id, count := range fc.accesses {
+		accesses[id] = count
+	}
+	return accesses
+}
+
+/*
+Records an access to the file with given id at time now, updating its value for the eviction policy.
+*/
+func (fc *FileContainer) touch(id string, now uint64) {
+	if now > fc.now {
+		fc.now = now
+	}
+	r, ok := fc.replicas[id]
+	if !ok {
+		return
+	}
+	r.info.Last = fc.now
+	r.info.Count++
+	r.value = fc.policy.Value(r.info)
+}
+
+/*
+Evicts replicas until size more bytes fit in fc, never evicting the last copy of a file
+or the file with id keep.
+Returns false if it is not possible to free enough space.
+*/
+func (fc *FileContainer) makeRoom(size uint64, keep string) bool {
+	if fc.used+size <= fc.capacity {
+		return true
+	}
+	candidates := make([]string, 0, len(fc.replicas))
+	var evictable uint64
+	for id := range fc.replicas {
+		if id != keep && len(fc.db.Location(id)) > 1 {
+			candidates = append(candidates, id)
+			evictable += fc.files[id].Size()
+		}
+	}
+	if fc.used-evictable+size > fc.capacity {
+		return false
+	}
+	sort.Slice(candidates, func(i, k int) bool {
+		vi, vk := fc.replicas[candidates[i]].value, fc.replicas[candidates[k]].value
+		return vi < vk || (vi == vk && candidates[i] < candidates[k])
+	})
+	for _, victim := range candidates {
+		if fc.used+size <= fc.capacity {
+			break
+		}
+		fc.policy.Evicted(fc.replicas[victim].value)
+		stats.Count(fmt.Sprintf("%s.evictions", fc.id))
+		stats.Add(fmt.Sprintf("%s.evicted_bytes", fc.id), float64(fc.files[victim].Size()))
+		logger.Debugf("%s evicting %s", fc.id, victim)
+		fc.Pop(victim)
+	}
+	return true
+}
+
+/*
+Stores data in fc, evicting replicas of other files if fc is full.
+If there is no room for data, it is only stored if it is the only copy of the file.
+*/
+func (fc *FileContainer) Add(id string, data topology.Data) {
 	f := data.(File)
+	if _, ok := fc.files[id]; ok {
+		return
+	}
+	if !fc.Permits(id) {
+		logger.Warnf("%s refused to store %s, which must not be stored there", fc.id, id)
+		stats.Count(fmt.Sprintf("%s.residency_rejections", fc.id))
+		return
+	}
+	if fc.capacity > 0 && !fc.makeRoom(f.Size(), id) {
+		if len(fc.db.Location(f.Id())) > 0 {
+			logger.Debugf("%s has no room for replica of %s", fc.id, id)
+			stats.Count(fmt.Sprintf("%s.rejected_replicas", fc.id))
+			return
+		}
+		logger.Warnf("%s storing only copy of %s beyond its capacity", fc.id, id)
+	}
 	fc.files[id] = f
+	fc.used += f.Size()
+	fc.replicas[id] = &replica{
+		info: AccessInfo{Last: fc.now, Size: f.Size()},
+	}
+	fc.replicas[id].value = fc.policy.Value(fc.replicas[id].info)
 	fc.db.Record(f.Id(), fc.id)
 }
 
-// this should not care what location the scheduler used to estimate,
-// it should find the best one and transfer from there
-func (fc FileContainer) Transfer(when uint64, fileId string, data topology.Data, consequence func(time uint64) []event.Event) []event.Event {
+/*
+Transfer makes data available in fc at time when, copying it from another location if fc does not have it.
+consequence is called once the data is available.
+Returns an error if no location holding the data can transfer it to fc.
+*/
+func (fc *FileContainer) Transfer(when uint64, fileId string, data topology.Data, consequence func(time uint64) []event.Event) ([]event.Event, error) {
 	f := data.(File)
 	if _, ok := fc.files[fileId]; !ok {
-		best := ""
-		var bestStatus network.LinkStatus
-		for _, location := range fc.db.Location(fileId) {
-			status, err := fc.nw.Status(fc.id, location)
-			if err != nil {
-				// TODO: investigate if this is the best approach
-				panic(err)
-			}
-			if best == "" || status.Bandwidth < bestStatus.Bandwidth {
-				best = location
-				bestStatus = status
-			}
+		stats.Add(fmt.Sprintf("%s.hit", fc.id), 0)
+		fc.touch(fileId, when)
+		return fc.fetch(when, f, func(time uint64) []event.Event {
+			fc.touch(fileId, time)
+			return consequence(time)
+		})
+	}
+	stats.Add(fmt.Sprintf("%s.hit", fc.id), 1)
+	fc.touch(fileId, when)
+	return consequence(when), nil
+}
+
+/*
+Copies f to fc from the location chosen by the source selection of fc, starting at time when.
+consequence is called after f is stored in fc.
+If a stripe cannot be started, the stripes already started are returned with the error; they
+still take their links and egress, but f is not stored.
+*/
+func (fc *FileContainer) fetch(when uint64, f File, consequence func(time uint64) []event.Event) ([]event.Event, error) {
+	fileId := f.Id()
+	chosen, chunks, err := fc.plan(f)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]int, 0, len(chosen))
+	for i, chunk := range chunks {
+		if chunk > 0 {
+			parts = append(parts, i)
 		}
-		fc.nw.StartTransfer(when, f.size, best, fc.id, func(time uint64) []event.Event {
-			fc.Add(fileId, data)
+	}
+	if len(parts) == 0 {
+		parts = append(parts, 0)
+	}
+	remaining := len(parts)
+	events := make([]event.Event, 0, remaining)
+	for _, i := range parts {
+		source := chosen[i]
+		transfer, err := fc.nw.StartTransfer(when, chunks[i], source.Location, fc.id, func(time uint64) []event.Event {
+			remaining--
+			if remaining > 0 {
+				return nil
+			}
+			stats.Add(fmt.Sprintf("%s.transfer_time", fc.id), float64(time-when))
+			fc.Add(fileId, f)
 			return consequence(time)
 		})
-	} else {
-		return consequence(when)
+		if err != nil {
+			return events, fmt.Errorf("failure to transfer %s to %s: %v", fileId, fc.id, err)
+		}
+		logger.Debugf("%s copying %d bytes of %s from %s at %d", fc.id, chunks[i], fileId, source.Location, when)
+		stats.Add(fmt.Sprintf("%s.source.%s", fc.id, source.Location), float64(chunks[i]))
+		events = append(events, transfer...)
+	}
+	if len(events) > 1 {
+		stats.Count(fmt.Sprintf("%s.striped_transfers", fc.id))
+	}
+	return events, nil
+}
+
+/*
+Returns the locations fc would copy f from according to its source selection,
+and how many bytes of f would be sent from each of them.
+*/
+func (fc *FileContainer) plan(f File) ([]Source, []uint64, error) {
+	fileId := f.Id()
+	if !fc.Permits(fileId) {
+		return nil, nil, fmt.Errorf("failure to transfer %s to %s: the file must not be stored there", fileId, fc.id)
+	}
+	sources := make([]Source, 0)
+	for _, location := range fc.db.Location(fileId) {
+		status, err := fc.nw.Status(location, fc.id)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failure to transfer %s to %s: %v", fileId, fc.id, err)
+		}
+		sources = append(sources, Source{Location: location, Status: status})
+	}
+	if len(sources) == 0 {
+		return nil, nil, fmt.Errorf("failure to transfer %s to %s: no copy of the file available", fileId, fc.id)
+	}
+	chosen := make([]Source, 0, fc.stripes)
+	for len(chosen) < fc.stripes && len(sources) > 0 {
+		i := fc.source.Select(f.Size(), sources)
+		chosen = append(chosen, sources[i])
+		sources = append(sources[:i:i], sources[i+1:]...)
+	}
+	return chosen, split(f.Size(), chosen), nil
+}
+
+/*
+TransferCost returns the egress cost of copying f to fc from the locations its source selection
+would choose, or 0 if fc already has f or f cannot be copied to fc.
+*/
+func (fc *FileContainer) TransferCost(f File) float64 {
+	if fc.Has(f.Id()) {
+		return 0
+	}
+	chosen, chunks, err := fc.plan(f)
+	if err != nil {
+		return 0
+	}
+	var cost float64
+	for i, source := range chosen {
+		cost += float64(chunks[i]) * source.Status.Cost
+	}
+	return cost
+}
+
+// ShipCost returns the egress cost of shipping f from fc to the location with id to.
+func (fc *FileContainer) ShipCost(f File, to string) float64 {
+	status, err := fc.nw.Status(fc.id, to)
+	if err != nil {
+		return 0
+	}
+	return float64(f.Size()) * status.Cost
+}
+
+// Link returns the status of the link from fc to the location with id to.
+func (fc *FileContainer) Link(to string) (network.LinkStatus, error) {
+	if fc.nw == nil {
+		return network.LinkStatus{}, fmt.Errorf("no network for %s", fc.id)
+	}
+	return fc.nw.Status(fc.id, to)
+}
+
+/*
+Splits size bytes among sources in proportion to their bandwidth, so that all parts take about
+the same time to transfer. The first source receives the bytes left over by rounding.
+*/
+func split(size uint64, sources []Source) []uint64 {
+	chunks := make([]uint64, len(sources))
+	var total uint64
+	for _, s := range sources {
+		total += s.Status.Bandwidth
+	}
+	var assigned uint64
+	for i, s := range sources {
+		if total == 0 {
+			chunks[i] = size / uint64(len(sources))
+		} else {
+			chunks[i] = uint64(float64(size) * float64(s.Status.Bandwidth) / float64(total))
+		}
+		assigned += chunks[i]
+	}
+	chunks[0] += size - assigned
+	return chunks
+}
+
+/*
+Ship sends f from fc to the location with id to, starting at time when, without storing it there.
+consequence is called when f arrives.
+*/
+func (fc *FileContainer) Ship(when uint64, f File, to string, consequence func(time uint64) []event.Event) ([]event.Event, error) {
+	events, err := fc.nw.StartTransfer(when, f.Size(), fc.id, to, consequence)
+	if err != nil {
+		return nil, fmt.Errorf("failure to ship %s from %s to %s: %v", f.Id(), fc.id, to, err)
 	}
-	return nil
+	stats.Add(fmt.Sprintf("%s.shipped", fc.id), float64(f.Size()))
+	return events, nil
 }
 
-func (fc FileContainer) Has(id string) bool {
+// Permits returns whether the file with given id may be stored in fc.
+func (fc *FileContainer) Permits(id string) bool {
+	return fc.residency.Allows(id, fc.id)
+}
+
+func (fc *FileContainer) Has(id string) bool {
 	_, ok := fc.files[id]
 	return ok
 }
 
-func (fc FileContainer) Find(id string) topology.Data {
+func (fc *FileContainer) Find(id string) topology.Data {
 	return fc.files[id]
 }
 
-func (fc FileContainer) Pop(id string) topology.Data {
+func (fc *FileContainer) Pop(id string) topology.Data {
 	f := fc.Find(id)
-	delete(fc.files, id)
+	if _, ok := fc.files[id]; ok {
+		fc.used -= fc.files[id].Size()
+		delete(fc.files, id)
+		delete(fc.replicas, id)
+		if fc.db != nil {
+			fc.db.Remove(id, fc.id)
+		}
+	}
 	return f
 }
 
+// Parses the index of one of size data centers.
+func parseLocation(word string, size int) (int, error) {
+	k, err := strconv.ParseInt(word, 0, 0)
+	if err != nil {
+		return 0, err
+	}
+	if k < 0 || int(k) >= size {
+		return 0, fmt.Errorf("data center %d does not exist", k)
+	}
+	return int(k), nil
+}
+
 func Load(reader io.Reader, topo *topology.Topology, nw network.Network) (map[string]File, error) {
 	res := make(map[string]File)
 	containers := make([]FileContainer, len(topo.DataCenters))
 	database := InitSimpleFileDatabase()
+	residency := make(Residency)
 	for i := 0; i < len(containers); i++ {
 		containers[i].Init(topo.DataCenters[i].Id())
 		containers[i].SetDatabase(database)
+		containers[i].SetResidency(residency)
 		containers[i].SetNetwork(nw)
+		if i < len(topo.Storage) {
+			containers[i].SetCapacity(topo.Storage[i])
+		}
 		topo.DataCenters[i].AddContainer(&containers[i])
 	}
 
@@ -157,14 +501,29 @@ func Load(reader io.Reader, topo *topology.Topology, nw network.Network) (map[st
 			return nil, fmt.Errorf("failure to read file data %d: %v", len(res)+1, err)
 		}
 		f := New(words[0], s)
+		locations := make([]int, 0, len(words)-2)
 		for i := 2; i < len(words); i++ {
-			k, err := strconv.ParseInt(words[i], 0, 0)
+			if list, found := strings.CutPrefix(words[i], "forbidden="); found {
+				for _, index := range strings.Split(list, ",") {
+					k, err := parseLocation(index, len(containers))
+					if err != nil {
+						return nil, fmt.Errorf("failure to read file data %d: %v", len(res)+1, err)
+					}
+					residency[f.Id()] = append(residency[f.Id()], containers[k].id)
+				}
+				continue
+			}
+			k, err := parseLocation(words[i], len(containers))
 			if err != nil {
 				return nil, fmt.Errorf("failure to read file data %d: %v", len(res)+1, err)
 			}
-			//f.Locations[i-2] = int(k)
+			locations = append(locations, k)
+		}
+		for _, k := range locations {
+			if !containers[k].Permits(f.Id()) {
+				return nil, fmt.Errorf("failure to read file data %d: %s stored in %s, where it is forbidden", len(res)+1, f.Id(), containers[k].id)
+			}
 			containers[k].Add(f.Id(), f)
-			topo.DataCenters[int(k)].Container().Add(f.Id(), f)
 		}
 		res[words[0]] = f
 	}
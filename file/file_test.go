@@ -4,6 +4,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/dsfalves/gdsim/network"
 	"github.com/dsfalves/gdsim/topology"
 	"github.com/google/go-cmp/cmp"
 )
@@ -17,7 +18,8 @@ func TestLoad(t *testing.T) {
 		{0, 1},
 		{1, 0},
 	}
-	topo, err := topology.New(cap, speed)
+	nw := network.NewSimpleNetwork()
+	topo, err := topology.NewFifo(cap, speed, &nw)
 	if err != nil {
 		t.Fatalf("setup error: %v", err)
 	}
@@ -35,7 +37,7 @@ func TestLoad(t *testing.T) {
 	}
 	reader := strings.NewReader(sample)
 
-	files, err := Load(reader, topo)
+	files, err := Load(reader, topo, &nw)
 	if err != nil {
 		t.Errorf("expected no error for sample '%v', found '%v'", sample, err)
 	}
@@ -50,7 +52,8 @@ func TestLoad(t *testing.T) {
 func TestFileContainer(t *testing.T) {
 
 	var fc FileContainer
-	fc.Init()
+	fc.Init("DC0")
+	fc.SetDatabase(InitSimpleFileDatabase())
 	if l := len(fc.files); l != 0 {
 		t.Fatalf("expected empty FileContainer, found len(fc.files) == %d", l)
 	}
@@ -0,0 +1,312 @@
+package file
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dsfalves/gdsim/scheduler/event"
+	"github.com/dsfalves/gdsim/topology"
+)
+
+// Replication is a copy of File to be made in the data center with index To
+type Replication struct {
+	File File
+	To   int
+}
+
+// ReplicationState describes the data centers observed by a ReplicationPolicy
+type ReplicationState struct {
+	// Containers of each data center, by index
+	Containers []*FileContainer
+	// Accesses of each file in each data center since the previous replication round
+	Accesses []map[string]uint64
+	// Files available in the simulation, by id
+	Files map[string]File
+	// Speeds is the bandwidth matrix among data centers, in b/s
+	Speeds [][]uint64
+}
+
+/*
+CopyTime returns the time to copy f to the data center with index to from the nearest data center
+holding it, or +Inf if no data center holds it.
+*/
+func (state ReplicationState) CopyTime(f File, to int) float64 {
+	best := math.Inf(1)
+	for from, fc := range state.Containers {
+		if !fc.Has(f.Id()) {
+			continue
+		}
+		var time float64
+		if from != to {
+			time = float64(f.Size()) / float64(state.Speeds[from][to])
+		}
+		if time < best {
+			best = time
+		}
+	}
+	return best
+}
+
+// ReplicationPolicy is an interface to model which files should be copied to which data centers
+type ReplicationPolicy interface {
+	// Plan returns the copies that should be made, the most important first.
+	Plan(state ReplicationState) []Replication
+}
+
+type candidate struct {
+	replication Replication
+	priority    float64
+}
+
+// Returns the replications of candidates sorted by decreasing priority, then by file id and data center.
+func sortCandidates(candidates []candidate) []Replication {
+	sort.Slice(candidates, func(i, k int) bool {
+		ci, ck := candidates[i], candidates[k]
+		if ci.priority != ck.priority {
+			return ci.priority > ck.priority
+		}
+		if ci.replication.File.Id() != ck.replication.File.Id() {
+			return ci.replication.File.Id() < ck.replication.File.Id()
+		}
+		return ci.replication.To < ck.replication.To
+	})
+	res := make([]Replication, len(candidates))
+	for i, c := range candidates {
+		res[i] = c.replication
+	}
+	return res
+}
+
+// PopularityThreshold copies a file to every data center that accessed it at least Accesses times in a round.
+type PopularityThreshold struct {
+	Accesses uint64
+}
+
+func (p PopularityThreshold) Plan(state ReplicationState) []Replication {
+	candidates := make([]candidate, 0)
+	for i, accesses := range state.Accesses {
+		for id, count := range accesses {
+			f, ok := state.Files[id]
+			if !ok || count < p.Accesses || state.Containers[i].Has(id) {
+				continue
+			}
+			candidates = append(candidates, candidate{Replication{f, i}, float64(count)})
+		}
+	}
+	return sortCandidates(candidates)
+}
+
+/*
+KReplicas keeps at least K copies of every file accessed in a round, adding copies to the
+data centers that accessed the file the most.
+*/
+type KReplicas struct {
+	K int
+}
+
+func (p KReplicas) Plan(state ReplicationState) []Replication {
+	total := make(map[string]uint64)
+	for _, accesses := range state.Accesses {
+		for id, count := range accesses {
+			total[id] += count
+		}
+	}
+	candidates := make([]candidate, 0)
+	for id, count := range total {
+		f, ok := state.Files[id]
+		if !ok {
+			continue
+		}
+		destinations := make([]int, 0, len(state.Containers))
+		copies := 0
+		for i, fc := range state.Containers {
+			if fc.Has(id) {
+				copies++
+			} else {
+				destinations = append(destinations, i)
+			}
+		}
+		sort.SliceStable(destinations, func(i, k int) bool {
+			return state.Accesses[destinations[i]][id] > state.Accesses[destinations[k]][id]
+		})
+		for _, to := range destinations {
+			if copies >= p.K {
+				break
+			}
+			candidates = append(candidates, candidate{Replication{f, to}, float64(count)})
+			copies++
+		}
+	}
+	return sortCandidates(candidates)
+}
+
+/*
+CostAware copies a file to a data center when the transfer time its accesses would save
+exceeds the time of making the copy, preferring the copies that save the most time per byte stored.
+*/
+type CostAware struct{}
+
+func (CostAware) Plan(state ReplicationState) []Replication {
+	candidates := make([]candidate, 0)
+	for i, accesses := range state.Accesses {
+		for id, count := range accesses {
+			f, ok := state.Files[id]
+			if !ok || count < 2 || state.Containers[i].Has(id) {
+				continue
+			}
+			time := state.CopyTime(f, i)
+			if math.IsInf(time, 1) || time == 0 {
+				continue
+			}
+			saved := float64(count-1) * time
+			size := float64(f.Size())
+			if size == 0 {
+				size = 1
+			}
+			candidates = append(candidates, candidate{Replication{f, i}, saved / size})
+		}
+	}
+	return sortCandidates(candidates)
+}
+
+/*
+NewReplicationPolicy returns the replication policy described by spec:
+"threshold:<accesses>", "kreplicas:<k>" or "cost". It returns nil for "none".
+*/
+func NewReplicationPolicy(spec string) (ReplicationPolicy, error) {
+	name, value, _ := strings.Cut(spec, ":")
+	switch name {
+	case "none":
+		return nil, nil
+	case "cost":
+		return CostAware{}, nil
+	case "threshold":
+		accesses, err := strconv.ParseUint(value, 0, 64)
+		if err != nil || accesses == 0 {
+			return nil, fmt.Errorf("invalid access threshold %q: expected a positive integer", value)
+		}
+		return PopularityThreshold{Accesses: accesses}, nil
+	case "kreplicas":
+		k, err := strconv.Atoi(value)
+		if err != nil || k <= 0 {
+			return nil, fmt.Errorf("invalid number of replicas %q: expected a positive integer", value)
+		}
+		return KReplicas{K: k}, nil
+	}
+	return nil, fmt.Errorf("unknown replication policy %v", spec)
+}
+
+// ReplicationBudget limits the copies made by a ReplicationManager over the whole simulation
+type ReplicationBudget struct {
+	Bytes  uint64 /* 0 if not limited */
+	Copies int    /* 0 if not limited */
+}
+
+/*
+ReplicationManager copies files among data centers according to a ReplicationPolicy,
+based on how often each data center accessed them.
+*/
+type ReplicationManager struct {
+	policy     ReplicationPolicy
+	budget     ReplicationBudget
+	bytes      uint64
+	copies     int
+	containers []*FileContainer
+	files      map[string]File
+	speeds     [][]uint64
+	seen       []map[string]uint64
+	pending    map[Replication]bool
+}
+
+/*
+NewReplicationManager creates a ReplicationManager for the file containers of topo.
+Fails if a data center in topo has no FileContainer.
+*/
+func NewReplicationManager(topo *topology.Topology, files map[string]File, policy ReplicationPolicy, budget ReplicationBudget) (*ReplicationManager, error) {
+	manager := &ReplicationManager{
+		policy:     policy,
+		budget:     budget,
+		containers: make([]*FileContainer, len(topo.DataCenters)),
+		files:      files,
+		speeds:     topo.Speeds,
+		seen:       make([]map[string]uint64, len(topo.DataCenters)),
+		pending:    make(map[Replication]bool),
+	}
+	for i, dc := range topo.DataCenters {
+		fc, ok := dc.Container().(*FileContainer)
+		if !ok {
+			return nil, fmt.Errorf("data center %v has no FileContainer", dc.Id())
+		}
+		manager.containers[i] = fc
+		manager.seen[i] = make(map[string]uint64)
+	}
+	return manager, nil
+}
+
+// Returns the accesses in each data center since the previous call.
+func (manager *ReplicationManager) accesses() []map[string]uint64 {
+	res := make([]map[string]uint64, len(manager.containers))
+	for i, fc := range manager.containers {
+		res[i] = make(map[string]uint64)
+		for id, count := range fc.Accesses() {
+			if delta := count - manager.seen[i][id]; delta > 0 {
+				res[i][id] = delta
+			}
+			manager.seen[i][id] = count
+		}
+	}
+	return res
+}
+
+// Returns true if copying f would exceed the budget of manager.
+func (manager *ReplicationManager) exceeds(f File) bool {
+	if manager.budget.Copies > 0 && manager.copies+1 > manager.budget.Copies {
+		return true
+	}
+	return manager.budget.Bytes > 0 && manager.bytes+f.Size() > manager.budget.Bytes
+}
+
+/*
+Replicate runs a replication round at time now, starting the copies planned by the policy
+of manager while they fit in its budget. Returns the events of the transfers started.
+*/
+func (manager *ReplicationManager) Replicate(now uint64) []event.Event {
+	state := ReplicationState{
+		Containers: manager.containers,
+		Accesses:   manager.accesses(),
+		Files:      manager.files,
+		Speeds:     manager.speeds,
+	}
+	events := make([]event.Event, 0)
+	for _, r := range manager.policy.Plan(state) {
+		fc := manager.containers[r.To]
+		if manager.pending[r] || fc.Has(r.File.Id()) || !fc.Permits(r.File.Id()) || len(fc.db.Location(r.File.Id())) == 0 {
+			continue
+		}
+		if manager.exceeds(r.File) {
+			stats.Count("replication.over_budget")
+			continue
+		}
+		r := r
+		transfer, err := fc.fetch(now, r.File, func(time uint64) []event.Event {
+			delete(manager.pending, r)
+			stats.Add("replication.copies", float64(r.File.Size()))
+			return nil
+		})
+		if err != nil {
+			logger.Warnf("replication of %s to %s failed: %v", r.File.Id(), fc.id, err)
+			// stripes already started still take their links
+			events = append(events, transfer...)
+			continue
+		}
+		manager.copies++
+		manager.bytes += r.File.Size()
+		manager.pending[r] = true
+		logger.Debugf("replicating %s to %s at %d", r.File.Id(), fc.id, now)
+		events = append(events, transfer...)
+	}
+	return events
+}
@@ -0,0 +1,141 @@
+package file
+
+import (
+	"container/heap"
+	"strings"
+	"testing"
+
+	"github.com/dsfalves/gdsim/network"
+	"github.com/dsfalves/gdsim/scheduler/event"
+	"github.com/dsfalves/gdsim/topology"
+	"github.com/google/go-cmp/cmp"
+)
+
+func replicationTopology(t *testing.T) (*topology.Topology, map[string]File) {
+	cap := [][2]int{{1, 1}, {1, 1}, {1, 1}}
+	speeds := [][]uint64{
+		{0, 10, 1},
+		{10, 0, 1},
+		{1, 1, 0},
+	}
+	nw := network.NewSimpleNetwork()
+	topo, err := topology.NewFifo(cap, speeds, &nw)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	files, err := Load(strings.NewReader("f1 100 0\nf2 10 0\nf3 1000 1"), topo, &nw)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	return topo, files
+}
+
+func access(topo *topology.Topology, dc int, id string, times int) {
+	for i := 0; i < times; i++ {
+		topo.DataCenters[dc].Container().(*FileContainer).Access(0, id)
+	}
+}
+
+func replicationState(manager *ReplicationManager) ReplicationState {
+	return ReplicationState{
+		Containers: manager.containers,
+		Accesses:   manager.accesses(),
+		Files:      manager.files,
+		Speeds:     manager.speeds,
+	}
+}
+
+func TestReplicationPolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   ReplicationPolicy
+		expected []string
+	}{
+		{"threshold", PopularityThreshold{Accesses: 3}, []string{"f1->2", "f2->1"}},
+		{"kreplicas", KReplicas{K: 2}, []string{"f1->2", "f2->1", "f3->0"}},
+		{"cost", CostAware{}, []string{"f1->2", "f2->1", "f3->0"}},
+	}
+	for _, test := range tests {
+		topo, files := replicationTopology(t)
+		access(topo, 1, "f2", 3)
+		access(topo, 2, "f1", 4)
+		access(topo, 0, "f3", 2)
+		manager, err := NewReplicationManager(topo, files, test.policy, ReplicationBudget{})
+		if err != nil {
+			t.Fatalf("setup error: %v", err)
+		}
+		plan := test.policy.Plan(replicationState(manager))
+		found := make([]string, len(plan))
+		for i, r := range plan {
+			found[i] = r.File.Id() + "->" + string(rune('0'+r.To))
+		}
+		if !cmp.Equal(found, test.expected) {
+			t.Errorf("expected %s plan %v, found %v", test.name, test.expected, found)
+		}
+	}
+}
+
+func TestReplicationManager(t *testing.T) {
+	topo, files := replicationTopology(t)
+	access(topo, 1, "f2", 3)
+	access(topo, 2, "f1", 4)
+	manager, err := NewReplicationManager(topo, files, PopularityThreshold{Accesses: 3}, ReplicationBudget{Copies: 1})
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	events := manager.Replicate(0)
+	if len(events) != 1 {
+		t.Fatalf("expected budget to allow 1 copy, found %d transfers", len(events))
+	}
+	h := event.NewEventHeap()
+	for _, e := range events {
+		heap.Push(&h, e)
+	}
+	for h.Len() > 0 {
+		for _, e := range heap.Pop(&h).(event.Event).Process() {
+			heap.Push(&h, e)
+		}
+	}
+	if !topo.DataCenters[2].Container().Has("f1") {
+		t.Errorf("expected f1 to be copied to DC2")
+	}
+	if topo.DataCenters[1].Container().Has("f2") {
+		t.Errorf("expected f2 not to be copied to DC1 beyond the budget")
+	}
+	locations := manager.containers[0].db.Location("f1")
+	if !cmp.Equal(locations, []string{topo.DataCenters[0].Id(), topo.DataCenters[2].Id()}) {
+		t.Errorf("expected f1 to be recorded in DC0 and DC2, found %v", locations)
+	}
+
+	access(topo, 2, "f2", 5)
+	if events := manager.Replicate(10); len(events) != 0 {
+		t.Errorf("expected no copies after the budget was used, found %d", len(events))
+	}
+}
+
+func TestNewReplicationPolicy(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected ReplicationPolicy
+	}{
+		{"none", nil},
+		{"cost", CostAware{}},
+		{"threshold:5", PopularityThreshold{Accesses: 5}},
+		{"kreplicas:3", KReplicas{K: 3}},
+	}
+	for _, test := range tests {
+		policy, err := NewReplicationPolicy(test.spec)
+		if err != nil {
+			t.Errorf("error '%v' while parsing %q, expected nil", err, test.spec)
+		}
+		if policy != test.expected {
+			t.Errorf("expected NewReplicationPolicy(%q) == %v, found %v", test.spec, test.expected, policy)
+		}
+	}
+	for _, spec := range []string{"threshold", "threshold:0", "kreplicas:-1", "popular"} {
+		if _, err := NewReplicationPolicy(spec); err == nil {
+			t.Errorf("expected error for replication policy %q", spec)
+		}
+	}
+}
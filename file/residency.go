@@ -0,0 +1,14 @@
+package file
+
+// Residency records, for each file id, the ids of the locations where the file must never be stored.
+type Residency map[string][]string
+
+// Allows returns whether the file with given id may be stored at the location with id locationId.
+func (r Residency) Allows(fileId, locationId string) bool {
+	for _, forbidden := range r[fileId] {
+		if forbidden == locationId {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,45 @@
+package file
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dsfalves/gdsim/network"
+	"github.com/dsfalves/gdsim/scheduler/event"
+	"github.com/dsfalves/gdsim/topology"
+)
+
+func TestResidency(t *testing.T) {
+	nw := network.NewSimpleNetwork()
+	topo, err := topology.NewFifo([][2]int{{1, 1}, {1, 1}, {1, 1}}, [][]uint64{{0, 1, 1}, {1, 0, 1}, {1, 1, 0}}, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	files, err := Load(strings.NewReader("f1 10 0 forbidden=1,2\nf2 10 0"), topo, &nw)
+	if err != nil {
+		t.Fatalf("error '%v' while loading files, expected nil", err)
+	}
+	dc1 := topo.DataCenters[1].Container().(*FileContainer)
+	if dc1.Permits("f1") || !dc1.Permits("f2") {
+		t.Errorf("expected DC1 to permit only f2")
+	}
+	noop := func(time uint64) []event.Event { return nil }
+	if _, err := dc1.Transfer(0, "f1", files["f1"], noop); err == nil {
+		t.Errorf("expected error transferring f1 to DC1")
+	}
+	dc1.Add("f1", files["f1"])
+	if dc1.Has("f1") {
+		t.Errorf("expected DC1 to refuse storing f1")
+	}
+	if _, err := dc1.Transfer(0, "f2", files["f2"], noop); err != nil {
+		t.Errorf("expected no error transferring f2 to DC1, found %v", err)
+	}
+
+	for _, bad := range []string{"f1 10 1 forbidden=1", "f1 10 0 forbidden=7", "f1 10 3"} {
+		nw := network.NewSimpleNetwork()
+		topo, _ := topology.NewFifo([][2]int{{1, 1}, {1, 1}}, [][]uint64{{0, 1}, {1, 0}}, &nw)
+		if _, err := Load(strings.NewReader(bad), topo, &nw); err == nil {
+			t.Errorf("expected error while loading %q", bad)
+		}
+	}
+}
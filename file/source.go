@@ -0,0 +1,85 @@
+package file
+
+import (
+	"fmt"
+
+	"github.com/dsfalves/gdsim/network"
+)
+
+// Source is a location holding a copy of a file, with the status of its link to the destination
+type Source struct {
+	Location string
+	Status   network.LinkStatus
+}
+
+// SourceSelection is an interface to model where a FileContainer copies a file from
+type SourceSelection interface {
+	// Select should return the index of the source in sources to copy a file of size bytes from.
+	// sources is never empty.
+	Select(size uint64, sources []Source) int
+}
+
+// Returns the index of the source with the lowest score, or the first of them in case of a tie.
+func lowest(sources []Source, score func(Source) float64) int {
+	best := 0
+	for i := 1; i < len(sources); i++ {
+		if score(sources[i]) < score(sources[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+// HighestBandwidth selects the source with the most available bandwidth.
+type HighestBandwidth struct{}
+
+func (HighestBandwidth) Select(size uint64, sources []Source) int {
+	return lowest(sources, func(s Source) float64 { return -float64(s.Status.Bandwidth) })
+}
+
+// EarliestCompletion selects the source from which the transfer is expected to end first.
+type EarliestCompletion struct{}
+
+func (EarliestCompletion) Select(size uint64, sources []Source) int {
+	return lowest(sources, func(s Source) float64 { return CompletionTime(size, s.Status) })
+}
+
+// LowestCost selects the source with the lowest egress cost.
+type LowestCost struct{}
+
+func (LowestCost) Select(size uint64, sources []Source) int {
+	return lowest(sources, func(s Source) float64 { return s.Status.Cost })
+}
+
+// NearestLatency selects the source with the lowest latency.
+type NearestLatency struct{}
+
+func (NearestLatency) Select(size uint64, sources []Source) int {
+	return lowest(sources, func(s Source) float64 { return float64(s.Status.Latency) })
+}
+
+/*
+CompletionTime returns the expected time to transfer size bytes through a link with given status.
+Links without bandwidth never complete a transfer.
+*/
+func CompletionTime(size uint64, status network.LinkStatus) float64 {
+	if size == 0 {
+		return float64(status.Latency)
+	}
+	return float64(status.Latency) + float64(size)/float64(status.Bandwidth)
+}
+
+// NewSourceSelection returns the source selection identified by name: "bandwidth", "completion", "cost" or "latency".
+func NewSourceSelection(name string) (SourceSelection, error) {
+	switch name {
+	case "bandwidth":
+		return HighestBandwidth{}, nil
+	case "completion":
+		return EarliestCompletion{}, nil
+	case "cost":
+		return LowestCost{}, nil
+	case "latency":
+		return NearestLatency{}, nil
+	}
+	return nil, fmt.Errorf("unknown source selection %v", name)
+}
@@ -0,0 +1,213 @@
+package file
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dsfalves/gdsim/network"
+	"github.com/dsfalves/gdsim/scheduler/event"
+)
+
+func TestSourceSelection(t *testing.T) {
+	sources := []Source{
+		{"slow", network.LinkStatus{Bandwidth: 10, Latency: 1, Cost: 0.1}},
+		{"fast", network.LinkStatus{Bandwidth: 100, Latency: 50, Cost: 0.3}},
+		{"near", network.LinkStatus{Bandwidth: 50, Latency: 0, Cost: 0.2}},
+	}
+	tests := []struct {
+		name      string
+		selection SourceSelection
+		size      uint64
+		expected  string
+	}{
+		{"bandwidth", HighestBandwidth{}, 1000, "fast"},
+		{"completion", EarliestCompletion{}, 1000, "near"},
+		{"completion", EarliestCompletion{}, 100000, "fast"},
+		{"cost", LowestCost{}, 1000, "slow"},
+		{"latency", NearestLatency{}, 1000, "near"},
+	}
+	for _, test := range tests {
+		if s := sources[test.selection.Select(test.size, sources)].Location; s != test.expected {
+			t.Errorf("expected %s selection of %d bytes to select %s, found %s", test.name, test.size, test.expected, s)
+		}
+		if _, err := NewSourceSelection(test.name); err != nil {
+			t.Errorf("expected NewSourceSelection(%v) to succeed, found %v", test.name, err)
+		}
+	}
+	if _, err := NewSourceSelection("random"); err == nil {
+		t.Errorf("expected error for unknown source selection")
+	}
+}
+
+func TestTransferSource(t *testing.T) {
+	db := InitSimpleFileDatabase()
+	nw := network.NewSimpleNetwork()
+	nw.AddConnection("DC0", "DC2", 10, 0)
+	nw.AddConnection("DC1", "DC2", 100, 0)
+	containers := make([]*FileContainer, 3)
+	for i, id := range []string{"DC0", "DC1", "DC2"} {
+		var fc FileContainer
+		fc.Init(id)
+		fc.SetDatabase(db)
+		fc.SetNetwork(&nw)
+		containers[i] = &fc
+	}
+	f := New("f", 1000)
+	containers[0].Add("f", f)
+	containers[1].Add("f", f)
+
+	events, err := containers[2].Transfer(0, "f", f, func(time uint64) []event.Event { return nil })
+	if err != nil {
+		t.Fatalf("error '%v' while transferring, expected nil", err)
+	}
+	if len(events) != 1 || events[0].Time() != 10 {
+		t.Errorf("expected transfer from DC1 ending at 10, found %v", events)
+	}
+
+	g := New("g", 1)
+	if _, err := containers[2].Transfer(0, "g", g, func(time uint64) []event.Event { return nil }); err == nil {
+		t.Errorf("expected error transferring file with no copies")
+	}
+	containers[2].Add("g", g)
+	if _, err := containers[0].Transfer(0, "g", g, func(time uint64) []event.Event { return nil }); err == nil {
+		t.Errorf("expected error transferring file through missing link")
+	}
+}
+
+func TestStripedTransfer(t *testing.T) {
+	db := InitSimpleFileDatabase()
+	nw := network.NewSimpleNetwork()
+	nw.AddConnection("DC0", "DC3", 100, 0)
+	nw.AddConnection("DC1", "DC3", 300, 0)
+	nw.AddConnection("DC2", "DC3", 10, 0)
+	containers := make([]*FileContainer, 4)
+	for i, id := range []string{"DC0", "DC1", "DC2", "DC3"} {
+		var fc FileContainer
+		fc.Init(id)
+		fc.SetDatabase(db)
+		fc.SetNetwork(&nw)
+		containers[i] = &fc
+	}
+	f := New("f", 1200)
+	for _, fc := range containers[:3] {
+		fc.Add("f", f)
+	}
+	dst := containers[3]
+	dst.SetStripes(2)
+
+	done := uint64(0)
+	events, err := dst.Transfer(0, "f", f, func(time uint64) []event.Event {
+		done = time
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error '%v' while transferring, expected nil", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected transfer in 2 stripes, found %d", len(events))
+	}
+	// 900 bytes from DC1 and 300 bytes from DC0, both ending at 3
+	for _, e := range events {
+		if e.Time() != 3 {
+			t.Errorf("expected stripe to end at 3, found %d", e.Time())
+		}
+	}
+	events[0].Process()
+	if done != 0 || dst.Has("f") {
+		t.Errorf("expected transfer to end only after all stripes arrive")
+	}
+	events[1].Process()
+	if done != 3 || !dst.Has("f") {
+		t.Errorf("expected transfer to end at 3 after all stripes arrive, found %d", done)
+	}
+
+	empty := New("empty", 0)
+	containers[0].Add("empty", empty)
+	containers[1].Add("empty", empty)
+	events, err = dst.Transfer(0, "empty", empty, func(time uint64) []event.Event { return nil })
+	if err != nil || len(events) != 1 {
+		t.Errorf("expected empty file to be transferred from a single source, found %d transfers and error %v", len(events), err)
+	}
+}
+
+// failingNetwork refuses to start transfers from one location
+type failingNetwork struct {
+	*network.SimpleNetwork
+	from string
+}
+
+func (nw failingNetwork) StartTransfer(when, size uint64, from, to string, consequence func(time uint64) []event.Event) ([]event.Event, error) {
+	if from == nw.from {
+		return nil, fmt.Errorf("link from %s is down", from)
+	}
+	return nw.SimpleNetwork.StartTransfer(when, size, from, to, consequence)
+}
+
+func TestStripeFailure(t *testing.T) {
+	db := InitSimpleFileDatabase()
+	simple := network.NewSimpleNetwork()
+	simple.AddConnection("DC0", "DC2", 100, 0)
+	simple.AddConnection("DC1", "DC2", 300, 0)
+	nw := failingNetwork{SimpleNetwork: &simple, from: "DC0"}
+	containers := make([]*FileContainer, 3)
+	for i, id := range []string{"DC0", "DC1", "DC2"} {
+		var fc FileContainer
+		fc.Init(id)
+		fc.SetDatabase(db)
+		fc.SetNetwork(nw)
+		containers[i] = &fc
+	}
+	f := New("f", 1200)
+	containers[0].Add("f", f)
+	containers[1].Add("f", f)
+	dst := containers[2]
+	dst.SetStripes(2)
+
+	// the stripe from DC1 is started first, as it has the highest bandwidth
+	events, err := dst.Transfer(0, "f", f, func(time uint64) []event.Event { return nil })
+	if err == nil {
+		t.Fatalf("expected error for stripe from DC0, found nil")
+	}
+	if len(events) != 1 || events[0].Time() != 3 {
+		t.Fatalf("expected the stripe already started to be returned, found %v", events)
+	}
+	if events[0].Process(); dst.Has("f") {
+		t.Errorf("expected f not to be stored without all its stripes")
+	}
+}
+
+func TestTransferCost(t *testing.T) {
+	db := InitSimpleFileDatabase()
+	nw := network.NewSimpleNetwork()
+	nw.AddConnection("DC0", "DC2", 10, 0)
+	nw.AddConnection("DC1", "DC2", 100, 0)
+	nw.AddConnection("DC2", "DC0", 100, 0)
+	nw.SetCost("DC0", "DC2", 0.125)
+	nw.SetCost("DC1", "DC2", 0.5)
+	nw.SetCost("DC2", "DC0", 0.25)
+	containers := make([]*FileContainer, 3)
+	for i, id := range []string{"DC0", "DC1", "DC2"} {
+		var fc FileContainer
+		fc.Init(id)
+		fc.SetDatabase(db)
+		fc.SetNetwork(&nw)
+		containers[i] = &fc
+	}
+	f := New("f", 1000)
+	containers[0].Add("f", f)
+	containers[1].Add("f", f)
+
+	if cost := containers[2].TransferCost(f); cost != 500 {
+		t.Errorf("expected copy from the source with highest bandwidth to cost 500, found %v", cost)
+	}
+	containers[2].SetSourceSelection(LowestCost{})
+	if cost := containers[2].TransferCost(f); cost != 125 {
+		t.Errorf("expected copy from the cheapest source to cost 125, found %v", cost)
+	}
+	if cost := containers[0].TransferCost(f); cost != 0 {
+		t.Errorf("expected copy to a container holding the file to be free, found %v", cost)
+	}
+	if cost := containers[2].ShipCost(f, "DC0"); cost != 250 {
+		t.Errorf("expected shipping to DC0 to cost 250, found %v", cost)
+	}
+}
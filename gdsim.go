@@ -4,13 +4,16 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
 	"runtime/pprof"
+	"sort"
 	"strings"
 
 	"github.com/dsfalves/gdsim/file"
 	"github.com/dsfalves/gdsim/job"
 	"github.com/dsfalves/gdsim/log"
+	"github.com/dsfalves/gdsim/metrics"
 	"github.com/dsfalves/gdsim/network"
 	"github.com/dsfalves/gdsim/scheduler"
 	"github.com/dsfalves/gdsim/simulator"
@@ -53,12 +56,234 @@ func printResults(results map[string]*job.Job) {
 	for id, j := range results {
 		tasks := make([]string, len(j.Scheduled))
 		for i, task := range j.Scheduled {
-			tasks[i] = fmt.Sprintf("('%s', '%s', %v, %v, %v)", j.File.Id(), task.Location, j.Submission, task.Start, task.Start+task.Duration)
+			tasks[i] = fmt.Sprintf("('%s', '%s', %v, %v, %v)", j.File.Id(), task.Location, j.Submission, task.Start, task.End())
 		}
 		fmt.Printf("%s %v [%v]\n", id, j.Submission, strings.Join(tasks, ", "))
 	}
 }
 
+/*
+Sets the placement strategy of each data center from a comma separated list of names.
+A single name is used for all data centers.
+*/
+func setPlacement(names string, topo *topology.Topology, seed int64) error {
+	list := strings.Split(names, ",")
+	if len(list) != 1 && len(list) != len(topo.DataCenters) {
+		return fmt.Errorf("expected 1 or %d placement strategies, found %d", len(topo.DataCenters), len(list))
+	}
+	for i, dc := range topo.DataCenters {
+		name := list[0]
+		if len(list) > 1 {
+			name = list[i]
+		}
+		placement, err := topology.NewPlacement(name, seed+int64(i))
+		if err != nil {
+			return err
+		}
+		dc.SetPlacement(placement)
+	}
+	return nil
+}
+
+// Sets a new eviction policy, source selection and number of stripes for the storage of every data center.
+func setStorage(eviction, source string, stripes int, topo *topology.Topology) error {
+	if stripes < 1 {
+		return fmt.Errorf("invalid number of stripes %d: expected a positive integer", stripes)
+	}
+	for _, dc := range topo.DataCenters {
+		policy, err := file.NewEvictionPolicy(eviction)
+		if err != nil {
+			return err
+		}
+		selection, err := file.NewSourceSelection(source)
+		if err != nil {
+			return err
+		}
+		if fc, ok := dc.Container().(*file.FileContainer); ok {
+			fc.SetEvictionPolicy(policy)
+			fc.SetSourceSelection(selection)
+			fc.SetStripes(stripes)
+		}
+	}
+	return nil
+}
+
+/*
+Records whether each job with a deadline completed by its due time,
+and the distributions of lateness and tardiness of those jobs.
+The mean of jobs.deadline_met is the deadline hit rate.
+*/
+func recordDeadlines(results map[string]*job.Job) {
+	stats := metrics.New("jobs")
+	lateness := make([]float64, 0)
+	tardiness := make([]float64, 0)
+	for _, j := range results {
+		if j.Deadline == 0 || len(j.Scheduled) == 0 {
+			continue
+		}
+		late := float64(j.Completion()) - float64(j.Due())
+		met := 0.0
+		if late <= 0 {
+			met = 1
+		}
+		stats.Add("deadline_met", met)
+		stats.Add("lateness", late)
+		stats.Add("tardiness", math.Max(late, 0))
+		lateness = append(lateness, late)
+		tardiness = append(tardiness, math.Max(late, 0))
+	}
+	stats.Quantiles("lateness", lateness)
+	stats.Quantiles("tardiness", tardiness)
+}
+
+/*
+Records the latency of the jobs of each tenant, from submission to completion, and its distribution.
+*/
+func recordTenants(results map[string]*job.Job) {
+	stats := metrics.New("tenant")
+	latencies := make(map[string][]float64)
+	for _, j := range results {
+		if j.Tenant == "" || len(j.Scheduled) == 0 {
+			continue
+		}
+		latency := float64(j.Completion() - j.Submission)
+		stats.Add(fmt.Sprintf("%s.latency", j.Tenant), latency)
+		latencies[j.Tenant] = append(latencies[j.Tenant], latency)
+	}
+	for tenant, values := range latencies {
+		stats.Quantiles(fmt.Sprintf("%s.latency", tenant), values)
+	}
+}
+
+/*
+Records the compute, egress and total cost in dollars of each job, whose sums are the totals of the run,
+and the distribution of the total cost of jobs.
+*/
+func recordCosts(results map[string]*job.Job) {
+	stats := metrics.New("jobs")
+	costs := make([]float64, 0, len(results))
+	for _, j := range results {
+		stats.Add("compute_cost", j.ComputeCost)
+		stats.Add("egress_cost", j.EgressCost)
+		stats.Add("cost", j.Cost())
+		costs = append(costs, j.Cost())
+	}
+	stats.Quantiles("cost", costs)
+}
+
+// Writes the compute, egress and total cost in dollars of each job, one job per line, sorted by id.
+func saveCosts(filename string, results map[string]*job.Job) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	ids := make([]string, 0, len(results))
+	for id := range results {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		j := results[id]
+		if _, err := fmt.Fprintf(f, "%s %v %v %v\n", id, j.ComputeCost, j.EgressCost, j.Cost()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes each task whose run departed from the plan of the REPLAY scheduler to filename, one per line.
+func saveDeviations(filename string, deviations []scheduler.Deviation) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, d := range deviations {
+		if _, err := fmt.Fprintf(f, "%s %s %s %s %d\n", d.Job, d.Task, d.DataCenter, strings.ReplaceAll(d.Reason, " ", "_"), d.Delay); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func saveSwitches(filename string, switches []scheduler.Switch) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, s := range switches {
+		from := s.From
+		if from == "" {
+			from = "-"
+		}
+		if _, err := fmt.Fprintf(f, "%d %s %s %d\n", s.Time, from, s.To, s.Jobs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadPlan(filename string) (scheduler.Plan, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	reader, err := os.Open(filename)
+	check(err)
+	defer reader.Close()
+	return scheduler.LoadPlan(reader)
+}
+
+func loadCarbon(filename string) (topology.CarbonIntensity, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	reader, err := os.Open(filename)
+	check(err)
+	defer reader.Close()
+	return topology.LoadCarbonIntensity(reader)
+}
+
+func loadBackground(filename string, topo *topology.Topology, seed int64) ([]topology.BackgroundArrival, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	reader, err := os.Open(filename)
+	check(err)
+	defer reader.Close()
+	return topology.LoadBackground(reader, topo, seed)
+}
+
+func loadCapacity(filename string, topo *topology.Topology) ([]topology.CapacityChange, []*topology.Autoscaler, error) {
+	if filename == "" {
+		return nil, nil, nil
+	}
+	reader, err := os.Open(filename)
+	check(err)
+	defer reader.Close()
+	return topology.LoadCapacity(reader, topo)
+}
+
+func loadTenants(filename string) (map[string]scheduler.Tenant, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	reader, err := os.Open(filename)
+	check(err)
+	defer reader.Close()
+	return scheduler.LoadTenants(reader)
+}
+
+func saveMetrics(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return metrics.Write(f)
+}
+
 func printFiles(files map[string]file.File, topo *topology.Topology) {
 	fmt.Print("{")
 	for key, value := range files {
@@ -81,7 +306,34 @@ func main() {
 	window := flag.Uint64("window", 3, "scheduling window size")
 	cpuProfilePtr := flag.String("profiler", "", "write cpu profiling to file")
 	logPtr := flag.String("log", "", "file to record log")
-	ratioPtr := flag.Float64("ratio", 0.25, "ratio for adaptive scheduler -- must be larger than 0, and will be ignored if not using the adaptive scheduler")
+	ratioPtr := flag.Float64("ratio", 0.25, "ratio for adaptive schedulers and META threshold policies -- must be larger than 0, and will be ignored by other schedulers")
+	placementPtr := flag.String("placement", "first", "node placement strategy for data centers (first, best, worst, roundrobin or random), either one for all or a comma separated list with one per data center")
+	seedPtr := flag.Int64("seed", 0, "random seed for randomized strategies")
+	metricsPtr := flag.String("metrics", "", "file to record simulation metrics")
+	evictionPtr := flag.String("eviction", "lru", "replica eviction policy for data centers with limited storage: lru, lfu or gdsf")
+	sourcePtr := flag.String("source", "bandwidth", "how data centers choose where to copy files from: bandwidth (highest bandwidth), completion (earliest expected completion), cost (lowest egress cost) or latency (lowest latency)")
+	stripesPtr := flag.Int("stripes", 1, "maximum number of data centers a file is copied from at once, each sending a part of the file")
+	replicationPtr := flag.String("replication", "none", "data replication policy: none, threshold:<accesses>, kreplicas:<k> or cost")
+	replicationBytesPtr := flag.Uint64("replication-bytes", 0, "maximum bytes copied by the replication policy, 0 for no limit")
+	replicationCopiesPtr := flag.Int("replication-copies", 0, "maximum copies made by the replication policy, 0 for no limit")
+	tenantsPtr := flag.String("tenants", "", "tenants description file, with the weight and quotas of each tenant for the FAIR scheduler")
+	costWeightPtr := flag.Float64("cost-weight", 3600, "seconds of completion time worth one dollar for the GEODIS-COST scheduler")
+	costsPtr := flag.String("costs", "", "file to record the compute, egress and total cost in dollars of each job")
+	carbonPtr := flag.String("carbon", "", "carbon intensity file, with the intensity in gCO2/kWh of each data center over time")
+	carbonDelayPtr := flag.Uint64("carbon-delay", 0, "seconds a job may wait after its submission for a greener data center or time with the CARBON scheduler")
+	capacityPtr := flag.String("capacity", "", "capacity file, with scheduled additions and drains of nodes and autoscaling policies of data centers")
+	backgroundPtr := flag.String("background", "", "background load file, with local tasks that use the CPUs of each data center outside the control of the scheduler")
+	planPtr := flag.String("plan", "", "plan file for the REPLAY scheduler, with the data center of each task of each job")
+	deviationsPtr := flag.String("deviations", "", "file to record the tasks whose run departed from the plan of the REPLAY scheduler")
+	externalPtr := flag.String("external", "", "external scheduler for the EXTERNAL scheduler, either a command run by the shell or unix:<path> for a UNIX socket")
+	decisionFactorPtr := flag.Float64("decision-factor", 0, "simulated seconds each scheduling decision takes for every wall-clock second the scheduler runs")
+	decisionCostPtr := flag.Float64("decision-cost", 0, "simulated seconds each scheduling decision takes for every pending job it considers")
+	statePeriodPtr := flag.Uint64("state-period", 0, "seconds between the state messages data centers send each other; if positive, each data center runs its own scheduler for the jobs submitted from it, which sees the other data centers only through these messages")
+	stateLatencyPtr := flag.Uint64("state-latency", 10, "seconds for state messages and forwarded tasks to reach another data center when -state-period is positive")
+	metaSchedulersPtr := flag.String("meta-schedulers", "SWAG,GEODIS", "comma separated list of the schedulers the META scheduler selects from")
+	metaPolicyPtr := flag.String("meta-policy", "makespan", "how the META scheduler selects a scheduler for pending jobs: tasks, durations, availability, demand or load (threshold rules using -ratio), makespan (smallest estimated makespan) or bandit (learned from job latency)")
+	switchesPtr := flag.String("switches", "", "file to record when the META and adaptive schedulers switched to another scheduler")
+	preemptionPtr := flag.String("preemption", "none", "preemption mode for the SRPT scheduler: none, kill (restart preempted tasks from the beginning) or suspend (resume preempted tasks)")
 	flag.Parse()
 	if len(flag.Args()) < 1 {
 		logger.Fatalf("missing files to run")
@@ -115,38 +367,118 @@ func main() {
 	nw := network.NewSimpleNetwork()
 	topo, err := loadTopology(*topologyPtr, &nw)
 	check(err)
+	check(setPlacement(*placementPtr, topo, *seedPtr))
+	topo.Carbon, err = loadCarbon(*carbonPtr)
+	check(err)
+	background, err := loadBackground(*backgroundPtr, topo, *seedPtr)
+	check(err)
+	capacity, autoscalers, err := loadCapacity(*capacityPtr, topo)
+	check(err)
 	files, err := loadFiles(*filesPtr, topo, &nw)
 	check(err)
+	check(setStorage(*evictionPtr, *sourcePtr, *stripesPtr, topo))
 	printFiles(files, topo)
 
 	filename := flag.Args()[0]
 	jobs, err := loadJobs(filename, files)
 	check(err)
 
-	var sched scheduler.Scheduler
-	switch *schedulerPtr {
-	case "GEODIS":
-		sched = scheduler.NewGeoDis(*topo)
-	case "SWAG":
-		sched = scheduler.NewSwag(*topo)
-	case "SRPT":
-		sched = scheduler.NewGRPTS(*topo)
-	case "ADAPTIVE":
-		sched = scheduler.NewAdaptive(*topo, *ratioPtr)
-	case "NADAPTIVE":
-		sched = scheduler.NewAdaptive2(*topo, *ratioPtr)
-	case "RATIO":
-		sched = scheduler.NewRatio1(*topo, *ratioPtr)
-	case "RATIO2":
-		sched = scheduler.NewRatio2(*topo, *ratioPtr)
-	case "RATIO3":
-		sched = scheduler.NewRatio3(*topo, *ratioPtr)
-	default:
-		logger.Fatalf("unindentified scheduler %v", *schedulerPtr)
+	preemption, err := scheduler.ParsePreemptionMode(*preemptionPtr)
+	check(err)
+	tenants, err := loadTenants(*tenantsPtr)
+	check(err)
+	plan, err := loadPlan(*planPtr)
+	check(err)
+
+	var externals []*scheduler.ExternalScheduler
+	var replays []*scheduler.ReplayScheduler
+	var metas []*scheduler.MetaScheduler
+	keep := func(meta *scheduler.MetaScheduler) scheduler.Scheduler {
+		metas = append(metas, meta)
+		return meta
+	}
+	var build func(name string, t topology.Topology) scheduler.Scheduler
+	build = func(name string, t topology.Topology) scheduler.Scheduler {
+		switch name {
+		case "GEODIS":
+			return scheduler.NewGeoDis(t)
+		case "GEODIS-COST":
+			return scheduler.NewCostGeoDis(t, *costWeightPtr)
+		case "SWAG":
+			return scheduler.NewSwag(t)
+		case "SRPT":
+			return scheduler.NewPreemptiveGRPTS(t, preemption)
+		case "EDF":
+			return scheduler.NewEDF(t)
+		case "CARBON":
+			return scheduler.NewCarbon(t, *carbonDelayPtr)
+		case "FAIR":
+			return scheduler.NewFair(t, tenants)
+		case "EXTERNAL":
+			conn, err := scheduler.DialExternal(*externalPtr)
+			check(err)
+			external := scheduler.NewExternal(t, conn)
+			externals = append(externals, external)
+			return external
+		case "REPLAY":
+			replay := scheduler.NewReplay(t, plan)
+			replays = append(replays, replay)
+			return replay
+		case "META":
+			policy, err := scheduler.NewPolicy(*metaPolicyPtr, t, *ratioPtr)
+			check(err)
+			candidates := make([]scheduler.Candidate, 0)
+			for _, sub := range strings.Split(*metaSchedulersPtr, ",") {
+				if sub == "META" {
+					logger.Fatalf("META scheduler cannot select from itself")
+				}
+				candidates = append(candidates, scheduler.Candidate{Name: sub, Scheduler: build(sub, t)})
+			}
+			return keep(scheduler.NewMeta(policy, candidates...))
+		case "ADAPTIVE":
+			return keep(scheduler.NewAdaptive(t, *ratioPtr))
+		case "NADAPTIVE":
+			return keep(scheduler.NewAdaptive2(t, *ratioPtr))
+		case "RATIO":
+			return keep(scheduler.NewRatio1(t, *ratioPtr))
+		case "RATIO2":
+			return keep(scheduler.NewRatio2(t, *ratioPtr))
+		case "RATIO3":
+			return keep(scheduler.NewRatio3(t, *ratioPtr))
+		default:
+			logger.Fatalf("unindentified scheduler %v", name)
+		}
+		return nil
+	}
+	local := func(t topology.Topology) scheduler.Scheduler {
+		return build(*schedulerPtr, t)
+	}
+	if *decisionFactorPtr > 0 || *decisionCostPtr > 0 {
+		untimed := local
+		local = func(t topology.Topology) scheduler.Scheduler {
+			return scheduler.NewTimed(t, *decisionFactorPtr, *decisionCostPtr, untimed)
+		}
+	}
+	sched := local(*topo)
+	if *statePeriodPtr > 0 {
+		sched = scheduler.NewDecentralized(*topo, *statePeriodPtr, *stateLatencyPtr, local)
 	}
 
 	sim := simulator.New(jobs, files, topo, sched, *window)
 	check(err)
+	sim.AddBackground(background)
+	sim.AddCapacityChanges(capacity)
+	sim.Autoscalers = autoscalers
+	replication, err := file.NewReplicationPolicy(*replicationPtr)
+	check(err)
+	if replication != nil {
+		budget := file.ReplicationBudget{
+			Bytes:  *replicationBytesPtr,
+			Copies: *replicationCopiesPtr,
+		}
+		sim.Replication, err = file.NewReplicationManager(topo, files, replication, budget)
+		check(err)
+	}
 	if *cpuProfilePtr != "" {
 		f, err := os.Create(*cpuProfilePtr)
 		if err != nil {
@@ -156,5 +488,32 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 	sim.Run()
+	for _, external := range externals {
+		check(external.Err())
+		check(external.Close())
+	}
 	printResults(sched.Results())
+	recordDeadlines(sched.Results())
+	recordTenants(sched.Results())
+	recordCosts(sched.Results())
+	if *costsPtr != "" {
+		check(saveCosts(*costsPtr, sched.Results()))
+	}
+	if *deviationsPtr != "" {
+		deviations := make([]scheduler.Deviation, 0)
+		for _, replay := range replays {
+			deviations = append(deviations, replay.Deviations()...)
+		}
+		check(saveDeviations(*deviationsPtr, deviations))
+	}
+	if *switchesPtr != "" {
+		switches := make([]scheduler.Switch, 0)
+		for _, meta := range metas {
+			switches = append(switches, meta.Switches()...)
+		}
+		check(saveSwitches(*switchesPtr, switches))
+	}
+	if *metricsPtr != "" {
+		check(saveMetrics(*metricsPtr))
+	}
 }
@@ -13,25 +13,443 @@ import (
 	"github.com/dsfalves/gdsim/file"
 )
 
+// SpeedupModel describes how the duration of a task changes when it runs with fewer CPUs than preferred
+type SpeedupModel interface {
+	// Stretch returns the factor by which the duration of a task is multiplied when running
+	// with cpus instead of preferred CPUs
+	Stretch(preferred, cpus uint) float64
+}
+
+// LinearSpeedup models tasks whose duration is inversely proportional to the number of CPUs.
+type LinearSpeedup struct{}
+
+func (LinearSpeedup) Stretch(preferred, cpus uint) float64 {
+	if cpus == 0 {
+		return 1
+	}
+	return float64(preferred) / float64(cpus)
+}
+
+func (LinearSpeedup) String() string {
+	return "linear"
+}
+
+// AmdahlSpeedup models tasks with a fraction Serial of their work that does not benefit from more CPUs.
+type AmdahlSpeedup struct {
+	Serial float64
+}
+
+func (a AmdahlSpeedup) Stretch(preferred, cpus uint) float64 {
+	if cpus == 0 || preferred == 0 {
+		return 1
+	}
+	time := func(p uint) float64 { return a.Serial + (1-a.Serial)/float64(p) }
+	return time(cpus) / time(preferred)
+}
+
+func (a AmdahlSpeedup) String() string {
+	return fmt.Sprintf("amdahl:%v", a.Serial)
+}
+
+/*
+Parses a speedup model described as "linear" or "amdahl:<serial fraction>".
+*/
+func parseSpeedup(value string) (SpeedupModel, error) {
+	name, param, _ := strings.Cut(value, ":")
+	switch name {
+	case "linear":
+		return LinearSpeedup{}, nil
+	case "amdahl":
+		serial, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid serial fraction for amdahl speedup: %v", err)
+		}
+		if serial < 0 || serial > 1 {
+			return nil, fmt.Errorf("serial fraction for amdahl speedup must be between 0 and 1, found %v", serial)
+		}
+		return AmdahlSpeedup{Serial: serial}, nil
+	}
+	return nil, fmt.Errorf("unknown speedup model %v", value)
+}
+
 // A Task that is included in a Job.
 type Task struct {
-	Duration uint64
+	Duration   uint64
+	Partitions []file.File // files read only by this task, besides the inputs of its job
+	Stage      string      // id of the stage of the task, "" if the job has no stages
+}
+
+// A Stage groups tasks of a Job that become runnable only once every task of its parent stages is done.
+type Stage struct {
+	Id       string
+	Parents  []string // ids of the stages this stage depends on
+	Shuffle  uint64   // bytes each task of the stage sends to every stage that depends on it
+	Tasks    []Task   // tasks of the stage that are not runnable yet
+	released bool
+	left     int // tasks of the stage that are not done yet
+}
+
+// Returns whether s depends on the stage with the given id.
+func (s Stage) dependsOn(id string) bool {
+	return contains(s.Parents, id)
 }
 
 // A scheduled Task becomes DoneTask with Start time and Location of datacenter
 type DoneTask struct {
 	Start, Duration uint64
 	Location        string
+	Delivered       uint64 // time the output of the task reached the origin of its job, 0 if not shipped
+	run             int    // identifies the execution among those recorded for its job, 0 if not recorded
+	concluded       bool   // the task ended, and its output reached the origin of its job if shipped
+}
+
+// End returns the time t completed, including shipping its output to the origin of its job.
+func (t DoneTask) End() uint64 {
+	if end := t.Start + t.Duration; end > t.Delivered {
+		return end
+	}
+	return t.Delivered
 }
 
 // A Job to be handled by the simulation with all its attributes.
 type Job struct {
-	Id         string
-	Submission uint64
-	Cpus       uint
-	Tasks      []Task
-	File       file.File
-	Scheduled  []DoneTask
+	Id           string
+	Submission   uint64
+	Cpus         uint
+	MinCpus      uint         // least number of CPUs a task can run with, 0 if tasks require Cpus
+	Speedup      SpeedupModel // how task durations stretch with fewer CPUs than Cpus, nil for linear
+	Memory       uint64       // memory required by each task, in MB
+	Origin       string       // id of the data center the job was submitted from, "" if unknown
+	Output       uint64       // size in bytes of the output of each task
+	Intermediate bool         // outputs are kept where produced instead of shipped to Origin
+	Deadline     uint64       // time allowed between submission and completion, 0 if the job has no deadline
+	Tenant       string       // tenant or user that submitted the job, "" if unknown
+	Allowed      []string     // ids of the only data centers where tasks of the job may run, all if empty
+	Forbidden    []string     // ids of data centers where tasks of the job must not run
+	AntiAffinity []string     // ids of jobs whose tasks must not run in the same data center as tasks of the job
+	Tasks        []Task
+	File         file.File   // first input of the job, kept for single input jobs
+	Inputs       []file.File // files read by every task of the job
+	Outputs      []file.File // outputs produced by the tasks of the job so far
+	Stages       []Stage     // stages of the job, in an order where parents come before their children
+	Scheduled    []DoneTask
+	runs         int     // executions recorded in Scheduled so far, including removed ones
+	ComputeCost  float64 // dollars charged for the CPUs used by the tasks of the job so far
+	EgressCost   float64 // dollars charged for sending data of the job between data centers so far
+}
+
+// Cost returns the dollars charged for running j so far.
+func (j Job) Cost() float64 {
+	return j.ComputeCost + j.EgressCost
+}
+
+// Returns the stage of j with the given id, or nil if there is none.
+func (j *Job) stage(id string) *Stage {
+	for i := range j.Stages {
+		if j.Stages[i].Id == id {
+			return &j.Stages[i]
+		}
+	}
+	return nil
+}
+
+// Returns whether every task of the stage of j with the given id is done.
+func (j *Job) stageDone(id string) bool {
+	s := j.stage(id)
+	return s == nil || s.released && s.left == 0
+}
+
+/*
+Release moves into Tasks the tasks of every stage of j whose parent stages are all done,
+and returns whether any task became runnable.
+*/
+func (j *Job) Release() bool {
+	released := false
+	for changed := true; changed; {
+		changed = false
+		for i := range j.Stages {
+			s := &j.Stages[i]
+			if s.released {
+				continue
+			}
+			ready := true
+			for _, parent := range s.Parents {
+				ready = ready && j.stageDone(parent)
+			}
+			if !ready {
+				continue
+			}
+			s.released = true
+			s.left = len(s.Tasks)
+			j.Tasks = append(j.Tasks, s.Tasks...)
+			released = released || len(s.Tasks) > 0
+			s.Tasks = nil
+			// stages without tasks are done as soon as they are released
+			changed = changed || s.left == 0
+		}
+	}
+	return released
+}
+
+// Waiting returns whether j has stages whose tasks are not runnable yet.
+func (j Job) Waiting() bool {
+	for _, s := range j.Stages {
+		if !s.released {
+			return true
+		}
+	}
+	return false
+}
+
+// Final returns whether the output of task t is an output of j, which happens when no stage of j depends on the stage of t.
+func (j Job) Final(t Task) bool {
+	for _, s := range j.Stages {
+		if s.dependsOn(t.Stage) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Finish records that task t of j is done, and returns the partitions of its output that are read by
+each task of the stages depending on the stage of t; they must be stored where t ran.
+Tasks of stages whose parent stages are then all done become runnable.
+*/
+func (j *Job) Finish(t Task) []file.File {
+	s := j.stage(t.Stage)
+	if s == nil {
+		return nil
+	}
+	res := make([]file.File, 0)
+	s.left--
+	for i := range j.Stages {
+		child := &j.Stages[i]
+		if s.Shuffle == 0 || child.released || !child.dependsOn(s.Id) {
+			continue
+		}
+		for k := range child.Tasks {
+			id := fmt.Sprintf("%s.%s%d.%s%d", j.Id, s.Id, s.left, child.Id, k)
+			p := file.New(id, s.Shuffle/uint64(len(child.Tasks)))
+			child.Tasks[k].Partitions = append(child.Tasks[k].Partitions, p)
+			res = append(res, p)
+		}
+	}
+	if s.left == 0 {
+		j.Release()
+	}
+	return res
+}
+
+/*
+TaskInputs returns the files read by task t of j: the inputs of j followed by the partitions of t.
+Jobs without Inputs are read as having File as their only input.
+*/
+func (j Job) TaskInputs(t Task) []file.File {
+	inputs := j.Inputs
+	if len(inputs) == 0 && j.File.Id() != "" {
+		inputs = []file.File{j.File}
+	}
+	res := make([]file.File, 0, len(inputs)+len(t.Partitions))
+	res = append(res, inputs...)
+	return append(res, t.Partitions...)
+}
+
+/*
+Parses a list of comma separated file ids, where "-" means an empty list.
+*/
+func parseFiles(list string, files map[string]file.File) ([]file.File, error) {
+	res := make([]file.File, 0)
+	if list == "-" {
+		return res, nil
+	}
+	for _, id := range strings.Split(list, ",") {
+		f, present := files[id]
+		if !present {
+			return nil, fmt.Errorf("missing file %v", id)
+		}
+		res = append(res, f)
+	}
+	return res, nil
+}
+
+// Ships returns whether the outputs of the tasks of j are shipped back to its origin.
+func (j Job) Ships() bool {
+	return j.Output > 0 && j.Origin != "" && !j.Intermediate
+}
+
+// Returns whether list has id.
+func contains(list []string, id string) bool {
+	for _, item := range list {
+		if item == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Permits returns whether tasks of j may run in the data center with id dc.
+func (j Job) Permits(dc string) bool {
+	return (len(j.Allowed) == 0 || contains(j.Allowed, dc)) && !contains(j.Forbidden, dc)
+}
+
+// Avoids returns whether tasks of j must not run in the same data center as tasks of the job with given id.
+func (j Job) Avoids(id string) bool {
+	return contains(j.AntiAffinity, id)
+}
+
+// Due returns the time by which j should be complete, or 0 if j has no deadline.
+func (j Job) Due() uint64 {
+	if j.Deadline == 0 {
+		return 0
+	}
+	return j.Submission + j.Deadline
+}
+
+// Completion returns the time the last scheduled task of j completed, or 0 if no task was scheduled.
+func (j Job) Completion() uint64 {
+	var end uint64
+	for _, t := range j.Scheduled {
+		if t.End() > end {
+			end = t.End()
+		}
+	}
+	return end
+}
+
+/*
+Record adds to the results of j the execution of a task described by t, and returns the id that
+identifies it in later calls, as its position in Scheduled changes when other executions are removed.
+*/
+func (j *Job) Record(t DoneTask) int {
+	j.runs++
+	t.run = j.runs
+	j.Scheduled = append(j.Scheduled, t)
+	return t.run
+}
+
+// Returns the position in Scheduled of the execution of j with the given id, or -1 if there is none.
+func (j Job) execution(run int) int {
+	for i, t := range j.Scheduled {
+		if t.run == run {
+			return i
+		}
+	}
+	return -1
+}
+
+// Unrecord removes from the results of j the execution with the given id, as the task did not complete it.
+func (j *Job) Unrecord(run int) {
+	if i := j.execution(run); i >= 0 {
+		j.Scheduled = append(j.Scheduled[:i], j.Scheduled[i+1:]...)
+	}
+}
+
+// Deliver records that the output of the execution of j with the given id reached the origin of j at time.
+func (j *Job) Deliver(run int, time uint64) {
+	if i := j.execution(run); i >= 0 {
+		j.Scheduled[i].Delivered = time
+	}
+}
+
+/*
+Conclude records that the execution of j with the given id is over: the task ended and,
+if its output is shipped, the output reached the origin of j or failed to be shipped.
+*/
+func (j *Job) Conclude(run int) {
+	if i := j.execution(run); i >= 0 {
+		j.Scheduled[i].concluded = true
+	}
+}
+
+// Concluded returns how many executions of j are over, so their ends no longer change.
+func (j Job) Concluded() int {
+	count := 0
+	for _, t := range j.Scheduled {
+		if t.concluded {
+			count++
+		}
+	}
+	return count
+}
+
+// Stretch returns the factor by which task durations of j are multiplied when running with cpus CPUs.
+func (j Job) Stretch(cpus uint) float64 {
+	if cpus >= j.Cpus {
+		return 1
+	}
+	if j.Speedup == nil {
+		return LinearSpeedup{}.Stretch(j.Cpus, cpus)
+	}
+	return j.Speedup.Stretch(j.Cpus, cpus)
+}
+
+/*
+Sets an optional attribute of j, given as key=value in the job trace.
+*/
+func (j *Job) setAttribute(key, value string) error {
+	var err error
+	switch key {
+	case "memory":
+		j.Memory, err = strconv.ParseUint(value, 0, 64)
+	case "mincpus":
+		var cpus uint64
+		cpus, err = strconv.ParseUint(value, 0, 0)
+		j.MinCpus = uint(cpus)
+	case "speedup":
+		j.Speedup, err = parseSpeedup(value)
+	case "origin":
+		j.Origin = value
+	case "output":
+		j.Output, err = strconv.ParseUint(value, 0, 64)
+	case "intermediate":
+		j.Intermediate, err = strconv.ParseBool(value)
+	case "tenant":
+		j.Tenant = value
+	case "allowed":
+		j.Allowed = strings.Split(value, ",")
+	case "forbidden":
+		j.Forbidden = strings.Split(value, ",")
+	case "antiaffinity":
+		j.AntiAffinity = strings.Split(value, ",")
+	case "deadline":
+		j.Deadline, err = strconv.ParseUint(value, 0, 64)
+	case "stage":
+		err = j.addStage(value)
+	case "shuffle":
+		if len(j.Stages) == 0 {
+			return fmt.Errorf("shuffle given before any stage")
+		}
+		j.Stages[len(j.Stages)-1].Shuffle, err = strconv.ParseUint(value, 0, 64)
+	default:
+		err = fmt.Errorf("unknown attribute %v", key)
+	}
+	return err
+}
+
+/*
+Adds to j a stage described as "<id>" or "<id>:<parent ids separated by commas>".
+Parents must be stages already added to j.
+*/
+func (j *Job) addStage(value string) error {
+	id, parents, found := strings.Cut(value, ":")
+	if id == "" {
+		return fmt.Errorf("missing stage id")
+	}
+	if j.stage(id) != nil {
+		return fmt.Errorf("repeated stage %v", id)
+	}
+	s := Stage{Id: id}
+	if found {
+		for _, parent := range strings.Split(parents, ",") {
+			if j.stage(parent) == nil {
+				return fmt.Errorf("stage %v depends on unknown stage %v", id, parent)
+			}
+			s.Parents = append(s.Parents, parent)
+		}
+	}
+	j.Stages = append(j.Stages, s)
+	return nil
 }
 
 /*
@@ -52,14 +470,17 @@ func Load(reader io.Reader, files map[string]file.File) ([]Job, error) {
 		if len(words) < 5 {
 			return nil, fmt.Errorf("failure to read job %d: incomplete line", len(res)+1)
 		}
-		f, present := files[words[3]]
-		if !present {
-			return nil, fmt.Errorf("failure to read job %d: missing file %v", len(res)+1, words[3])
+		inputs, err := parseFiles(words[3], files)
+		if err != nil {
+			return nil, fmt.Errorf("failure to read job %d: %v", len(res)+1, err)
 		}
 		j := Job{
-			Id:    words[0],
-			File:  f,
-			Tasks: make([]Task, 0),
+			Id:     words[0],
+			Inputs: inputs,
+			Tasks:  make([]Task, 0),
+		}
+		if len(inputs) > 0 {
+			j.File = inputs[0]
 		}
 		cpus, err := strconv.ParseUint(words[1], 0, 0)
 		if err != nil {
@@ -73,13 +494,35 @@ func Load(reader io.Reader, files map[string]file.File) ([]Job, error) {
 			return nil, fmt.Errorf("failure to read job %d: %v", len(res)+1, err)
 		}
 		for i := 4; i < len(words); i++ {
-			d, err := strconv.ParseUint(words[i], 0, 64)
+			if key, value, found := strings.Cut(words[i], "="); found {
+				if err := j.setAttribute(key, value); err != nil {
+					return nil, fmt.Errorf("failure to read job %d: %v", len(res)+1, err)
+				}
+				continue
+			}
+			duration, partitions, bound := strings.Cut(words[i], "@")
+			d, err := strconv.ParseUint(duration, 0, 64)
 			if err != nil {
 				return nil, fmt.Errorf("failure to read job %d: %v", len(res)+1, err)
 			}
 			t := Task{Duration: d}
+			if bound {
+				if t.Partitions, err = parseFiles(partitions, files); err != nil {
+					return nil, fmt.Errorf("failure to read job %d: %v", len(res)+1, err)
+				}
+			}
+			if len(j.Stages) > 0 {
+				s := &j.Stages[len(j.Stages)-1]
+				t.Stage = s.Id
+				s.Tasks = append(s.Tasks, t)
+				continue
+			}
 			j.Tasks = append(j.Tasks, t)
 		}
+		j.Release()
+		if j.MinCpus > j.Cpus {
+			return nil, fmt.Errorf("failure to read job %d: mincpus %d larger than cpus %d", len(res)+1, j.MinCpus, j.Cpus)
+		}
 		res = append(res, j)
 	}
 	if err := scanner.Err(); err != nil {
@@ -51,3 +51,239 @@ func TestLoad(t *testing.T) {
 	validJob(t, jobs[0], "j1", 1, 0, []uint64{1, 2}, files["f1"])
 	validJob(t, jobs[1], "j2", 2, 1, []uint64{7}, files["f2"])
 }
+
+func TestStretch(t *testing.T) {
+	j := Job{Cpus: 4}
+	if s := j.Stretch(2); s != 2 {
+		t.Errorf("expected linear stretch 2, found %v", s)
+	}
+	if s := j.Stretch(4); s != 1 {
+		t.Errorf("expected stretch 1 with all CPUs, found %v", s)
+	}
+	j.Speedup = AmdahlSpeedup{Serial: 0.5}
+	if s := j.Stretch(1); s != 1.6 {
+		t.Errorf("expected amdahl stretch 1.6, found %v", s)
+	}
+	j.Speedup = AmdahlSpeedup{Serial: 1}
+	if s := j.Stretch(1); s != 1 {
+		t.Errorf("expected amdahl stretch 1 for serial tasks, found %v", s)
+	}
+}
+
+func TestLoadMalleable(t *testing.T) {
+	sample := "j1 4 0 f1 mincpus=2 speedup=amdahl:0.2 1 2\nj2 4 0 f1 speedup=linear 1"
+	files := map[string]file.File{
+		"f1": file.New("0", 10),
+	}
+	jobs, err := Load(strings.NewReader(sample), files)
+	if err != nil {
+		t.Fatalf("expected no error for sample '%v', found '%v'", sample, err)
+	}
+	if jobs[0].MinCpus != 2 {
+		t.Errorf("expected job.MinCpus = 2, found %v", jobs[0].MinCpus)
+	}
+	if !cmp.Equal(jobs[0].Speedup, AmdahlSpeedup{Serial: 0.2}) {
+		t.Errorf("expected amdahl speedup with serial fraction 0.2, found %v", jobs[0].Speedup)
+	}
+	if !cmp.Equal(jobs[1].Speedup, LinearSpeedup{}) {
+		t.Errorf("expected linear speedup, found %v", jobs[1].Speedup)
+	}
+	for _, bad := range []string{"j1 4 0 f1 speedup=amdahl:2 1", "j1 4 0 f1 speedup=quadratic 1"} {
+		if _, err := Load(strings.NewReader(bad), files); err == nil {
+			t.Errorf("expected error for sample '%v', found nil", bad)
+		}
+	}
+}
+
+func TestLoadAttributes(t *testing.T) {
+	sample := "j1 1 0 f1 memory=512 1 2\nj2 2 1 f1 7"
+	reader := strings.NewReader(sample)
+	files := map[string]file.File{
+		"f1": file.New("0", 10),
+	}
+
+	jobs, err := Load(reader, files)
+	if err != nil {
+		t.Fatalf("expected no error for sample '%v', found '%v'", sample, err)
+	}
+	validJob(t, jobs[0], "j1", 1, 0, []uint64{1, 2}, files["f1"])
+	if jobs[0].Memory != 512 {
+		t.Errorf("expected job.Memory = 512, found %v", jobs[0].Memory)
+	}
+	if jobs[1].Memory != 0 {
+		t.Errorf("expected job.Memory = 0, found %v", jobs[1].Memory)
+	}
+
+	shipping := "j1 1 0 f1 origin=DC1 output=100 1\nj2 1 0 f1 origin=DC1 output=100 intermediate=true 1\nj3 1 0 f1 origin=DC1 1"
+	jobs, err = Load(strings.NewReader(shipping), files)
+	if err != nil {
+		t.Fatalf("expected no error for sample '%v', found '%v'", shipping, err)
+	}
+	if jobs[0].Origin != "DC1" || jobs[0].Output != 100 || !jobs[0].Ships() {
+		t.Errorf("expected job with origin DC1 and output 100 to ship results, found %+v", jobs[0])
+	}
+	if !jobs[1].Intermediate || jobs[1].Ships() {
+		t.Errorf("expected job with intermediate outputs not to ship results")
+	}
+	if jobs[2].Ships() {
+		t.Errorf("expected job without output not to ship results")
+	}
+
+	bad := "j1 1 0 f1 colour=blue 1"
+	if _, err := Load(strings.NewReader(bad), files); err == nil {
+		t.Errorf("expected error for sample '%v', found nil", bad)
+	}
+	bad = "j1 1 0 f1 intermediate=maybe 1"
+	if _, err := Load(strings.NewReader(bad), files); err == nil {
+		t.Errorf("expected error for sample '%v', found nil", bad)
+	}
+	bad = "j1 2 0 f1 mincpus=3 1"
+	if _, err := Load(strings.NewReader(bad), files); err == nil {
+		t.Errorf("expected error for sample '%v', found nil", bad)
+	}
+}
+
+func TestLoadInputs(t *testing.T) {
+	sample := "j1 1 0 f1,f2 5@p1 6@p1,p2 7\nj2 1 0 - 3@p2"
+	files := map[string]file.File{
+		"f1": file.New("f1", 10),
+		"f2": file.New("f2", 20),
+		"p1": file.New("p1", 1),
+		"p2": file.New("p2", 2),
+	}
+	jobs, err := Load(strings.NewReader(sample), files)
+	if err != nil {
+		t.Fatalf("error '%v' while loading jobs, expected nil", err)
+	}
+	ids := func(inputs []file.File) string {
+		res := make([]string, len(inputs))
+		for i, f := range inputs {
+			res[i] = f.Id()
+		}
+		return strings.Join(res, ",")
+	}
+	expected := []string{"f1,f2,p1", "f1,f2,p1,p2", "f1,f2"}
+	for i, task := range jobs[0].Tasks {
+		if inputs := ids(jobs[0].TaskInputs(task)); inputs != expected[i] {
+			t.Errorf("expected inputs of task %d to be %v, found %v", i, expected[i], inputs)
+		}
+	}
+	if jobs[0].File.Id() != "f1" {
+		t.Errorf("expected job.File to be the first input, found %v", jobs[0].File.Id())
+	}
+	if inputs := ids(jobs[1].TaskInputs(jobs[1].Tasks[0])); inputs != "p2" {
+		t.Errorf("expected job without inputs to read only its partition, found %v", inputs)
+	}
+
+	single := Job{File: files["f1"]}
+	if inputs := ids(single.TaskInputs(Task{Duration: 1})); inputs != "f1" {
+		t.Errorf("expected job without Inputs to read File, found %v", inputs)
+	}
+
+	for _, bad := range []string{"j1 1 0 f1,f9 5", "j1 1 0 f1 5@f9", "j1 1 0 f1 x@p1"} {
+		if _, err := Load(strings.NewReader(bad), files); err == nil {
+			t.Errorf("expected error while loading %q", bad)
+		}
+	}
+}
+
+func TestLoadStages(t *testing.T) {
+	sample := "j1 1 0 f1 stage=map shuffle=100 5 6 stage=reduce:map 7 8 9"
+	files := map[string]file.File{
+		"f1": file.New("f1", 10),
+	}
+	jobs, err := Load(strings.NewReader(sample), files)
+	if err != nil {
+		t.Fatalf("error '%v' while loading jobs, expected nil", err)
+	}
+	j := &jobs[0]
+	if len(j.Tasks) != 2 || !j.Waiting() {
+		t.Fatalf("expected only the 2 map tasks to be runnable, found %v", j.Tasks)
+	}
+	if j.Final(j.Tasks[0]) {
+		t.Errorf("expected map task not to produce an output of the job")
+	}
+	maps := j.Tasks
+	j.Tasks = nil
+	if partitions := j.Finish(maps[0]); len(partitions) != 3 || partitions[0].Size() != 33 {
+		t.Errorf("expected map output to be split in 3 partitions of 33 bytes, found %v", partitions)
+	}
+	if len(j.Tasks) != 0 {
+		t.Errorf("expected reduce tasks to wait for every map task, found %v", j.Tasks)
+	}
+	j.Finish(maps[1])
+	if len(j.Tasks) != 3 || j.Waiting() {
+		t.Fatalf("expected the 3 reduce tasks to be runnable, found %v", j.Tasks)
+	}
+	for _, task := range j.Tasks {
+		if task.Stage != "reduce" || len(task.Partitions) != 2 || !j.Final(task) {
+			t.Errorf("expected final reduce task reading 2 partitions, found %+v", task)
+		}
+	}
+
+	for _, bad := range []string{"j1 1 0 f1 stage=a:b 5", "j1 1 0 f1 stage=a 5 stage=a 6", "j1 1 0 f1 shuffle=10 5"} {
+		if _, err := Load(strings.NewReader(bad), files); err == nil {
+			t.Errorf("expected error while loading %q", bad)
+		}
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	sample := "j1 1 5 f1 deadline=20 10 10\nj2 1 5 f1 10"
+	files := map[string]file.File{
+		"f1": file.New("f1", 10),
+	}
+	jobs, err := Load(strings.NewReader(sample), files)
+	if err != nil {
+		t.Fatalf("error '%v' while loading jobs, expected nil", err)
+	}
+	if due := jobs[0].Due(); due != 25 {
+		t.Errorf("expected job submitted at 5 with deadline 20 to be due at 25, found %d", due)
+	}
+	if due := jobs[1].Due(); due != 0 {
+		t.Errorf("expected job without deadline to be due at 0, found %d", due)
+	}
+	jobs[0].Scheduled = []DoneTask{{Start: 5, Duration: 10}, {Start: 15, Duration: 10, Delivered: 30}}
+	if end := jobs[0].Completion(); end != 30 {
+		t.Errorf("expected job to complete at 30, found %d", end)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	var j Job
+	first := j.Record(DoneTask{Start: 0, Duration: 10})
+	second := j.Record(DoneTask{Start: 0, Duration: 20})
+	j.Unrecord(first)
+	j.Deliver(second, 30)
+	if len(j.Scheduled) != 1 || j.Scheduled[0].Duration != 20 || j.Scheduled[0].Delivered != 30 {
+		t.Errorf("expected only the second execution left, delivered at 30, found %v", j.Scheduled)
+	}
+	// removed executions are not found again
+	j.Unrecord(first)
+	j.Deliver(first, 40)
+	if third := j.Record(DoneTask{Start: 5, Duration: 10}); third == first || len(j.Scheduled) != 2 || j.Scheduled[0].Delivered != 30 {
+		t.Errorf("expected executions of removed ids to be left alone, found %v", j.Scheduled)
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	sample := "j1 1 0 f1 allowed=DC0,DC1 forbidden=DC1 antiaffinity=j2,j3 10"
+	files := map[string]file.File{
+		"f1": file.New("f1", 10),
+	}
+	jobs, err := Load(strings.NewReader(sample), files)
+	if err != nil {
+		t.Fatalf("error '%v' while loading jobs, expected nil", err)
+	}
+	for dc, expected := range map[string]bool{"DC0": true, "DC1": false, "DC2": false} {
+		if jobs[0].Permits(dc) != expected {
+			t.Errorf("expected Permits(%v) = %v", dc, expected)
+		}
+	}
+	if !jobs[0].Avoids("j3") || jobs[0].Avoids("j4") {
+		t.Errorf("expected job to avoid only j2 and j3, found %v", jobs[0].AntiAffinity)
+	}
+	if unconstrained := (Job{}); !unconstrained.Permits("DC2") {
+		t.Errorf("expected job without constraints to permit every data center")
+	}
+}
@@ -0,0 +1,126 @@
+/*
+The package metrics collects measurements taken during a simulation, such as counters and samples, so they can be reported separately from the job results.
+*/
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+type series struct {
+	count         uint64
+	sum, min, max float64
+}
+
+func (s *series) add(value float64) {
+	if s.count == 0 || value < s.min {
+		s.min = value
+	}
+	if s.count == 0 || value > s.max {
+		s.max = value
+	}
+	s.count++
+	s.sum += value
+}
+
+func (s series) mean() float64 {
+	if s.count == 0 {
+		return math.NaN()
+	}
+	return s.sum / float64(s.count)
+}
+
+type registry struct {
+	data map[string]*series
+}
+
+var collected registry
+
+func init() {
+	collected = registry{
+		data: make(map[string]*series),
+	}
+}
+
+// Context records metrics under a common prefix, usually the package or component name.
+type Context struct {
+	id string
+}
+
+func New(id string) Context {
+	return Context{id}
+}
+
+func (c Context) name(name string) string {
+	return fmt.Sprintf("%s.%s", c.id, name)
+}
+
+// Add records value as a new observation of the metric name.
+func (c Context) Add(name string, value float64) {
+	key := c.name(name)
+	s, ok := collected.data[key]
+	if !ok {
+		s = &series{}
+		collected.data[key] = s
+	}
+	s.add(value)
+}
+
+// Count increments the metric name by one.
+func (c Context) Count(name string) {
+	c.Add(name, 1)
+}
+
+/*
+Quantiles records the median, 90th and 99th percentiles of values as the metrics
+name.p50, name.p90 and name.p99, using the nearest rank. Nothing is recorded if values is empty.
+*/
+func (c Context) Quantiles(name string, values []float64) {
+	if len(values) == 0 {
+		return
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	for _, p := range []int{50, 90, 99} {
+		rank := int(math.Ceil(float64(p)/100*float64(len(sorted)))) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		c.Add(fmt.Sprintf("%s.p%d", name, p), sorted[rank])
+	}
+}
+
+// Sum returns the sum of all observations of the metric name.
+func (c Context) Sum(name string) float64 {
+	if s, ok := collected.data[c.name(name)]; ok {
+		return s.sum
+	}
+	return 0
+}
+
+// Reset discards everything recorded so far.
+func Reset() {
+	collected.data = make(map[string]*series)
+}
+
+/*
+Write outputs every metric recorded so far, one per line, sorted by name.
+Each line has the metric name, number of observations, sum, mean, minimum and maximum.
+*/
+func Write(writer io.Writer) error {
+	names := make([]string, 0, len(collected.data))
+	for name := range collected.data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := collected.data[name]
+		if _, err := fmt.Fprintf(writer, "%s %d %v %v %v %v\n", name, s.count, s.sum, s.mean(), s.min, s.max); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,12 +1,18 @@
 package network
 
 import (
-	"container/heap"
 	"fmt"
 
+	"github.com/dsfalves/gdsim/metrics"
 	"github.com/dsfalves/gdsim/scheduler/event"
 )
 
+var stats metrics.Context
+
+func init() {
+	stats = metrics.New("network")
+}
+
 type TransferEvent struct {
 	consequence func(time uint64) []event.Event
 	when        uint64
@@ -31,11 +37,6 @@ type Network interface {
 	// possible error if there's a problem with the transfer.
 	StartTransfer(when, size uint64, from, to string, consequence func(time uint64) []event.Event) ([]event.Event, error)
 
-	// Advances the network simulation up to time.  Returns the
-	// earliest network events that concluded before that time,
-	// the time they happened, or an error.
-	Advance(time uint64) ([]TransferEvent, uint64, error)
-
 	// Status returns a LinkStatus struct describing the current
 	// condition of the link identified by the from, to ids
 	Status(from, to string) (LinkStatus, error)
@@ -43,11 +44,23 @@ type Network interface {
 	AddConnection(from, to string, speed, delay uint64)
 }
 
+// Priced is implemented by networks that charge for the bytes sent through their links
+type Priced interface {
+	// SetCost sets the egress cost of each byte sent from one location to another
+	SetCost(from, to string, cost float64) error
+}
+
 type LinkStatus struct {
 	// I have to think about what to put here
 
 	// available bandwidth
 	Bandwidth uint64
+
+	// time for data to start arriving through the link
+	Latency uint64
+
+	// egress cost of each byte sent through the link
+	Cost float64
 }
 
 type connection struct {
@@ -57,13 +70,11 @@ type connection struct {
 
 // SimpleNetwork models a naive approach to simulating a network.
 type SimpleNetwork struct {
-	heap        event.EventHeap
 	connections map[string]map[string]connection
 }
 
 func NewSimpleNetwork() SimpleNetwork {
 	return SimpleNetwork{
-		heap:        event.NewEventHeap(),
 		connections: make(map[string]map[string]connection),
 	}
 }
@@ -77,9 +88,24 @@ func (network SimpleNetwork) AddConnection(from, to string, speed, delay uint64)
 	f[to] = connection{
 		speed: speed,
 		delay: delay,
+		status: LinkStatus{
+			Bandwidth: speed,
+			Latency:   delay,
+		},
 	}
 }
 
+// SetCost sets the egress cost of each byte sent from one location to another.
+func (network SimpleNetwork) SetCost(from, to string, cost float64) error {
+	conn, ok := network.connections[from][to]
+	if !ok {
+		return fmt.Errorf("no link from %v to %v", from, to)
+	}
+	conn.status.Cost = cost
+	network.connections[from][to] = conn
+	return nil
+}
+
 func (network *SimpleNetwork) StartTransfer(when, size uint64, from, to string, consequence func(time uint64) []event.Event) ([]event.Event, error) {
 	if network.connections == nil {
 		return nil, fmt.Errorf("no topology defined for SimpleNetwork")
@@ -93,26 +119,12 @@ func (network *SimpleNetwork) StartTransfer(when, size uint64, from, to string,
 		return nil, fmt.Errorf("to id %v not in topology", to)
 	}
 	time := when + conn.delay + size/conn.speed
-	heap.Push(&network.heap, TransferEvent{
+	stats.Add("egress_cost", float64(size)*conn.status.Cost)
+	stats.Add(fmt.Sprintf("%s.egress_cost", from), float64(size)*conn.status.Cost)
+	return []event.Event{TransferEvent{
 		when:        time,
 		consequence: consequence,
-	})
-	return nil, nil
-}
-
-func (network *SimpleNetwork) Advance(time uint64) ([]TransferEvent, uint64, error) {
-	if len(network.heap) == 0 {
-		return nil, time, nil
-	}
-	first := network.heap.Top().Time()
-	if first > time {
-		return nil, time, nil
-	}
-	events := make([]TransferEvent, 0)
-	for network.heap.Top().Time() == first {
-		events = append(events, heap.Pop(&network.heap).(TransferEvent))
-	}
-	return events, first, nil
+	}}, nil
 }
 
 func (network *SimpleNetwork) Status(from, to string) (LinkStatus, error) {
@@ -1,10 +1,14 @@
 package network
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/dsfalves/gdsim/scheduler/event"
+)
 
 func TestNewSimpleNetwork(t *testing.T) {
 	sn := NewSimpleNetwork()
-	if len(sn.heap) != 0 || len(sn.connections) != 0 {
+	if len(sn.connections) != 0 {
 		t.Fatalf("NewSimpleNetwork does not return empty network")
 	}
 }
@@ -33,13 +37,45 @@ func TestSNAddConnection(t *testing.T) {
 }
 
 func TestSNStartTransfer(t *testing.T) {
-	t.Fatalf("test not implemented")
-}
-
-func TestSNAdvance(t *testing.T) {
-	t.Fatalf("test not implemented")
+	sn := NewSimpleNetwork()
+	sn.AddConnection("0", "1", 10, 5)
+	var arrival uint64
+	events, err := sn.StartTransfer(100, 50, "0", "1", func(time uint64) []event.Event {
+		arrival = time
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error '%v' while starting transfer, expected nil", err)
+	}
+	if len(events) != 1 || events[0].Time() != 110 {
+		t.Fatalf("expected one transfer ending at 110, found %v", events)
+	}
+	if events[0].Process(); arrival != 110 {
+		t.Errorf("expected consequence at 110, found %v", arrival)
+	}
+	if _, err := sn.StartTransfer(100, 50, "1", "0", nil); err == nil {
+		t.Errorf("expected error for missing link")
+	}
 }
 
 func TestSNStatus(t *testing.T) {
-	t.Fatalf("test not implemented")
+	sn := NewSimpleNetwork()
+	sn.AddConnection("0", "1", 1000, 10)
+	if err := sn.SetCost("0", "1", 0.5); err != nil {
+		t.Fatalf("error '%v' while setting cost, expected nil", err)
+	}
+	status, err := sn.Status("0", "1")
+	if err != nil {
+		t.Fatalf("error '%v' while reading status, expected nil", err)
+	}
+	expected := LinkStatus{Bandwidth: 1000, Latency: 10, Cost: 0.5}
+	if status != expected {
+		t.Errorf("expected status %v, found %v", expected, status)
+	}
+	if _, err := sn.Status("1", "0"); err == nil {
+		t.Errorf("expected error for missing link")
+	}
+	if err := sn.SetCost("1", "0", 1); err == nil {
+		t.Errorf("expected error setting cost of missing link")
+	}
 }
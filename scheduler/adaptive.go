@@ -1,93 +1,40 @@
 package scheduler
 
 /*
-   This is a scheduler that will select from existing scheduler to better adapt to the properties of incoming jobs.
-   This implementation will attempt to do so by estimating the makespan from each scheduler and choosing the one with the smallest makespan.
+   These are schedulers that select from existing schedulers to better adapt to the properties of incoming jobs.
+   Each gives pending jobs to SWAG while a measure of the jobs or the data centers is below a ratio, and to GEODIS otherwise.
 */
 
 import (
-	"math"
-
-	"github.com/dsfalves/gdsim/job"
-	"github.com/dsfalves/gdsim/scheduler/event"
 	"github.com/dsfalves/gdsim/topology"
 )
 
-type AdaptiveScheduler struct {
-	jobs       []*job.Job
-	schedulers []*MakespanScheduler
-	results    map[string]*job.Job
-	ratio      float64
+// Returns the candidates of the adaptive schedulers for t.
+func swagOrGeoDis(t topology.Topology) []Candidate {
+	return []Candidate{{Name: "SWAG", Scheduler: NewSwag(t)}, {Name: "GEODIS", Scheduler: NewGeoDis(t)}}
 }
 
-func NewAdaptive(t topology.Topology, ratio float64) *AdaptiveScheduler {
-	scheduler := &AdaptiveScheduler{}
-	scheduler.schedulers = append(scheduler.schedulers, NewSwag(t), NewGeoDis(t))
-	scheduler.results = make(map[string]*job.Job)
-	scheduler.ratio = ratio
-
-	return scheduler
+// NewAdaptive selects by the dispersion of the number of tasks of pending jobs.
+func NewAdaptive(t topology.Topology, ratio float64) *MetaScheduler {
+	return NewMeta(NewTaskCountPolicy(ratio), swagOrGeoDis(t)...)
 }
 
-func (scheduler *AdaptiveScheduler) Add(j *job.Job) {
-	logger.Debugf("%p.Add(%p)", scheduler, j)
-	scheduler.jobs = append(scheduler.jobs, j)
+// NewAdaptive2 selects by the dispersion of the durations of the tasks of pending jobs.
+func NewAdaptive2(t topology.Topology, ratio float64) *MetaScheduler {
+	return NewMeta(NewDurationPolicy(ratio), swagOrGeoDis(t)...)
 }
 
-func (scheduler *AdaptiveScheduler) Results() map[string]*job.Job {
-	return scheduler.results
+// NewRatio1 selects by the fraction of free CPUs.
+func NewRatio1(t topology.Topology, ratio float64) *MetaScheduler {
+	return NewMeta(NewAvailabilityPolicy(t, ratio), swagOrGeoDis(t)...)
 }
 
-func (scheduler AdaptiveScheduler) Pending() int {
-	return len(scheduler.jobs)
+// NewRatio2 selects by the CPUs required by pending jobs over the CPUs of the data centers.
+func NewRatio2(t topology.Topology, ratio float64) *MetaScheduler {
+	return NewMeta(NewDemandPolicy(t, ratio), swagOrGeoDis(t)...)
 }
 
-func (scheduler *AdaptiveScheduler) Schedule(now uint64) []event.Event {
-	logger.Debugf("%p.Schedule(%v)", scheduler, now)
-
-	mean_tasks := 0.0
-	delta := 0.0
-	delta2 := 0.0
-	mean2 := 0.0
-	count := 0.0
-	for _, j := range scheduler.jobs {
-		count += 1
-		num_tasks := float64(len(j.Tasks))
-		delta = num_tasks - mean_tasks
-		mean_tasks += delta / count
-		delta2 = num_tasks - mean_tasks
-		mean2 += delta * delta2
-	}
-	var var_tasks float64
-	if len(scheduler.jobs) < 2 {
-		var_tasks = math.NaN()
-	} else {
-		var_tasks = mean2 / float64(count-1)
-	}
-
-	var bestIdx int
-	if var_tasks < mean_tasks*scheduler.ratio {
-		bestIdx = 0
-	} else {
-		bestIdx = 1
-	}
-	for _, j := range scheduler.jobs {
-		scheduler.schedulers[bestIdx].Add(j)
-	}
-	scheduler.jobs = scheduler.jobs[:0]
-	events := scheduler.schedulers[bestIdx].Schedule(now)
-
-	for idx, sched := range scheduler.schedulers {
-		jobs := sched.heap.Flush()
-		if idx == bestIdx {
-			for _, job := range jobs {
-				scheduler.jobs = append(scheduler.jobs, &job.Job)
-			}
-		}
-	}
-	for id, j := range scheduler.schedulers[bestIdx].Results() {
-		scheduler.results[id] = j
-	}
-
-	return events
+// NewRatio3 selects by the CPUs required by pending jobs over the free CPUs of the data centers.
+func NewRatio3(t topology.Topology, ratio float64) *MetaScheduler {
+	return NewMeta(NewLoadPolicy(t, ratio), swagOrGeoDis(t)...)
 }
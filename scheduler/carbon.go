@@ -0,0 +1,163 @@
+package scheduler
+
+import (
+	"container/heap"
+	"sort"
+
+	"github.com/dsfalves/gdsim/file"
+	"github.com/dsfalves/gdsim/job"
+	"github.com/dsfalves/gdsim/scheduler/event"
+	"github.com/dsfalves/gdsim/topology"
+)
+
+/*
+CarbonScheduler follows the order of remaining processing time of jobs, like Global-SRPT, but hosts
+each task in the data center with free resources and the lowest carbon intensity of the topology.
+Jobs may wait up to tolerance seconds after their submission, and no longer than their deadline allows,
+for a greener data center or time, according to the carbon intensity forecast of the topology.
+Jobs that cannot wait any longer are queued in the greenest data center if none has free resources.
+*/
+type CarbonScheduler struct {
+	heap      jobHeap
+	topology  topology.Topology
+	tolerance uint64
+	jobs      map[string]*job.Job
+	waiting   []*job.Job // jobs without runnable tasks whose later stages are not runnable yet
+}
+
+func NewCarbon(t topology.Topology, tolerance uint64) *CarbonScheduler {
+	scheduler := &CarbonScheduler{
+		topology:  t,
+		tolerance: tolerance,
+		jobs:      make(map[string]*job.Job),
+	}
+	heap.Init(&scheduler.heap)
+	return scheduler
+}
+
+func (scheduler *CarbonScheduler) Add(j *job.Job) {
+	logger.Debugf("%p.Add(%p)", scheduler, j)
+	sort.Slice(j.Tasks, func(i, k int) bool { return j.Tasks[i].Duration < j.Tasks[k].Duration })
+	heap.Push(&scheduler.heap, j)
+	scheduler.jobs[j.Id] = j
+}
+
+func (scheduler CarbonScheduler) Pending() int {
+	return scheduler.heap.Len() + len(scheduler.waiting)
+}
+
+/*
+Returns the latest time tasks of j may start, after waiting as long as the delay tolerance allows
+and leaving time for its longest task to end by its due time.
+*/
+func (scheduler CarbonScheduler) latest(j job.Job) uint64 {
+	latest := j.Submission + scheduler.tolerance
+	if j.Deadline == 0 || len(j.Tasks) == 0 {
+		return latest
+	}
+	longest := j.Tasks[len(j.Tasks)-1].Duration
+	if due := j.Due(); due < latest+longest {
+		latest = 0
+		if due > longest {
+			latest = due - longest
+		}
+	}
+	return latest
+}
+
+/*
+Returns the data centers suitable for running a task of j that requires files inputs,
+sorted by their carbon intensity at time now and then by transfer time.
+*/
+func (scheduler CarbonScheduler) greenest(j job.Job, inputs []file.File, now uint64) []transferCenter {
+	dcs := fullBestDcs(j, inputs, scheduler.topology)
+	carbon := scheduler.topology.Carbon
+	sort.SliceStable(dcs, func(i, k int) bool {
+		return carbon.At(dcs[i].dataCenter.Id(), now) < carbon.At(dcs[k].dataCenter.Id(), now)
+	})
+	return dcs
+}
+
+/*
+Returns whether some data center in dcs with capacity for the task will be greener before latest
+than the greenest one in dcs with free resources at time now, or whether none has free resources.
+*/
+func (scheduler CarbonScheduler) worthWaiting(dcs []transferCenter, now, latest uint64) bool {
+	carbon := scheduler.topology.Carbon
+	for _, dc := range dcs {
+		if dc.freeJobSlots == 0 {
+			continue
+		}
+		best := carbon.At(dc.dataCenter.Id(), now)
+		for _, other := range dcs {
+			if other.capacity > 0 && carbon.Lowest(other.dataCenter.Id(), now, latest) < best {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func (scheduler *CarbonScheduler) Schedule(now uint64) []event.Event {
+	logger.Debugf("%p.Schedule(%v)", scheduler, now)
+	events := make([]event.Event, 0)
+	for _, j := range released(&scheduler.waiting) {
+		scheduler.Add(j)
+	}
+	delayed := make([]*job.Job, 0)
+	for scheduler.heap.Len() > 0 {
+		top := heap.Pop(&scheduler.heap).(*job.Job)
+		flexible := now < scheduler.latest(*top)
+		held, dropped := false, false
+		for len(top.Tasks) > 0 && !held && !dropped {
+			task := top.Tasks[len(top.Tasks)-1]
+			dcs := scheduler.greenest(*top, top.TaskInputs(task), now)
+			if flexible && scheduler.worthWaiting(dcs, now, scheduler.latest(*top)) {
+				held = true
+				continue
+			}
+			hosted := false
+			for _, dc := range dcs {
+				if dc.freeJobSlots == 0 && flexible {
+					continue
+				}
+				taskEnd := newTaskEndEvent(top, task)
+				taskEnd.start = dc.transferTime + now
+				node, success := dc.dataCenter.Host(taskEnd)
+				if !success {
+					continue
+				}
+				top.Tasks = top.Tasks[:len(top.Tasks)-1]
+				access(dc.dataCenter, top.TaskInputs(task), now)
+				if node != nil {
+					taskEnd.where = node.Location
+					if node.QueueLen() == 1 {
+						events = append(events, node)
+					}
+				}
+				hosted = true
+				break
+			}
+			if !hosted {
+				dropped = unschedulable(*top, dcs, scheduler.topology)
+				held = !dropped
+			}
+		}
+		if dropped {
+			reportUnschedulable(top)
+		} else if held {
+			delayed = append(delayed, top)
+		} else if top.Waiting() {
+			scheduler.waiting = append(scheduler.waiting, top)
+		}
+	}
+	for _, j := range delayed {
+		heap.Push(&scheduler.heap, j)
+	}
+	return events
+}
+
+func (scheduler CarbonScheduler) Results() map[string]*job.Job {
+	return scheduler.jobs
+}
@@ -0,0 +1,67 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dsfalves/gdsim/file"
+	"github.com/dsfalves/gdsim/job"
+	"github.com/dsfalves/gdsim/network"
+	"github.com/dsfalves/gdsim/topology"
+)
+
+func TestCarbonScheduler(t *testing.T) {
+	cap := [][2]int{
+		{1, 1},
+		{1, 1},
+	}
+	speeds := [][]uint64{
+		{0, 10},
+		{10, 0},
+	}
+	intensity := "0 DC0 100\n0 DC1 500\n100 DC1 20\n"
+	tests := []struct {
+		name      string
+		tolerance uint64
+		deadline  uint64
+		held      bool
+		expected  string
+	}{
+		{"greener region", 0, 0, false, "DC0"},
+		{"greener time", 200, 0, true, "DC1"},
+		{"short tolerance", 50, 0, false, "DC0"},
+		{"tight deadline", 200, 105, false, "DC0"},
+	}
+	for _, test := range tests {
+		nw := network.NewSimpleNetwork()
+		topo, err := topology.NewFifo(cap, speeds, &nw)
+		if err != nil {
+			t.Fatalf("failure to setup test: %v", err)
+		}
+		if topo.Carbon, err = topology.LoadCarbonIntensity(strings.NewReader(intensity)); err != nil {
+			t.Fatalf("failure to setup test: %v", err)
+		}
+		files, err := file.Load(strings.NewReader("f1 100 1"), topo, &nw)
+		if err != nil {
+			t.Fatalf("failure to setup test: %v", err)
+		}
+		j := job.Job{Id: "j", Cpus: 1, Deadline: test.deadline, Tasks: []job.Task{{Duration: 10}}, File: files["f1"]}
+		scheduler := NewCarbon(*topo, test.tolerance)
+		scheduler.Add(&j)
+		scheduler.Schedule(0)
+		if held := scheduler.Pending() == 1; held != test.held {
+			t.Fatalf("%s: expected job to be held at time 0: %v, found %v", test.name, test.held, held)
+		}
+		if test.held {
+			scheduler.Schedule(100)
+			if scheduler.Pending() != 0 {
+				t.Fatalf("%s: expected job to be scheduled at time 100, found %d pending", test.name, scheduler.Pending())
+			}
+		}
+		for _, dc := range topo.DataCenters {
+			if running := len(dc.RunningTasks()); (dc.Id() == test.expected) != (running == 1) {
+				t.Errorf("%s: expected the task to run in %s, found %d tasks in %s", test.name, test.expected, running, dc.Id())
+			}
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package scheduler
+
+import (
+	"github.com/dsfalves/gdsim/job"
+	"github.com/dsfalves/gdsim/scheduler/event"
+	"github.com/dsfalves/gdsim/topology"
+)
+
+/*
+DecentralizedScheduler runs a scheduler in each data center of the topology, which schedules the jobs
+submitted from that data center; jobs without origin are submitted to the first data center.
+Each scheduler sees the live state of its own data center, but the state of the others only as they last
+sent it: every data center sends its state to the others every period seconds, and each message takes
+latency seconds to arrive. Tasks a scheduler hosts in another data center are forwarded there, also taking
+latency seconds, and wait in its queue if they find no free resources on arrival.
+*/
+type DecentralizedScheduler struct {
+	topology     topology.Topology
+	period       uint64
+	latency      uint64
+	locals       []Scheduler    // scheduler of each data center
+	views        []*remoteView  // how each data center is seen by the others
+	index        map[string]int // index of each data center by id
+	broadcasting bool           // data centers are sending their state
+	now          uint64         // time of the current scheduling
+	forwarded    []event.Event  // tasks forwarded to other data centers by the current scheduling
+}
+
+/*
+NewDecentralized creates a decentralized scheduler for t, where data centers send their state every period
+seconds and messages between data centers take latency seconds. The scheduler of each data center
+is created by local, with the topology as seen from that data center.
+*/
+func NewDecentralized(t topology.Topology, period, latency uint64, local func(topology.Topology) Scheduler) *DecentralizedScheduler {
+	scheduler := &DecentralizedScheduler{
+		topology: t,
+		period:   period,
+		latency:  latency,
+		index:    make(map[string]int),
+	}
+	for i, dc := range t.DataCenters {
+		scheduler.index[dc.Id()] = i
+		scheduler.views = append(scheduler.views, &remoteView{DataCenter: dc, state: snapshot(dc), owner: scheduler})
+	}
+	for i := range t.DataCenters {
+		seen := t
+		seen.DataCenters = make([]topology.DataCenter, len(t.DataCenters))
+		for k, dc := range t.DataCenters {
+			seen.DataCenters[k] = dc
+			if k != i {
+				seen.DataCenters[k] = scheduler.views[k]
+			}
+		}
+		scheduler.locals = append(scheduler.locals, local(seen))
+	}
+	return scheduler
+}
+
+func (scheduler *DecentralizedScheduler) Add(j *job.Job) {
+	logger.Debugf("%p.Add(%p)", scheduler, j)
+	i, ok := scheduler.index[j.Origin]
+	if !ok && j.Origin != "" {
+		logger.Warnf("job %v submitted from unknown data center %v", j.Id, j.Origin)
+	}
+	scheduler.locals[i].Add(j)
+}
+
+func (scheduler DecentralizedScheduler) Pending() int {
+	var pending int
+	for _, local := range scheduler.locals {
+		pending += local.Pending()
+	}
+	return pending
+}
+
+func (scheduler *DecentralizedScheduler) Schedule(now uint64) []event.Event {
+	logger.Debugf("%p.Schedule(%v)", scheduler, now)
+	scheduler.now = now
+	for _, view := range scheduler.views {
+		view.receive(now)
+	}
+	events := make([]event.Event, 0)
+	if !scheduler.broadcasting {
+		scheduler.broadcasting = true
+		events = append(events, stateBroadcast{When: now, scheduler: scheduler})
+	}
+	for _, local := range scheduler.locals {
+		events = append(events, local.Schedule(now)...)
+	}
+	events = append(events, scheduler.forwarded...)
+	scheduler.forwarded = nil
+	return events
+}
+
+func (scheduler DecentralizedScheduler) Results() map[string]*job.Job {
+	res := make(map[string]*job.Job)
+	for _, local := range scheduler.locals {
+		for id, j := range local.Results() {
+			res[id] = j
+		}
+	}
+	return res
+}
+
+// Returns whether tasks are running in any data center of the topology.
+func (scheduler DecentralizedScheduler) busy() bool {
+	for _, dc := range scheduler.topology.DataCenters {
+		if len(dc.RunningTasks()) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a copy of the current state of dc, or dc itself if it cannot be copied.
+func snapshot(dc topology.DataCenter) topology.DataCenter {
+	if s, ok := dc.(topology.Snapshotter); ok {
+		return s.Snapshot()
+	}
+	return dc
+}
+
+// State of a data center, as sent to the other data centers
+type stateMessage struct {
+	arrival uint64
+	state   topology.DataCenter
+}
+
+/*
+remoteView is a data center as seen from the others. Its resources and running tasks are those of the
+last state received from it, and tasks hosted in it are forwarded to the data center.
+Its storage and queue are those of the data center.
+*/
+type remoteView struct {
+	topology.DataCenter
+	state    topology.DataCenter
+	messages []stateMessage // states sent and not received yet, in order of arrival
+	owner    *DecentralizedScheduler
+}
+
+// Updates the state of view with the last message received by time now.
+func (view *remoteView) receive(now uint64) {
+	for len(view.messages) > 0 && view.messages[0].arrival <= now {
+		view.state = view.messages[0].state
+		view.messages = view.messages[1:]
+	}
+}
+
+func (view remoteView) JobAvailability(cost int) int {
+	return view.state.JobAvailability(cost)
+}
+
+func (view remoteView) Availability(demand topology.Resources) int {
+	return view.state.Availability(demand)
+}
+
+func (view remoteView) FreeResources() topology.Resources {
+	return view.state.FreeResources()
+}
+
+func (view remoteView) ExpectedEndings() []uint64 {
+	return view.state.ExpectedEndings()
+}
+
+func (view remoteView) RunningTasks() []topology.RunningTask {
+	return view.state.RunningTasks()
+}
+
+func (view remoteView) ComputeCost(cpus int, start, end uint64) float64 {
+	if p, ok := view.DataCenter.(topology.Priced); ok {
+		return p.ComputeCost(cpus, start, end)
+	}
+	return 0
+}
+
+/*
+Host forwards task to the data center, where it arrives after the latency between data centers.
+Tasks are never hosted in a node right away, as if they all waited in the queue of the data center.
+*/
+func (view remoteView) Host(task topology.RunningTask) (*topology.Node, bool) {
+	if !view.Accepts(task) {
+		return nil, false
+	}
+	view.owner.forwarded = append(view.owner.forwarded, view.dispatch(view.owner.now, task)...)
+	return nil, true
+}
+
+// Accepts returns whether the data center has capacity for task, as only then is task forwarded.
+func (view remoteView) Accepts(task topology.RunningTask) bool {
+	return topology.Hostable(view.DataCenter, task)
+}
+
+// Forwards task to the data center at time now.
+func (view remoteView) dispatch(now uint64, task topology.RunningTask) []event.Event {
+	stats.Count("forwarded_tasks")
+	return []event.Event{delayedTask{When: now + view.owner.latency, dc: view.DataCenter, task: task, kind: "forwarded"}}
+}
+
+// dispatcher is implemented by data centers seen through views that do not host tasks right away
+type dispatcher interface {
+	// dispatch sends task to the data center at time now, returning the events of its arrival
+	dispatch(now uint64, task topology.RunningTask) []event.Event
+}
+
+// delayedTask is the arrival of a task at the data center it was hosted in some time before
+type delayedTask struct {
+	When uint64
+	dc   topology.DataCenter
+	task topology.RunningTask
+	kind string // why the task was delayed, which prefixes its metrics
+}
+
+func (delayed delayedTask) Time() uint64 {
+	return delayed.When
+}
+
+func (delayed delayedTask) Process() []event.Event {
+	if d, ok := delayed.dc.(dispatcher); ok {
+		return d.dispatch(delayed.When, delayed.task)
+	}
+	delayed.task.SetStart(delayed.When)
+	node, success := delayed.dc.Host(delayed.task)
+	if !success {
+		logger.Warnf("%s task with %d CPUs does not fit in %s", delayed.kind, delayed.task.Cpus(), delayed.dc.Id())
+		stats.Count(delayed.kind + "_tasks_lost")
+		return nil
+	}
+	if node == nil {
+		stats.Count(delayed.kind + "_tasks_queued")
+		return nil
+	}
+	if node.QueueLen() == 1 {
+		return []event.Event{node}
+	}
+	return nil
+}
+
+// stateBroadcast is every data center sending its state to the others
+type stateBroadcast struct {
+	When      uint64
+	scheduler *DecentralizedScheduler
+}
+
+func (broadcast stateBroadcast) Time() uint64 {
+	return broadcast.When
+}
+
+/*
+Process sends the state of every data center, to arrive after the latency between data centers,
+and schedules the next broadcast while jobs are pending or tasks are running.
+*/
+func (broadcast stateBroadcast) Process() []event.Event {
+	scheduler := broadcast.scheduler
+	for k, dc := range scheduler.topology.DataCenters {
+		message := stateMessage{arrival: broadcast.When + scheduler.latency, state: snapshot(dc)}
+		scheduler.views[k].messages = append(scheduler.views[k].messages, message)
+	}
+	if scheduler.Pending() == 0 && !scheduler.busy() {
+		scheduler.broadcasting = false
+		return nil
+	}
+	return []event.Event{stateBroadcast{When: broadcast.When + scheduler.period, scheduler: scheduler}}
+}
@@ -0,0 +1,69 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dsfalves/gdsim/file"
+	"github.com/dsfalves/gdsim/job"
+	"github.com/dsfalves/gdsim/network"
+	"github.com/dsfalves/gdsim/scheduler/event"
+	"github.com/dsfalves/gdsim/topology"
+)
+
+func TestDecentralized(t *testing.T) {
+	cap := [][2]int{
+		{1, 1},
+		{1, 1},
+	}
+	speeds := [][]uint64{
+		{0, 10},
+		{10, 0},
+	}
+	nw := network.NewSimpleNetwork()
+	topo, err := topology.NewFifo(cap, speeds, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	files, err := file.Load(strings.NewReader("f1 10 0"), topo, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	j := job.Job{Id: "j", Cpus: 1, Origin: "DC0", Tasks: []job.Task{{Duration: 100}, {Duration: 100}}, File: files["f1"]}
+	scheduler := NewDecentralized(*topo, 10, 5, func(t topology.Topology) Scheduler { return NewGeoDis(t) })
+	scheduler.Add(&j)
+	events := scheduler.Schedule(0)
+	if scheduler.Pending() != 0 {
+		t.Fatalf("expected all tasks to be scheduled, found %d pending jobs", scheduler.Pending())
+	}
+	var forward event.Event
+	for _, e := range events {
+		if _, ok := e.(delayedTask); ok {
+			forward = e
+		}
+	}
+	if forward == nil || forward.Time() != 5 {
+		t.Fatalf("expected a task forwarded to DC1 arriving at 5, found %v", events)
+	}
+	if running := len(topo.DataCenters[1].RunningTasks()); running != 0 {
+		t.Errorf("expected no task running in DC1 before the forwarded task arrives, found %d", running)
+	}
+
+	topology.BackgroundArrival{When: 1, Dc: topo.DataCenters[1], Cpus: 1, Duration: 1000}.Process()
+	forward.Process()
+	if queued := topo.DataCenters[1].(*topology.FifoDataCenter).QueueLen(); queued != 1 {
+		t.Errorf("expected forwarded task to wait in the queue of DC1, found %d waiting tasks", queued)
+	}
+
+	view := scheduler.views[1]
+	if free := view.JobAvailability(1); free != 1 {
+		t.Errorf("expected DC0 to see DC1 free until it receives its state, found %d free slots", free)
+	}
+	stateBroadcast{When: 10, scheduler: scheduler}.Process()
+	if view.receive(14); view.JobAvailability(1) != 1 {
+		t.Errorf("expected state of DC1 to arrive only at 15")
+	}
+	if view.receive(15); view.JobAvailability(1) != 0 {
+		t.Errorf("expected DC0 to see DC1 busy at 15, found %d free slots", view.JobAvailability(1))
+	}
+}
@@ -0,0 +1,104 @@
+package scheduler
+
+import (
+	"math"
+	"time"
+
+	"github.com/dsfalves/gdsim/job"
+	"github.com/dsfalves/gdsim/scheduler/event"
+	"github.com/dsfalves/gdsim/topology"
+)
+
+/*
+TimedScheduler charges simulated time for the decisions of another scheduler. A decision taken at time now
+takes factor times the wall-clock time the scheduler ran, plus perJob seconds for each job pending when it started,
+rounded to the nearest second, and the tasks it hosts are only sent to their data centers once it ends.
+Scheduling windows that come while a decision is being taken are skipped.
+Wall-clock times, and so the results, vary between runs.
+*/
+type TimedScheduler struct {
+	inner   Scheduler
+	factor  float64
+	perJob  float64
+	ready   uint64        // time the current decision ends
+	decided []delayedTask // tasks hosted by the current decision
+}
+
+/*
+NewTimed creates a scheduler that charges simulated time for the decisions of the scheduler created by inner
+for topology t.
+*/
+func NewTimed(t topology.Topology, factor, perJob float64, inner func(topology.Topology) Scheduler) *TimedScheduler {
+	scheduler := &TimedScheduler{factor: factor, perJob: perJob}
+	seen := t
+	seen.DataCenters = make([]topology.DataCenter, len(t.DataCenters))
+	for i, dc := range t.DataCenters {
+		seen.DataCenters[i] = &decidingView{DataCenter: dc, owner: scheduler}
+	}
+	scheduler.inner = inner(seen)
+	return scheduler
+}
+
+func (scheduler *TimedScheduler) Add(j *job.Job) {
+	scheduler.inner.Add(j)
+}
+
+func (scheduler TimedScheduler) Pending() int {
+	return scheduler.inner.Pending()
+}
+
+// Returns how long a decision considering jobs takes, if the scheduler ran for elapsed wall-clock time.
+func (scheduler TimedScheduler) latency(elapsed time.Duration, jobs int) uint64 {
+	return uint64(math.Round(scheduler.factor*elapsed.Seconds() + scheduler.perJob*float64(jobs)))
+}
+
+func (scheduler *TimedScheduler) Schedule(now uint64) []event.Event {
+	logger.Debugf("%p.Schedule(%v)", scheduler, now)
+	if now < scheduler.ready {
+		stats.Count("decision_skipped_windows")
+		return nil
+	}
+	jobs := scheduler.inner.Pending()
+	start := time.Now()
+	events := scheduler.inner.Schedule(now)
+	latency := scheduler.latency(time.Since(start), jobs)
+	stats.Add("decision_latency", float64(latency))
+	scheduler.ready = now + latency
+	for _, task := range scheduler.decided {
+		task.When = scheduler.ready
+		events = append(events, task)
+	}
+	scheduler.decided = nil
+	return events
+}
+
+func (scheduler TimedScheduler) Results() map[string]*job.Job {
+	return scheduler.inner.Results()
+}
+
+// decidingView is a data center as seen by a scheduler taking a decision, which keeps the tasks hosted in it
+type decidingView struct {
+	topology.DataCenter
+	owner *TimedScheduler
+}
+
+// Host keeps task to be sent to the data center when the decision ends.
+func (view decidingView) Host(task topology.RunningTask) (*topology.Node, bool) {
+	if !view.Accepts(task) {
+		return nil, false
+	}
+	view.owner.decided = append(view.owner.decided, delayedTask{dc: view.DataCenter, task: task, kind: "dispatched"})
+	return nil, true
+}
+
+// Accepts returns whether the data center has capacity for task, as only then is task kept.
+func (view decidingView) Accepts(task topology.RunningTask) bool {
+	return topology.Hostable(view.DataCenter, task)
+}
+
+func (view decidingView) ComputeCost(cpus int, start, end uint64) float64 {
+	if p, ok := view.DataCenter.(topology.Priced); ok {
+		return p.ComputeCost(cpus, start, end)
+	}
+	return 0
+}
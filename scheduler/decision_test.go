@@ -0,0 +1,71 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dsfalves/gdsim/file"
+	"github.com/dsfalves/gdsim/job"
+	"github.com/dsfalves/gdsim/network"
+	"github.com/dsfalves/gdsim/topology"
+)
+
+func TestTimedScheduler(t *testing.T) {
+	cap := [][2]int{
+		{1, 2},
+		{1, 2},
+	}
+	speeds := [][]uint64{
+		{0, 10},
+		{10, 0},
+	}
+	nw := network.NewSimpleNetwork()
+	topo, err := topology.NewFifo(cap, speeds, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	files, err := file.Load(strings.NewReader("f1 10 0"), topo, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	scheduler := NewTimed(*topo, 0, 10, func(t topology.Topology) Scheduler { return NewGeoDis(t) })
+	scheduler.Add(&job.Job{Id: "j1", Cpus: 1, Tasks: []job.Task{{Duration: 100}}, File: files["f1"]})
+	scheduler.Add(&job.Job{Id: "j2", Cpus: 1, Tasks: []job.Task{{Duration: 50}}, File: files["f1"]})
+	events := scheduler.Schedule(0)
+	if scheduler.Pending() != 0 {
+		t.Fatalf("expected all jobs to be scheduled, found %d pending", scheduler.Pending())
+	}
+	delayed := 0
+	for _, e := range events {
+		if _, ok := e.(delayedTask); ok {
+			delayed++
+			if e.Time() != 20 {
+				t.Errorf("expected tasks to be dispatched when the decision ends at 20, found %d", e.Time())
+			}
+		}
+	}
+	if delayed != 2 {
+		t.Fatalf("expected 2 tasks waiting for the decision, found %d", delayed)
+	}
+	if running := len(topo.DataCenters[0].RunningTasks()); running != 0 {
+		t.Errorf("expected no task running before the decision ends, found %d", running)
+	}
+
+	scheduler.Add(&job.Job{Id: "j3", Cpus: 1, Submission: 5, Tasks: []job.Task{{Duration: 10}}, File: files["f1"]})
+	if events := scheduler.Schedule(5); len(events) != 0 || scheduler.Pending() != 1 {
+		t.Errorf("expected no decision before the previous one ends, found %d events and %d pending jobs", len(events), scheduler.Pending())
+	}
+	for _, e := range events {
+		if _, ok := e.(delayedTask); ok {
+			e.Process()
+		}
+	}
+	if running := len(topo.DataCenters[0].RunningTasks()); running != 2 {
+		t.Errorf("expected both tasks running in DC0 after the decision, found %d", running)
+	}
+	for _, rt := range topo.DataCenters[0].RunningTasks() {
+		if start := rt.(*taskEndEvent).start; start != 20 {
+			t.Errorf("expected tasks to start at 20, found %d", start)
+		}
+	}
+}
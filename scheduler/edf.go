@@ -0,0 +1,120 @@
+package scheduler
+
+import (
+	"container/heap"
+	"sort"
+
+	"github.com/dsfalves/gdsim/job"
+	"github.com/dsfalves/gdsim/scheduler/event"
+	"github.com/dsfalves/gdsim/topology"
+)
+
+/*
+Orders jobs by earliest due time, with jobs without deadline after all others,
+and ties broken by shortest remaining processing time.
+*/
+type deadlineHeap []*job.Job
+
+func (h deadlineHeap) Len() int { return len(h) }
+func (h deadlineHeap) Less(i, k int) bool {
+	di, dk := h[i].Due(), h[k].Due()
+	if di != dk && (di == 0 || dk == 0) {
+		return dk == 0
+	}
+	if di != dk {
+		return di < dk
+	}
+	return rpt(*h[i]) < rpt(*h[k])
+}
+func (h deadlineHeap) Swap(i, k int) { h[i], h[k] = h[k], h[i] }
+
+func (h *deadlineHeap) Push(x interface{}) {
+	*h = append(*h, x.(*job.Job))
+}
+
+func (h *deadlineHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[0 : n-1]
+	return x
+}
+
+/*
+EDFScheduler is a Global-EDF scheduler: it places the tasks of the job with the earliest deadline first,
+each in the data center with the shortest transfer time for its inputs that can host it.
+*/
+type EDFScheduler struct {
+	heap     deadlineHeap
+	topology topology.Topology
+	jobs     map[string]*job.Job
+	waiting  []*job.Job // jobs without runnable tasks whose later stages are not runnable yet
+}
+
+func NewEDF(t topology.Topology) *EDFScheduler {
+	scheduler := &EDFScheduler{
+		topology: t,
+		jobs:     make(map[string]*job.Job),
+	}
+	heap.Init(&scheduler.heap)
+	return scheduler
+}
+
+func (scheduler *EDFScheduler) Add(j *job.Job) {
+	logger.Debugf("%p.Add(%p)", scheduler, j)
+	sort.Slice(j.Tasks, func(i, k int) bool { return j.Tasks[i].Duration < j.Tasks[k].Duration })
+	heap.Push(&scheduler.heap, j)
+	scheduler.jobs[j.Id] = j
+}
+
+func (scheduler EDFScheduler) Pending() int {
+	return scheduler.heap.Len() + len(scheduler.waiting)
+}
+
+func (scheduler *EDFScheduler) Schedule(now uint64) []event.Event {
+	logger.Debugf("%p.Schedule(%v)", scheduler, now)
+	events := make([]event.Event, 0)
+	for _, j := range released(&scheduler.waiting) {
+		scheduler.Add(j)
+	}
+	for scheduler.heap.Len() > 0 {
+		top := scheduler.heap[0]
+		dropped := false
+		for len(top.Tasks) > 0 && !dropped {
+			task := top.Tasks[len(top.Tasks)-1]
+			hosted := false
+			dcs := fullBestDcs(*top, top.TaskInputs(task), scheduler.topology)
+			for _, dc := range dcs {
+				taskEnd := newTaskEndEvent(top, task)
+				taskEnd.start = dc.transferTime + now
+				if node, success := dc.dataCenter.Host(taskEnd); success {
+					top.Tasks = top.Tasks[:len(top.Tasks)-1]
+					access(dc.dataCenter, top.TaskInputs(task), now)
+					if node != nil {
+						taskEnd.where = node.Location
+						if node.QueueLen() == 1 {
+							events = append(events, node)
+						}
+					}
+					hosted = true
+					break
+				}
+			}
+			if !hosted && !unschedulable(*top, dcs, scheduler.topology) {
+				return events
+			}
+			dropped = !hosted
+		}
+		heap.Pop(&scheduler.heap)
+		if dropped {
+			reportUnschedulable(top)
+		} else if top.Waiting() {
+			scheduler.waiting = append(scheduler.waiting, top)
+		}
+	}
+	return events
+}
+
+func (scheduler EDFScheduler) Results() map[string]*job.Job {
+	return scheduler.jobs
+}
@@ -0,0 +1,48 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dsfalves/gdsim/file"
+	"github.com/dsfalves/gdsim/job"
+	"github.com/dsfalves/gdsim/network"
+	"github.com/dsfalves/gdsim/topology"
+)
+
+func TestEDF(t *testing.T) {
+	cap := [][2]int{
+		{1, 1},
+	}
+	speeds := [][]uint64{
+		{0},
+	}
+	nw := network.NewSimpleNetwork()
+	topo, err := topology.NewFifo(cap, speeds, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	files, err := file.Load(strings.NewReader("f1 100 0"), topo, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	none := job.Job{Id: "none", Cpus: 1, Tasks: []job.Task{{Duration: 1}}, File: files["f1"]}
+	late := job.Job{Id: "late", Cpus: 1, Deadline: 50, Tasks: []job.Task{{Duration: 5}}, File: files["f1"]}
+	early := job.Job{Id: "early", Cpus: 1, Deadline: 20, Tasks: []job.Task{{Duration: 10}}, File: files["f1"]}
+
+	scheduler := NewEDF(*topo)
+	for _, j := range []*job.Job{&none, &late, &early} {
+		scheduler.Add(j)
+	}
+	scheduler.Schedule(0)
+	if scheduler.Pending() != 0 {
+		t.Fatalf("expected no pending jobs, found %d", scheduler.Pending())
+	}
+	running := topo.DataCenters[0].RunningTasks()
+	if len(running) != 1 || running[0].(*taskEndEvent).job != &early {
+		t.Errorf("expected job with earliest deadline to be running, found %v", running)
+	}
+	if len(late.Scheduled) != 0 || len(none.Scheduled) != 0 {
+		t.Errorf("expected other jobs to be queued in the data center")
+	}
+}
@@ -0,0 +1,406 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/dsfalves/gdsim/file"
+	"github.com/dsfalves/gdsim/job"
+	"github.com/dsfalves/gdsim/scheduler/event"
+	"github.com/dsfalves/gdsim/topology"
+)
+
+// ExternalProtocolVersion is the version of the messages exchanged with external schedulers.
+const ExternalProtocolVersion = 1
+
+/*
+ExternalPatience is how many scheduling windows in a row an external scheduler may assign no task while
+no task runs before its pending jobs are reported unschedulable, as nothing would change its mind.
+*/
+const ExternalPatience = 10
+
+// State of the simulation sent to an external scheduler, as a single line of JSON
+type externalState struct {
+	Version     int                  `json:"version"`
+	Type        string               `json:"type"` // "schedule", answered with assignments, or "end"
+	Time        uint64               `json:"time"`
+	Jobs        []externalJob        `json:"jobs,omitempty"`
+	DataCenters []externalDataCenter `json:"datacenters,omitempty"`
+	Files       []externalFile       `json:"files,omitempty"`
+	Links       []externalLink       `json:"links,omitempty"`
+}
+
+type externalJob struct {
+	Id         string   `json:"id"`
+	Submission uint64   `json:"submission"`
+	Due        uint64   `json:"due,omitempty"` // time by which the job should end, 0 if none
+	Cpus       uint     `json:"cpus"`
+	Memory     uint64   `json:"memory,omitempty"`
+	Origin     string   `json:"origin,omitempty"`
+	Tenant     string   `json:"tenant,omitempty"`
+	Allowed    []string `json:"allowed,omitempty"`
+	Forbidden  []string `json:"forbidden,omitempty"`
+	// Availability is how many tasks of the job each data center can host right away, by id
+	Availability map[string]int `json:"availability"`
+	Tasks        []externalTask `json:"tasks"`
+}
+
+type externalTask struct {
+	Index    int      `json:"index"` // position of the task in its job, used to assign it
+	Duration uint64   `json:"duration"`
+	Inputs   []string `json:"inputs,omitempty"`
+}
+
+type externalDataCenter struct {
+	Id              string   `json:"id"`
+	Cpus            int      `json:"cpus"`
+	Memory          int      `json:"memory,omitempty"`
+	FreeCpus        int      `json:"free_cpus"`
+	FreeMemory      int      `json:"free_memory,omitempty"`
+	ExpectedEndings []uint64 `json:"expected_endings"`
+}
+
+type externalFile struct {
+	Id        string   `json:"id"`
+	Size      uint64   `json:"size"`
+	Locations []string `json:"locations"`
+}
+
+type externalLink struct {
+	From      string  `json:"from"`
+	To        string  `json:"to"`
+	Bandwidth uint64  `json:"bandwidth"`
+	Latency   uint64  `json:"latency"`
+	Cost      float64 `json:"cost"` // egress cost in dollars per byte
+}
+
+// Reply of an external scheduler to a state, as a single line of JSON
+type externalReply struct {
+	Version     int                  `json:"version"`
+	Assignments []externalAssignment `json:"assignments"`
+}
+
+type externalAssignment struct {
+	Job        string `json:"job"`
+	Task       int    `json:"task"`
+	DataCenter string `json:"datacenter"`
+}
+
+/*
+ExternalScheduler delegates decisions to another process. At every scheduling window with pending jobs,
+it sends the state of the simulation, with the tasks of pending jobs, the resources of data centers,
+the locations of input files and the status of links, and waits for the tasks to be assigned to data centers.
+Assigned tasks are hosted like with Global-SRPT, waiting in the queue of their data center if it is full,
+and unassigned tasks stay pending. Assignments that cannot be followed are logged and ignored.
+Jobs are left out of the simulation if the external scheduler makes no progress for ExternalPatience windows.
+*/
+type ExternalScheduler struct {
+	topology topology.Topology
+	conn     io.ReadWriter
+	encoder  *json.Encoder
+	decoder  *json.Decoder
+	jobs     map[string]*job.Job
+	pending  []*job.Job // jobs with tasks to be assigned, in order of submission
+	waiting  []*job.Job // jobs without runnable tasks whose later stages are not runnable yet
+	err      error      // failure to communicate with the external scheduler
+	idle     int        // windows in a row without tasks assigned or running
+}
+
+func NewExternal(t topology.Topology, conn io.ReadWriter) *ExternalScheduler {
+	return &ExternalScheduler{
+		topology: t,
+		conn:     conn,
+		encoder:  json.NewEncoder(conn),
+		decoder:  json.NewDecoder(conn),
+		jobs:     make(map[string]*job.Job),
+	}
+}
+
+/*
+DialExternal connects to an external scheduler at address, either a UNIX socket given as "unix:<path>"
+or a command run by the shell, talking through its standard input and output.
+*/
+func DialExternal(address string) (io.ReadWriteCloser, error) {
+	if strings.HasPrefix(address, "unix:") {
+		return net.Dial("unix", strings.TrimPrefix(address, "unix:"))
+	}
+	cmd := exec.Command("sh", "-c", address)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return process{cmd: cmd, WriteCloser: stdin, ReadCloser: stdout}, nil
+}
+
+// External scheduler running as a subprocess
+type process struct {
+	io.WriteCloser
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+// Close closes the standard input of the process and waits for it to exit.
+func (p process) Close() error {
+	p.WriteCloser.Close()
+	return p.cmd.Wait()
+}
+
+func (scheduler *ExternalScheduler) Add(j *job.Job) {
+	logger.Debugf("%p.Add(%p)", scheduler, j)
+	scheduler.pending = append(scheduler.pending, j)
+	scheduler.jobs[j.Id] = j
+}
+
+func (scheduler ExternalScheduler) Pending() int {
+	if scheduler.err != nil {
+		return 0
+	}
+	return len(scheduler.pending) + len(scheduler.waiting)
+}
+
+func (scheduler *ExternalScheduler) Schedule(now uint64) []event.Event {
+	logger.Debugf("%p.Schedule(%v)", scheduler, now)
+	if scheduler.err != nil {
+		return nil
+	}
+	scheduler.pending = append(scheduler.pending, released(&scheduler.waiting)...)
+	runnable := scheduler.pending[:0]
+	for _, j := range scheduler.pending {
+		if unschedulable(*j, fullBestDcs(*j, j.TaskInputs(job.Task{}), scheduler.topology), scheduler.topology) {
+			reportUnschedulable(j)
+		} else {
+			runnable = append(runnable, j)
+		}
+	}
+	scheduler.pending = runnable
+	if len(scheduler.pending) == 0 {
+		return nil
+	}
+	reply, err := scheduler.exchange(scheduler.state(now))
+	if err != nil {
+		scheduler.err = err
+		logger.Errorf("%v", err)
+		return nil
+	}
+	before := scheduler.tasks()
+	events := scheduler.apply(now, reply.Assignments)
+	if scheduler.tasks() < before || scheduler.busy() {
+		scheduler.idle = 0
+	} else {
+		scheduler.idle++
+	}
+	if scheduler.idle >= ExternalPatience {
+		logger.Warnf("external scheduler assigned no task for %d windows", scheduler.idle)
+		for _, j := range append(scheduler.pending, scheduler.waiting...) {
+			reportUnschedulable(j)
+		}
+		scheduler.pending, scheduler.waiting, scheduler.idle = nil, nil, 0
+		return events
+	}
+	left := scheduler.pending[:0]
+	for _, j := range scheduler.pending {
+		if len(j.Tasks) > 0 {
+			left = append(left, j)
+		} else if j.Waiting() {
+			scheduler.waiting = append(scheduler.waiting, j)
+		}
+	}
+	scheduler.pending = left
+	return events
+}
+
+// Returns how many runnable tasks of pending jobs are left to be assigned.
+func (scheduler ExternalScheduler) tasks() (count int) {
+	for _, j := range scheduler.pending {
+		count += len(j.Tasks)
+	}
+	return count
+}
+
+// Returns whether some data center is running tasks or expects nodes to be added, so the state may still change.
+func (scheduler ExternalScheduler) busy() bool {
+	for _, dc := range scheduler.topology.DataCenters {
+		if len(dc.RunningTasks()) > 0 || restoring(dc) {
+			return true
+		}
+	}
+	return false
+}
+
+func (scheduler ExternalScheduler) Results() map[string]*job.Job {
+	return scheduler.jobs
+}
+
+// Err returns the error that stopped the communication with the external scheduler, if any.
+func (scheduler ExternalScheduler) Err() error {
+	return scheduler.err
+}
+
+// Close tells the external scheduler that the simulation ended, and closes the connection to it if possible.
+func (scheduler *ExternalScheduler) Close() error {
+	err := scheduler.encoder.Encode(externalState{Version: ExternalProtocolVersion, Type: "end"})
+	if closer, ok := scheduler.conn.(io.Closer); ok {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Sends state to the external scheduler and waits for its reply.
+func (scheduler *ExternalScheduler) exchange(state externalState) (externalReply, error) {
+	var reply externalReply
+	if err := scheduler.encoder.Encode(state); err != nil {
+		return reply, fmt.Errorf("failure to send state to external scheduler: %v", err)
+	}
+	if err := scheduler.decoder.Decode(&reply); err != nil {
+		return reply, fmt.Errorf("failure to read reply of external scheduler: %v", err)
+	}
+	if reply.Version != ExternalProtocolVersion {
+		return reply, fmt.Errorf("external scheduler replied with protocol version %d, expected %d", reply.Version, ExternalProtocolVersion)
+	}
+	return reply, nil
+}
+
+// Returns the state of the simulation at time now, as sent to the external scheduler.
+func (scheduler ExternalScheduler) state(now uint64) externalState {
+	state := externalState{Version: ExternalProtocolVersion, Type: "schedule", Time: now}
+	files := make(map[string]file.File)
+	for _, j := range scheduler.pending {
+		ej := externalJob{
+			Id:           j.Id,
+			Submission:   j.Submission,
+			Due:          j.Due(),
+			Cpus:         j.Cpus,
+			Memory:       j.Memory,
+			Origin:       j.Origin,
+			Tenant:       j.Tenant,
+			Allowed:      j.Allowed,
+			Forbidden:    j.Forbidden,
+			Availability: make(map[string]int),
+		}
+		for _, dc := range scheduler.topology.DataCenters {
+			ej.Availability[dc.Id()] = dc.Availability(demand(*j))
+		}
+		for i, task := range j.Tasks {
+			et := externalTask{Index: i, Duration: task.Duration}
+			for _, f := range j.TaskInputs(task) {
+				et.Inputs = append(et.Inputs, f.Id())
+				files[f.Id()] = f
+			}
+			ej.Tasks = append(ej.Tasks, et)
+		}
+		state.Jobs = append(state.Jobs, ej)
+	}
+	for _, dc := range scheduler.topology.DataCenters {
+		total, free := dc.TotalResources(), dc.FreeResources()
+		endings := dc.ExpectedEndings()
+		sort.Slice(endings, func(i, k int) bool { return endings[i] < endings[k] })
+		state.DataCenters = append(state.DataCenters, externalDataCenter{
+			Id:              dc.Id(),
+			Cpus:            total.Cpus,
+			Memory:          total.Memory,
+			FreeCpus:        free.Cpus,
+			FreeMemory:      free.Memory,
+			ExpectedEndings: endings,
+		})
+	}
+	for _, f := range files {
+		ef := externalFile{Id: f.Id(), Size: f.Size(), Locations: make([]string, 0)}
+		for _, dc := range scheduler.topology.DataCenters {
+			if dc.Container().Has(f.Id()) {
+				ef.Locations = append(ef.Locations, dc.Id())
+			}
+		}
+		state.Files = append(state.Files, ef)
+	}
+	sort.Slice(state.Files, func(i, k int) bool { return state.Files[i].Id < state.Files[k].Id })
+	for _, from := range scheduler.topology.DataCenters {
+		fc, ok := from.Container().(*file.FileContainer)
+		if !ok {
+			continue
+		}
+		for _, to := range scheduler.topology.DataCenters {
+			if status, err := fc.Link(to.Id()); err == nil && from != to {
+				state.Links = append(state.Links, externalLink{
+					From:      from.Id(),
+					To:        to.Id(),
+					Bandwidth: status.Bandwidth,
+					Latency:   status.Latency,
+					Cost:      status.Cost,
+				})
+			}
+		}
+	}
+	return state
+}
+
+// Hosts the tasks of pending jobs as assigned at time now, returning the events of nodes that start running them.
+func (scheduler *ExternalScheduler) apply(now uint64, assignments []externalAssignment) []event.Event {
+	index := make(map[string]int)
+	for i, dc := range scheduler.topology.DataCenters {
+		index[dc.Id()] = i
+	}
+	events := make([]event.Event, 0)
+	hosted := make(map[*job.Job]map[int]bool)
+	for _, a := range assignments {
+		j, ok := scheduler.jobs[a.Job]
+		i, found := index[a.DataCenter]
+		if !ok || !found || a.Task < 0 || a.Task >= len(j.Tasks) || hosted[j][a.Task] {
+			logger.Warnf("ignoring invalid assignment of task %d of job %v to %v", a.Task, a.Job, a.DataCenter)
+			stats.Count("external_rejected_assignments")
+			continue
+		}
+		task := j.Tasks[a.Task]
+		dc := scheduler.topology.DataCenters[i]
+		inputs := j.TaskInputs(task)
+		if !permitted(*j, inputs, dc) {
+			logger.Warnf("ignoring assignment of task %d of job %v to %v, where it may not run", a.Task, a.Job, a.DataCenter)
+			stats.Count("external_rejected_assignments")
+			continue
+		}
+		taskEnd := newTaskEndEvent(j, task)
+		taskEnd.start = inputsTransferTime(inputs, scheduler.topology, i) + now
+		node, success := dc.Host(taskEnd)
+		if !success {
+			logger.Warnf("ignoring assignment of task %d of job %v to %v, which cannot host it", a.Task, a.Job, a.DataCenter)
+			stats.Count("external_rejected_assignments")
+			continue
+		}
+		access(dc, inputs, now)
+		if node != nil {
+			taskEnd.where = node.Location
+			if node.QueueLen() == 1 {
+				events = append(events, node)
+			}
+		}
+		if hosted[j] == nil {
+			hosted[j] = make(map[int]bool)
+		}
+		hosted[j][a.Task] = true
+	}
+	for j, tasks := range hosted {
+		left := make([]job.Task, 0, len(j.Tasks)-len(tasks))
+		for i, task := range j.Tasks {
+			if !tasks[i] {
+				left = append(left, task)
+			}
+		}
+		j.Tasks = left
+	}
+	return events
+}
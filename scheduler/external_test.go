@@ -0,0 +1,136 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/dsfalves/gdsim/file"
+	"github.com/dsfalves/gdsim/job"
+	"github.com/dsfalves/gdsim/network"
+	"github.com/dsfalves/gdsim/topology"
+)
+
+func TestExternalScheduler(t *testing.T) {
+	cap := [][2]int{
+		{1, 2},
+		{1, 2},
+	}
+	speeds := [][]uint64{
+		{0, 10},
+		{10, 0},
+	}
+	nw := network.NewSimpleNetwork()
+	topo, err := topology.NewFifo(cap, speeds, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	files, err := file.Load(strings.NewReader("f1 100 0"), topo, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	local, remote := net.Pipe()
+	states := make(chan externalState, 2)
+	go func() {
+		decoder, encoder := json.NewDecoder(remote), json.NewEncoder(remote)
+		for {
+			var state externalState
+			if err := decoder.Decode(&state); err != nil {
+				close(states)
+				return
+			}
+			states <- state
+			if state.Type == "end" {
+				remote.Close()
+				close(states)
+				return
+			}
+			encoder.Encode(externalReply{
+				Version: ExternalProtocolVersion,
+				Assignments: []externalAssignment{
+					{Job: "j1", Task: 1, DataCenter: "DC1"},
+					{Job: "j1", Task: 5, DataCenter: "DC1"},
+					{Job: "j2", Task: 0, DataCenter: "DC9"},
+				},
+			})
+		}
+	}()
+
+	j1 := job.Job{Id: "j1", Cpus: 1, Tasks: []job.Task{{Duration: 10}, {Duration: 20}}, File: files["f1"]}
+	j2 := job.Job{Id: "j2", Cpus: 2, Tasks: []job.Task{{Duration: 30}}}
+	scheduler := NewExternal(*topo, local)
+	scheduler.Add(&j1)
+	scheduler.Add(&j2)
+	events := scheduler.Schedule(0)
+	if err := scheduler.Err(); err != nil {
+		t.Fatalf("error '%v' while talking to the external scheduler, expected nil", err)
+	}
+
+	state := <-states
+	if state.Version != ExternalProtocolVersion || state.Type != "schedule" || len(state.Jobs) != 2 || len(state.DataCenters) != 2 {
+		t.Fatalf("expected state with 2 jobs and 2 data centers, found %+v", state)
+	}
+	if a := state.Jobs[1].Availability; a["DC0"] != 1 || a["DC1"] != 1 {
+		t.Errorf("expected room for a task of j2 in each data center, found %v", a)
+	}
+	if len(state.Files) != 1 || state.Files[0].Id != "f1" || len(state.Files[0].Locations) != 1 || state.Files[0].Locations[0] != "DC0" {
+		t.Errorf("expected f1 to be in DC0, found %+v", state.Files)
+	}
+	if len(state.Links) != 2 || state.Links[0].Bandwidth != 10 {
+		t.Errorf("expected links between DC0 and DC1 with bandwidth 10, found %+v", state.Links)
+	}
+
+	if len(events) != 1 || len(topo.DataCenters[1].RunningTasks()) != 1 {
+		t.Errorf("expected the assigned task to run in DC1, found %d events", len(events))
+	}
+	if len(j1.Tasks) != 1 || j1.Tasks[0].Duration != 10 {
+		t.Errorf("expected task 0 of j1 to be left pending, found %v", j1.Tasks)
+	}
+	if scheduler.Pending() != 2 {
+		t.Errorf("expected 2 jobs to be pending, found %d", scheduler.Pending())
+	}
+	if err := scheduler.Close(); err != nil {
+		t.Errorf("error '%v' while closing the external scheduler, expected nil", err)
+	}
+	if state := <-states; state.Type != "end" {
+		t.Errorf("expected end of simulation to be sent, found %+v", state)
+	}
+}
+
+func TestExternalPatience(t *testing.T) {
+	nw := network.NewSimpleNetwork()
+	topo, err := topology.NewFifo([][2]int{{1, 1}}, [][]uint64{{0}}, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	local, remote := net.Pipe()
+	defer local.Close()
+	go func() {
+		decoder, encoder := json.NewDecoder(remote), json.NewEncoder(remote)
+		for {
+			var state externalState
+			if err := decoder.Decode(&state); err != nil {
+				return
+			}
+			encoder.Encode(externalReply{Version: ExternalProtocolVersion})
+		}
+	}()
+
+	j := job.Job{Id: "j", Cpus: 1, Tasks: []job.Task{{Duration: 10}}}
+	scheduler := NewExternal(*topo, local)
+	scheduler.Add(&j)
+	for i := 1; i < ExternalPatience; i++ {
+		scheduler.Schedule(uint64(i))
+	}
+	if scheduler.Pending() != 1 {
+		t.Fatalf("expected job to be pending before the external scheduler runs out of patience, found %d pending jobs", scheduler.Pending())
+	}
+	scheduler.Schedule(ExternalPatience)
+	if err := scheduler.Err(); err != nil {
+		t.Fatalf("error '%v' while talking to the external scheduler, expected nil", err)
+	}
+	if scheduler.Pending() != 0 || len(j.Scheduled) != 0 {
+		t.Errorf("expected job to be left out after %d windows without progress, found %d pending jobs", ExternalPatience, scheduler.Pending())
+	}
+}
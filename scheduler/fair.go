@@ -0,0 +1,275 @@
+package scheduler
+
+import (
+	"bufio"
+	"container/heap"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dsfalves/gdsim/job"
+	"github.com/dsfalves/gdsim/scheduler/event"
+	"github.com/dsfalves/gdsim/topology"
+)
+
+// Tenant describes the share of the topology a tenant is entitled to
+type Tenant struct {
+	// Weight of the tenant; a tenant with weight 2 is entitled to twice the share of one with weight 1
+	Weight float64
+	// Quota is the most CPUs the tenant can use at once in the whole topology, 0 if not limited
+	Quota int
+	// DcQuota is the most CPUs the tenant can use at once in each data center, by data center id
+	DcQuota map[string]int
+}
+
+// DefaultTenant is used for tenants without a description.
+var DefaultTenant = Tenant{Weight: 1}
+
+/*
+Loads the description of tenants from reader, one per line, as the tenant name and its weight,
+optionally followed by quota=<cpus> and <data center id>=<cpus> fields, e.g. "teamA 2 quota=64 DC0=16".
+*/
+func LoadTenants(reader io.Reader) (map[string]Tenant, error) {
+	res := make(map[string]Tenant)
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 {
+			continue
+		}
+		if len(words) < 2 {
+			return nil, fmt.Errorf("failure to read tenant %d: missing weight", line)
+		}
+		tenant := Tenant{DcQuota: make(map[string]int)}
+		var err error
+		if tenant.Weight, err = strconv.ParseFloat(words[1], 64); err != nil || tenant.Weight <= 0 {
+			return nil, fmt.Errorf("failure to read tenant %d: invalid weight %v", line, words[1])
+		}
+		for _, word := range words[2:] {
+			key, value, found := strings.Cut(word, "=")
+			cpus, err := strconv.Atoi(value)
+			if !found || err != nil || cpus < 0 {
+				return nil, fmt.Errorf("failure to read tenant %d: invalid quota %v", line, word)
+			}
+			if key == "quota" {
+				tenant.Quota = cpus
+			} else {
+				tenant.DcQuota[key] = cpus
+			}
+		}
+		res[words[0]] = tenant
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Resources currently used by the running tasks of a tenant
+type tenantUsage struct {
+	total topology.Resources
+	cpus  map[string]int // CPUs used in each data center, by id
+}
+
+// Returns the resources used by the running tasks of each tenant in t.
+func usage(t topology.Topology) map[string]*tenantUsage {
+	res := make(map[string]*tenantUsage)
+	for _, dc := range t.DataCenters {
+		for _, rt := range dc.RunningTasks() {
+			task, ok := rt.(*taskEndEvent)
+			if !ok {
+				continue
+			}
+			u := res[task.job.Tenant]
+			if u == nil {
+				u = &tenantUsage{cpus: make(map[string]int)}
+				res[task.job.Tenant] = u
+			}
+			u.total.Cpus += task.cpus
+			u.total.Memory += task.memory
+			u.cpus[dc.Id()] += task.cpus
+		}
+	}
+	return res
+}
+
+// Returns the sum of the resources of all data centers in t.
+func totalResources(t topology.Topology) topology.Resources {
+	var total topology.Resources
+	for _, dc := range t.DataCenters {
+		r := dc.TotalResources()
+		total.Cpus += r.Cpus
+		total.Memory += r.Memory
+	}
+	return total
+}
+
+/*
+Shares returns the dominant share of the resources of t used by the running tasks of each tenant.
+Tenants without running tasks are not included.
+*/
+func Shares(t topology.Topology) map[string]float64 {
+	total := totalResources(t)
+	res := make(map[string]float64)
+	for name, u := range usage(t) {
+		res[name] = topology.DominantShare(u.total, total)
+	}
+	return res
+}
+
+/*
+FairScheduler keeps a queue of jobs for each tenant, ordered by remaining processing time.
+It repeatedly hosts a task of the tenant with the lowest dominant share divided by its weight,
+following Dominant Resource Fairness, without exceeding the quotas of the tenant.
+Tasks are only hosted in data centers with free resources for them, in the one with the
+shortest transfer time for their inputs.
+*/
+type FairScheduler struct {
+	queues   map[string]*jobHeap
+	tenants  map[string]Tenant
+	topology topology.Topology
+	jobs     map[string]*job.Job
+	waiting  []*job.Job // jobs without runnable tasks whose later stages are not runnable yet
+}
+
+func NewFair(t topology.Topology, tenants map[string]Tenant) *FairScheduler {
+	return &FairScheduler{
+		queues:   make(map[string]*jobHeap),
+		tenants:  tenants,
+		topology: t,
+		jobs:     make(map[string]*job.Job),
+	}
+}
+
+func (scheduler *FairScheduler) Add(j *job.Job) {
+	logger.Debugf("%p.Add(%p)", scheduler, j)
+	sort.Slice(j.Tasks, func(i, k int) bool { return j.Tasks[i].Duration < j.Tasks[k].Duration })
+	queue, ok := scheduler.queues[j.Tenant]
+	if !ok {
+		queue = &jobHeap{}
+		scheduler.queues[j.Tenant] = queue
+	}
+	heap.Push(queue, j)
+	scheduler.jobs[j.Id] = j
+}
+
+func (scheduler FairScheduler) Pending() int {
+	pending := len(scheduler.waiting)
+	for _, queue := range scheduler.queues {
+		pending += queue.Len()
+	}
+	return pending
+}
+
+// Returns the description of tenant name, or DefaultTenant if there is none.
+func (scheduler FairScheduler) tenant(name string) Tenant {
+	if tenant, ok := scheduler.tenants[name]; ok {
+		return tenant
+	}
+	return DefaultTenant
+}
+
+// Returns whether a tenant using u may use cpus more CPUs in data center dc without exceeding its quotas.
+func (tenant Tenant) allows(u *tenantUsage, dc string, cpus int) bool {
+	if tenant.Quota > 0 && u.total.Cpus+cpus > tenant.Quota {
+		return false
+	}
+	if quota, ok := tenant.DcQuota[dc]; ok && u.cpus[dc]+cpus > quota {
+		return false
+	}
+	return true
+}
+
+/*
+Returns the name of the tenant with queued jobs and not in blocked with the lowest dominant share
+divided by its weight, or false if there is none. Ties are broken by name.
+*/
+func (scheduler FairScheduler) next(used map[string]*tenantUsage, total topology.Resources, blocked map[string]bool) (string, bool) {
+	best, found := "", false
+	var bestShare float64
+	for name, queue := range scheduler.queues {
+		if queue.Len() == 0 || blocked[name] {
+			continue
+		}
+		share := 0.0
+		if u, ok := used[name]; ok {
+			share = topology.DominantShare(u.total, total) / scheduler.tenant(name).Weight
+		}
+		if !found || share < bestShare || share == bestShare && name < best {
+			best, bestShare, found = name, share, true
+		}
+	}
+	return best, found
+}
+
+func (scheduler *FairScheduler) Schedule(now uint64) []event.Event {
+	logger.Debugf("%p.Schedule(%v)", scheduler, now)
+	events := make([]event.Event, 0)
+	for _, j := range released(&scheduler.waiting) {
+		scheduler.Add(j)
+	}
+	used := usage(scheduler.topology)
+	total := totalResources(scheduler.topology)
+	blocked := make(map[string]bool)
+	for name, found := scheduler.next(used, total, blocked); found; name, found = scheduler.next(used, total, blocked) {
+		queue := scheduler.queues[name]
+		u, ok := used[name]
+		if !ok {
+			u = &tenantUsage{cpus: make(map[string]int)}
+			used[name] = u
+		}
+		top := (*queue)[0]
+		if len(top.Tasks) == 0 {
+			heap.Pop(queue)
+			if top.Waiting() {
+				scheduler.waiting = append(scheduler.waiting, top)
+			}
+			continue
+		}
+		task := top.Tasks[len(top.Tasks)-1]
+		cost := demand(*top)
+		hosted := false
+		dcs := fullBestDcs(*top, top.TaskInputs(task), scheduler.topology)
+		for _, dc := range dcs {
+			if dc.freeJobSlots == 0 || !scheduler.tenant(name).allows(u, dc.dataCenter.Id(), cost.Cpus) {
+				continue
+			}
+			taskEnd := newTaskEndEvent(top, task)
+			taskEnd.start = dc.transferTime + now
+			node, success := dc.dataCenter.Host(taskEnd)
+			if !success {
+				continue
+			}
+			if node != nil {
+				taskEnd.where = node.Location
+				if node.QueueLen() == 1 {
+					events = append(events, node)
+				}
+			}
+			access(dc.dataCenter, top.TaskInputs(task), now)
+			u.total.Cpus += taskEnd.cpus
+			u.total.Memory += taskEnd.memory
+			u.cpus[dc.dataCenter.Id()] += taskEnd.cpus
+			hosted = true
+			break
+		}
+		if !hosted && unschedulable(*top, dcs, scheduler.topology) {
+			heap.Pop(queue)
+			reportUnschedulable(top)
+			continue
+		}
+		if !hosted {
+			blocked[name] = true
+			continue
+		}
+		// jobs left without tasks leave the queue the next time their tenant is chosen
+		top.Tasks = top.Tasks[:len(top.Tasks)-1]
+	}
+	return events
+}
+
+func (scheduler FairScheduler) Results() map[string]*job.Job {
+	return scheduler.jobs
+}
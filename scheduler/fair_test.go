@@ -0,0 +1,76 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dsfalves/gdsim/file"
+	"github.com/dsfalves/gdsim/job"
+	"github.com/dsfalves/gdsim/network"
+	"github.com/dsfalves/gdsim/topology"
+)
+
+func TestLoadTenants(t *testing.T) {
+	tenants, err := LoadTenants(strings.NewReader("a 2 quota=64 DC0=16\n\nb 0.5"))
+	if err != nil {
+		t.Fatalf("error '%v' while loading tenants, expected nil", err)
+	}
+	if a := tenants["a"]; a.Weight != 2 || a.Quota != 64 || a.DcQuota["DC0"] != 16 {
+		t.Errorf("expected tenant a with weight 2 and quotas 64 and 16 in DC0, found %+v", a)
+	}
+	if b := tenants["b"]; b.Weight != 0.5 || b.Quota != 0 {
+		t.Errorf("expected tenant b with weight 0.5 and no quota, found %+v", b)
+	}
+	for _, bad := range []string{"a", "a 0", "a 1 quota", "a 1 DC0=x"} {
+		if _, err := LoadTenants(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected error while loading %q", bad)
+		}
+	}
+}
+
+func TestFairScheduler(t *testing.T) {
+	tests := []struct {
+		tenants  map[string]Tenant
+		expected map[string]int
+	}{
+		{nil, map[string]int{"a": 2, "b": 2}},
+		{map[string]Tenant{"a": {Weight: 3}}, map[string]int{"a": 3, "b": 1}},
+		{map[string]Tenant{"a": {Weight: 1, DcQuota: map[string]int{"DC0": 1}}}, map[string]int{"a": 1, "b": 3}},
+	}
+	for _, test := range tests {
+		cap := [][2]int{
+			{1, 4},
+		}
+		speeds := [][]uint64{
+			{0},
+		}
+		nw := network.NewSimpleNetwork()
+		topo, err := topology.NewFifo(cap, speeds, &nw)
+		if err != nil {
+			t.Fatalf("failure to setup test: %v", err)
+		}
+		files, err := file.Load(strings.NewReader("f1 100 0"), topo, &nw)
+		if err != nil {
+			t.Fatalf("failure to setup test: %v", err)
+		}
+		scheduler := NewFair(*topo, test.tenants)
+		for _, tenant := range []string{"a", "b"} {
+			scheduler.Add(&job.Job{
+				Id:     tenant,
+				Cpus:   1,
+				Tenant: tenant,
+				Tasks:  []job.Task{{Duration: 10}, {Duration: 10}, {Duration: 10}, {Duration: 10}},
+				File:   files["f1"],
+			})
+		}
+		scheduler.Schedule(0)
+		for tenant, running := range test.expected {
+			if found := len(scheduler.Results()[tenant].Scheduled); found != running {
+				t.Errorf("expected %d running tasks of tenant %s with tenants %v, found %d", running, tenant, test.tenants, found)
+			}
+		}
+		if share := Shares(*topo)["a"]; share != float64(test.expected["a"])/4 {
+			t.Errorf("expected share of tenant a to be %v, found %v", float64(test.expected["a"])/4, share)
+		}
+	}
+}
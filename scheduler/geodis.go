@@ -20,7 +20,7 @@ type makespanJob struct {
 	job.Job
 	tasks        []scheduledTask
 	makespan     uint64
-	bestDcs      func(file.File, topology.Topology, int) []transferCenter
+	bestDcs      func(job.Job, []file.File, topology.Topology) []transferCenter
 	destinations []transferCenter
 }
 
@@ -45,18 +45,23 @@ type lightDc struct {
 }
 
 func (dc lightDc) ending() uint64 {
+	return dc.start() + dc.transferTime
+}
+
+// Returns the earliest time a task could start in dc, before transferring its inputs.
+func (dc lightDc) start() uint64 {
 	if len(dc.endTimes) > 0 {
-		return dc.endTimes[0] + dc.transferTime
+		return dc.endTimes[0]
 	}
-	return dc.now + dc.transferTime
+	return dc.now
 }
 
 type dcHeap []lightDc
 
 func (heap dcHeap) Len() int { return len(heap) }
 func (heap dcHeap) Less(i, j int) bool {
-	end1 := heap[i].ending() + heap[i].transferTime
-	end2 := heap[j].ending() + heap[j].transferTime
+	end1 := heap[i].ending() + heap[i].transferTime + heap[i].tc.penalty
+	end2 := heap[j].ending() + heap[j].transferTime + heap[j].tc.penalty
 	return end1 < end2
 }
 func (heap dcHeap) Swap(i, j int)       { heap[i], heap[j] = heap[j], heap[i] }
@@ -67,6 +72,26 @@ func (heap *dcHeap) Pop() interface{} {
 	return x
 }
 
+/*
+Returns the index in heap of the best data center among tcs for a task with partitions,
+counting the penalty of each one, and the time to transfer the inputs of the task there, or -1 if no data center in tcs is in heap.
+*/
+func (heap dcHeap) bestFor(tcs []transferCenter) (int, uint64) {
+	best, transfer, penalty := -1, uint64(0), uint64(0)
+	for _, tc := range tcs {
+		for k, dc := range heap {
+			if dc.tc.dataCenter != tc.dataCenter {
+				continue
+			}
+			if best == -1 || dc.start()+2*tc.transferTime+tc.penalty < heap[best].start()+2*transfer+penalty {
+				best, transfer, penalty = k, tc.transferTime, tc.penalty
+			}
+			break
+		}
+	}
+	return best, transfer
+}
+
 /*
    Created a lightweight copy of transferCenters tcs, with current timestamp now.
 */
@@ -111,16 +136,17 @@ func lightCopy(tcs []transferCenter, now uint64) []lightDc {
 }
 
 /*
-   Returns the time that task would start if hosted in tc, starting from now.
+   Returns the time that task would end if hosted in tc, starting from now,
+   when transferring its inputs takes transferTime.
 */
-func (tc *lightDc) fakeHost(task job.Task, now uint64) uint64 {
-	var time uint64 = task.Duration + tc.transferTime + now
+func (tc *lightDc) fakeHost(task job.Task, transferTime, now uint64) uint64 {
+	var time uint64 = task.Duration + transferTime + now
 	if tc.free > 0 {
 		tc.free--
 		heap.Push(&tc.endTimes, time)
 	} else if len(tc.endTimes) > 0 {
 		now = tc.endTimes[0]
-		time = task.Duration + tc.transferTime + now
+		time = task.Duration + transferTime + now
 		tc.endTimes[0] = time
 		heap.Fix(&tc.endTimes, 0)
 	} else {
@@ -130,23 +156,50 @@ func (tc *lightDc) fakeHost(task job.Task, now uint64) uint64 {
 	return time
 }
 
+/*
+Updates the destination of each task of j and the makespan of j, hosting tasks greedily
+in simulated copies of the data centers in t starting from now.
+Tasks with partitions are placed according to the location of their own inputs.
+The makespan is math.MaxUint64 if some task of j cannot be placed in any data center.
+*/
 func (j *makespanJob) updateMakespan(t topology.Topology, now uint64) uint64 {
-	tc := j.bestDcs(j.File, t, int(j.Cpus))
+	tc := j.bestDcs(j.Job, j.TaskInputs(job.Task{}), t)
 	var fakeTcs dcHeap = lightCopy(tc, now)
 	heap.Init(&fakeTcs)
 	j.makespan = 0
 
 	for i, task := range j.Tasks {
-		endTime := fakeTcs[0].fakeHost(task, now)
-		j.destinations[i] = fakeTcs[0].tc
+		best, transfer := -1, uint64(0)
+		if len(task.Partitions) > 0 {
+			best, transfer = fakeTcs.bestFor(j.bestDcs(j.Job, j.TaskInputs(task), t))
+		} else if len(fakeTcs) > 0 {
+			best, transfer = 0, fakeTcs[0].transferTime
+		}
+		if best == -1 {
+			j.makespan = math.MaxUint64
+			return j.makespan
+		}
+		endTime := fakeTcs[best].fakeHost(task, transfer, now)
+		j.destinations[i] = fakeTcs[best].tc
+		j.destinations[i].transferTime = transfer
 		if endTime > j.makespan {
 			j.makespan = endTime
 		}
-		heap.Fix(&fakeTcs, 0)
+		heap.Fix(&fakeTcs, best)
 	}
 	return j.makespan
 }
 
+// Returns whether the destination of some task of j now runs or queues tasks in conflict with j.
+func (j *makespanJob) conflicting() bool {
+	for _, destination := range j.destinations {
+		if conflicts(j.Job, destination.dataCenter) {
+			return true
+		}
+	}
+	return false
+}
+
 type makespanHeap struct {
 	jobPile []*makespanJob
 	topo    topology.Topology
@@ -178,20 +231,15 @@ func (h makespanHeap) Top() *makespanJob {
 	return h.jobPile[0]
 }
 
-func (h makespanHeap) Flush() []*makespanJob {
-	jp := h.jobPile
-	h.jobPile = make([]*makespanJob, 0, 0)
-	return jp
-}
-
 type MakespanScheduler struct {
 	heap     makespanHeap
 	topology topology.Topology
 	jobs     map[string]*job.Job
-	bestDcs  func(file.File, topology.Topology, int) []transferCenter
+	bestDcs  func(job.Job, []file.File, topology.Topology) []transferCenter
+	waiting  []*makespanJob // jobs without runnable tasks whose later stages are not runnable yet
 }
 
-func NewMakespanScheduler(t topology.Topology, bestDcs func(file.File, topology.Topology, int) []transferCenter) *MakespanScheduler {
+func NewMakespanScheduler(t topology.Topology, bestDcs func(job.Job, []file.File, topology.Topology) []transferCenter) *MakespanScheduler {
 	scheduler := &MakespanScheduler{
 		topology: t,
 		jobs:     make(map[string]*job.Job),
@@ -206,21 +254,40 @@ func (scheduler *MakespanScheduler) Add(j *job.Job) {
 	var msJob makespanJob
 	msJob.Job = *j
 	msJob.bestDcs = scheduler.bestDcs
-	sort.Slice(msJob.Job.Tasks, func(i, k int) bool { return msJob.Job.Tasks[i].Duration < msJob.Job.Tasks[k].Duration })
-	msJob.tasks = make([]scheduledTask, len(msJob.Tasks))
-	msJob.destinations = make([]transferCenter, len(msJob.Tasks))
-	for i, t := range msJob.Tasks {
-		msJob.tasks[i].duration = t.Duration
-	}
+	msJob.prepare()
 	scheduler.heap.Push(&msJob)
 	scheduler.jobs[j.Id] = &msJob.Job
 }
 
+// Sorts the runnable tasks of j by duration and makes room for their destinations.
+func (j *makespanJob) prepare() {
+	sort.Slice(j.Job.Tasks, func(i, k int) bool { return j.Job.Tasks[i].Duration < j.Job.Tasks[k].Duration })
+	j.tasks = make([]scheduledTask, len(j.Tasks))
+	j.destinations = make([]transferCenter, len(j.Tasks))
+	for i, t := range j.Tasks {
+		j.tasks[i].duration = t.Duration
+	}
+}
+
+// Returns to the heap the waiting jobs that have tasks of new stages to run.
+func (scheduler *MakespanScheduler) resume() {
+	kept := scheduler.waiting[:0]
+	for _, j := range scheduler.waiting {
+		if len(j.Tasks) == 0 {
+			kept = append(kept, j)
+			continue
+		}
+		j.prepare()
+		scheduler.heap.Push(j)
+	}
+	scheduler.waiting = kept
+}
+
 func (scheduler *MakespanScheduler) Update(now uint64) (totalMakespan uint64) {
 	logger.Debugf("%p.Update(%v)", scheduler, now)
 	totalMakespan = 0
 	for _, j := range scheduler.heap.jobPile {
-		if endTime := j.updateMakespan(scheduler.topology, now); endTime > totalMakespan {
+		if endTime := j.updateMakespan(scheduler.topology, now); endTime > totalMakespan && endTime != math.MaxUint64 {
 			totalMakespan = endTime
 		}
 	}
@@ -229,38 +296,60 @@ func (scheduler *MakespanScheduler) Update(now uint64) (totalMakespan uint64) {
 }
 
 func (scheduler MakespanScheduler) Pending() int {
-	return scheduler.heap.Len()
+	return scheduler.heap.Len() + len(scheduler.waiting)
 }
 
 func (scheduler *MakespanScheduler) Schedule(now uint64) []event.Event {
 	logger.Debugf("%p.Schedule(%v)", scheduler, now)
 	events := make([]event.Event, 0)
+	scheduler.resume()
 	scheduler.Update(now)
 
 	logger.Debugf("%d jobs remain", scheduler.heap.Len())
+	deferred := make([]*makespanJob, 0)
 	for scheduler.heap.Len() > 0 {
 		top := scheduler.heap.Top()
+		if top.makespan == math.MaxUint64 {
+			heap.Pop(&scheduler.heap)
+			// jobs kept out of data centers by anti-affinity may be placed once conflicting tasks end,
+			// and jobs that only fit data centers without nodes in service once nodes are added
+			if inConflict(top.Job, scheduler.topology) || awaitsNodes(top.Job, scheduler.topology) {
+				deferred = append(deferred, top)
+			} else {
+				reportUnschedulable(&top.Job)
+			}
+			continue
+		}
+		if top.conflicting() {
+			// destinations were chosen before the jobs hosted earlier in this window
+			heap.Pop(&scheduler.heap)
+			deferred = append(deferred, top)
+			continue
+		}
 		logger.Debugf("top job has id %v, %d jobs remain", top.Id, scheduler.heap.Len())
 		logger.Debugf("top job submitted at %d, now is %d", top.Submission, now)
 		for i := len(top.Tasks) - 1; i >= 0; i-- {
 			task := top.Tasks[i]
 			destination := top.destinations[i]
 			dataCenter := destination.dataCenter
-			taskEnd := &taskEndEvent{
-				// TODO: this should be tied to the completion of the transfer
-				start:        destination.transferTime + now,
-				duration:     task.Duration,
-				cpus:         int(top.Cpus),
-				job:          &top.Job,
-				transferTime: destination.transferTime,
-			}
+			taskEnd := newTaskEndEvent(&top.Job, task)
+			// TODO: this should be tied to the completion of the transfer
+			taskEnd.start = destination.transferTime + now
+			taskEnd.transferTime = destination.transferTime
 			if node, success := dataCenter.Host(taskEnd); success {
+				inputs := top.TaskInputs(task)
+				access(dataCenter, inputs, now)
 				if destination.transferTime > 0 {
-					events = append(events, transferFileEvent{
-						f:     top.File,
-						where: destination.dataCenter,
-						when:  now,
-					})
+					for _, f := range inputs {
+						if !dataCenter.Container().Has(f.Id()) {
+							events = append(events, transferFileEvent{
+								f:     f,
+								where: destination.dataCenter,
+								when:  now,
+								job:   &top.Job,
+							})
+						}
+					}
 				}
 				if node != nil {
 					taskEnd.where = node.Location
@@ -274,9 +363,17 @@ func (scheduler *MakespanScheduler) Schedule(now uint64) []event.Event {
 		}
 
 		heap.Pop(&scheduler.heap)
+		if top.Waiting() {
+			// tasks of later stages are added to Tasks when they become runnable
+			top.Tasks = nil
+			scheduler.waiting = append(scheduler.waiting, top)
+		}
 		// try to host all tasks of top job
 		// if success, pop it
 	}
+	for _, j := range deferred {
+		scheduler.heap.Push(j)
+	}
 
 	return events
 }
@@ -285,25 +382,68 @@ func (scheduler MakespanScheduler) Results() map[string]*job.Job {
 	return scheduler.jobs
 }
 
-func NewGeoDis(t topology.Topology) *MakespanScheduler {
-	return NewMakespanScheduler(t, fullBestDcs)
+/*
+Withdraw removes and returns the jobs left in the heap of scheduler that have not run any task,
+which are those it could not place in its last scheduling.
+*/
+func (scheduler *MakespanScheduler) Withdraw() []*job.Job {
+	res := make([]*job.Job, 0)
+	kept := scheduler.heap.jobPile[:0]
+	for _, j := range scheduler.heap.jobPile {
+		if len(j.Scheduled) > 0 {
+			kept = append(kept, j)
+			continue
+		}
+		res = append(res, &j.Job)
+		delete(scheduler.jobs, j.Id)
+	}
+	scheduler.heap.jobPile = kept
+	heap.Init(&scheduler.heap)
+	return res
 }
 
-func presentBestDcs(f file.File, t topology.Topology, cost int) []transferCenter {
-	res := make([]transferCenter, 0)
-	locations := make([]int, 0, len(t.DataCenters))
-	for i, dc := range t.DataCenters {
-		if dc.Container().Has(f.Id()) {
-			locations = append(locations, i)
+/*
+Estimate returns the makespan that scheduler expects for jobs if they were added to it at time now,
+as the latest end of their tasks, each job placed on its own in the current state of the data centers.
+It returns math.MaxUint64 if some job cannot be placed.
+*/
+func (scheduler MakespanScheduler) Estimate(now uint64, jobs []*job.Job) uint64 {
+	var res uint64
+	for _, j := range jobs {
+		copied := makespanJob{Job: *j, bestDcs: scheduler.bestDcs}
+		copied.Tasks = append([]job.Task{}, j.Tasks...)
+		copied.prepare()
+		if end := copied.updateMakespan(scheduler.topology, now); end > res {
+			res = end
 		}
 	}
+	return res
+}
+
+func NewGeoDis(t topology.Topology) *MakespanScheduler {
+	return NewMakespanScheduler(t, fullBestDcs)
+}
 
+/*
+Returns the data centers that hold all files in inputs and have capacity according to the demand of j,
+leaving out those where the constraints of j do not allow its tasks to run.
+*/
+func presentBestDcs(j job.Job, inputs []file.File, t topology.Topology) []transferCenter {
+	cost := demand(j)
+	res := make([]transferCenter, 0)
 	for _, dc := range t.DataCenters {
-		if dc.Container().Has(f.Id()) {
+		present := true
+		for _, f := range inputs {
+			if !dc.Container().Has(f.Id()) {
+				present = false
+				break
+			}
+		}
+		if present && j.Permits(dc.Id()) && !conflicts(j, dc) {
 			tc := transferCenter{
 				transferTime: 0,
-				capacity:     dc.JobCapacity(cost),
-				freeJobSlots: dc.JobAvailability(cost),
+				capacity:     dc.Capacity(cost),
+				freeJobSlots: dc.Availability(cost),
 				dataCenter:   dc,
 			}
 			if tc.capacity > 0 {
@@ -311,9 +451,6 @@ func presentBestDcs(f file.File, t topology.Topology, cost int) []transferCenter
 			}
 		}
 	}
-	if len(res) == 0 {
-		logger.Fatalf("Job using file %s cannot be scheduled on any data center", f.Id)
-	}
 	return res
 }
 
@@ -0,0 +1,170 @@
+package scheduler
+
+import (
+	"github.com/dsfalves/gdsim/job"
+	"github.com/dsfalves/gdsim/scheduler/event"
+)
+
+// Candidate is a scheduler a MetaScheduler may give jobs to, with the name its decisions are logged with
+type Candidate struct {
+	Name      string
+	Scheduler Scheduler
+}
+
+// Policy selects which candidate of a MetaScheduler takes the jobs pending at a scheduling window
+type Policy interface {
+	// Select returns the index in candidates of the scheduler that takes jobs at time now
+	Select(now uint64, jobs []*job.Job, candidates []Candidate) int
+	// Observe tells the policy that a job given to the candidate with the given index completed after latency seconds
+	Observe(candidate int, latency uint64)
+}
+
+// Withdrawer is implemented by schedulers that can give back jobs they were added that have not run any task
+type Withdrawer interface {
+	// Withdraw removes and returns the jobs that could not be placed so far and have not run any task
+	Withdraw() []*job.Job
+}
+
+// Switch is a scheduling window where a MetaScheduler gave jobs to a different candidate than before
+type Switch struct {
+	Time     uint64
+	From, To string // names of the candidates, From is "" for the first jobs given
+	Jobs     int    // number of jobs given to To at that window
+}
+
+// Where a job was given, to tell the policy its latency once it completes
+type assignment struct {
+	candidate int
+	tasks     int // tasks of the job, including those of later stages
+}
+
+/*
+MetaScheduler gives the jobs pending at each scheduling window to one of its candidates, as selected
+by a policy, and then schedules every candidate that has pending jobs.
+Jobs stay with the candidate they were given to, except for those a Withdrawer gives back without having
+run any task, which are pending again at the next window.
+Each change of candidate is logged as a switch.
+*/
+type MetaScheduler struct {
+	policy     Policy
+	candidates []Candidate
+	jobs       []*job.Job // jobs not given to any candidate yet
+	current    int        // index of the last candidate given jobs, -1 if none
+	given      map[string]assignment
+	switches   []Switch
+}
+
+// NewMeta creates a scheduler giving jobs to candidates as selected by policy.
+func NewMeta(policy Policy, candidates ...Candidate) *MetaScheduler {
+	return &MetaScheduler{
+		policy:     policy,
+		candidates: candidates,
+		current:    -1,
+		given:      make(map[string]assignment),
+	}
+}
+
+func (scheduler *MetaScheduler) Add(j *job.Job) {
+	logger.Debugf("%p.Add(%p)", scheduler, j)
+	scheduler.jobs = append(scheduler.jobs, j)
+}
+
+func (scheduler MetaScheduler) Pending() int {
+	pending := len(scheduler.jobs)
+	for _, c := range scheduler.candidates {
+		pending += c.Scheduler.Pending()
+	}
+	return pending
+}
+
+// Returns the number of tasks of j, including those of stages that are not runnable yet.
+func countTasks(j job.Job) int {
+	count := len(j.Tasks)
+	for _, s := range j.Stages {
+		count += len(s.Tasks)
+	}
+	return count
+}
+
+/*
+Tells the policy the latency of the jobs given to candidates that completed since the last window,
+which are those whose tasks all ended and delivered their output, so their completion no longer changes.
+*/
+func (scheduler *MetaScheduler) observe() {
+	for id, given := range scheduler.given {
+		j := scheduler.candidates[given.candidate].Scheduler.Results()[id]
+		if j == nil || j.Concluded() < given.tasks {
+			continue
+		}
+		scheduler.policy.Observe(given.candidate, j.Completion()-j.Submission)
+		delete(scheduler.given, id)
+	}
+}
+
+// Gives the pending jobs to the candidate selected by the policy at time now, logging a switch if it changed.
+func (scheduler *MetaScheduler) give(now uint64) {
+	best := scheduler.policy.Select(now, scheduler.jobs, scheduler.candidates)
+	if best != scheduler.current {
+		var from string
+		if scheduler.current >= 0 {
+			from = scheduler.candidates[scheduler.current].Name
+		}
+		to := scheduler.candidates[best].Name
+		logger.Infof("switching from %v to %v at %v with %d jobs", from, to, now, len(scheduler.jobs))
+		stats.Count("meta_switches")
+		scheduler.switches = append(scheduler.switches, Switch{Time: now, From: from, To: to, Jobs: len(scheduler.jobs)})
+		scheduler.current = best
+	}
+	for _, j := range scheduler.jobs {
+		if tasks := countTasks(*j); tasks > 0 {
+			scheduler.given[j.Id] = assignment{candidate: best, tasks: tasks}
+		}
+		scheduler.candidates[best].Scheduler.Add(j)
+	}
+	scheduler.jobs = scheduler.jobs[:0]
+}
+
+func (scheduler *MetaScheduler) Schedule(now uint64) []event.Event {
+	logger.Debugf("%p.Schedule(%v)", scheduler, now)
+	scheduler.observe()
+	if len(scheduler.jobs) > 0 {
+		scheduler.give(now)
+	}
+	events := make([]event.Event, 0)
+	// the candidate just given jobs goes first, as the others only resume jobs they already had
+	if scheduler.current >= 0 {
+		events = append(events, scheduler.candidates[scheduler.current].Scheduler.Schedule(now)...)
+	}
+	for i, c := range scheduler.candidates {
+		if i != scheduler.current && c.Scheduler.Pending() > 0 {
+			events = append(events, c.Scheduler.Schedule(now)...)
+		}
+	}
+	for _, c := range scheduler.candidates {
+		if w, ok := c.Scheduler.(Withdrawer); ok {
+			for _, j := range w.Withdraw() {
+				delete(scheduler.given, j.Id)
+				scheduler.jobs = append(scheduler.jobs, j)
+			}
+		}
+	}
+	return events
+}
+
+func (scheduler MetaScheduler) Results() map[string]*job.Job {
+	res := make(map[string]*job.Job)
+	for _, c := range scheduler.candidates {
+		for id, j := range c.Scheduler.Results() {
+			res[id] = j
+		}
+	}
+	for _, j := range scheduler.jobs {
+		res[j.Id] = j
+	}
+	return res
+}
+
+// Switches returns the changes of candidate so far, in the order they happened.
+func (scheduler MetaScheduler) Switches() []Switch {
+	return scheduler.switches
+}
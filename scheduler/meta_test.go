@@ -0,0 +1,203 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dsfalves/gdsim/file"
+	"github.com/dsfalves/gdsim/job"
+	"github.com/dsfalves/gdsim/network"
+	"github.com/dsfalves/gdsim/scheduler/event"
+	"github.com/dsfalves/gdsim/topology"
+)
+
+// stubScheduler keeps the jobs it is added without running them, giving them back when withdrawn if reluctant
+type stubScheduler struct {
+	jobs      map[string]*job.Job
+	pending   []*job.Job
+	reluctant bool
+	schedules int
+}
+
+func newStub(reluctant bool) *stubScheduler {
+	return &stubScheduler{jobs: make(map[string]*job.Job), reluctant: reluctant}
+}
+
+func (s *stubScheduler) Add(j *job.Job) {
+	s.jobs[j.Id] = j
+	s.pending = append(s.pending, j)
+}
+
+func (s *stubScheduler) Schedule(now uint64) []event.Event {
+	s.schedules++
+	return nil
+}
+
+func (s stubScheduler) Results() map[string]*job.Job {
+	return s.jobs
+}
+
+func (s stubScheduler) Pending() int {
+	return len(s.pending)
+}
+
+func (s *stubScheduler) Withdraw() []*job.Job {
+	if !s.reluctant {
+		return nil
+	}
+	res := s.pending
+	s.pending = nil
+	for _, j := range res {
+		delete(s.jobs, j.Id)
+	}
+	return res
+}
+
+// sequencePolicy selects candidates in a given order, recording the latencies observed
+type sequencePolicy struct {
+	choices   []int
+	latencies []uint64
+}
+
+func (p *sequencePolicy) Select(now uint64, jobs []*job.Job, candidates []Candidate) int {
+	choice := p.choices[0]
+	p.choices = p.choices[1:]
+	return choice
+}
+
+func (p *sequencePolicy) Observe(candidate int, latency uint64) {
+	p.latencies = append(p.latencies, latency)
+}
+
+func TestMetaScheduler(t *testing.T) {
+	first, second := newStub(false), newStub(true)
+	policy := &sequencePolicy{choices: []int{0, 1, 1, 0}}
+	scheduler := NewMeta(policy, Candidate{Name: "first", Scheduler: first}, Candidate{Name: "second", Scheduler: second})
+
+	j1 := &job.Job{Id: "j1", Tasks: []job.Task{{Duration: 10}}}
+	scheduler.Add(j1)
+	scheduler.Schedule(0)
+	if len(first.pending) != 1 || first.schedules != 1 {
+		t.Fatalf("expected first candidate to be given and scheduled j1, found %d jobs and %d schedules", len(first.pending), first.schedules)
+	}
+
+	j2 := &job.Job{Id: "j2", Submission: 10, Tasks: []job.Task{{Duration: 10}}}
+	scheduler.Add(j2)
+	scheduler.Schedule(10)
+	if first.schedules != 2 {
+		t.Errorf("expected first candidate to keep scheduling j1, found %d schedules", first.schedules)
+	}
+	if len(second.pending) != 0 || scheduler.Pending() != 2 {
+		t.Errorf("expected j2 back from the second candidate and 2 jobs pending, found %d given and %d pending", len(second.pending), scheduler.Pending())
+	}
+	if results := scheduler.Results(); len(results) != 2 || results["j2"] != j2 {
+		t.Errorf("expected results with j1 and j2, found %v", results)
+	}
+
+	j1.Conclude(j1.Record(job.DoneTask{Start: 0, Duration: 30}))
+	scheduler.Schedule(20)
+	if len(policy.latencies) != 1 || policy.latencies[0] != 30 {
+		t.Errorf("expected latency 30 of j1 to be observed, found %v", policy.latencies)
+	}
+	scheduler.Schedule(30)
+	expected := []Switch{{Time: 0, To: "first", Jobs: 1}, {Time: 10, From: "first", To: "second", Jobs: 1}, {Time: 30, From: "second", To: "first", Jobs: 1}}
+	switches := scheduler.Switches()
+	if len(switches) != len(expected) {
+		t.Fatalf("expected %d switches, found %v", len(expected), switches)
+	}
+	for i := range expected {
+		if switches[i] != expected[i] {
+			t.Errorf("expected switch %+v, found %+v", expected[i], switches[i])
+		}
+	}
+	if len(first.pending) != 2 {
+		t.Errorf("expected j2 to be given to the first candidate, found %d jobs there", len(first.pending))
+	}
+}
+
+func TestMetaPreempted(t *testing.T) {
+	nw := network.NewSimpleNetwork()
+	topo, err := topology.NewFifo([][2]int{{1, 1}}, [][]uint64{{0}}, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	policy := &sequencePolicy{choices: []int{0}}
+	scheduler := NewMeta(policy, Candidate{Name: "stub", Scheduler: newStub(false)})
+	j := &job.Job{Id: "j", Cpus: 1, Tasks: []job.Task{{Duration: 10}}}
+	scheduler.Add(j)
+	scheduler.Schedule(0)
+	task := newTaskEndEvent(j, j.Tasks[0])
+	task.Process()
+	scheduler.Schedule(5)
+	if len(policy.latencies) != 0 {
+		t.Fatalf("expected no latency observed while the task runs, found %v", policy.latencies)
+	}
+	// the task is preempted before its expected end, and runs again from the beginning
+	task.Preempted(5)
+	task.start = 20
+	task.Process()
+	scheduler.Schedule(25)
+	task.Finished(30, topo.DataCenters[0])
+	scheduler.Schedule(30)
+	if len(policy.latencies) != 1 || policy.latencies[0] != 30 {
+		t.Errorf("expected latency 30 observed once the task ended, found %v", policy.latencies)
+	}
+}
+
+func TestThresholdPolicies(t *testing.T) {
+	candidates := []Candidate{{Name: "a"}, {Name: "b"}}
+	even := []*job.Job{{Tasks: make([]job.Task, 2)}, {Tasks: make([]job.Task, 2)}}
+	uneven := []*job.Job{{Tasks: make([]job.Task, 1)}, {Tasks: make([]job.Task, 5)}}
+	policy := NewTaskCountPolicy(1)
+	if s := policy.Select(0, even, candidates); s != 0 {
+		t.Errorf("expected first candidate for jobs with as many tasks, found %d", s)
+	}
+	if s := policy.Select(0, uneven, candidates); s != 1 {
+		t.Errorf("expected second candidate for jobs with dispersed task counts, found %d", s)
+	}
+	if s := policy.Select(0, even[:1], candidates); s != 1 {
+		t.Errorf("expected second candidate for a single job, found %d", s)
+	}
+	if _, err := NewPolicy("random", topology.Topology{}, 1); err == nil {
+		t.Errorf("expected error for unknown policy, found nil")
+	}
+}
+
+func TestMakespanPolicy(t *testing.T) {
+	nw := network.NewSimpleNetwork()
+	topo, err := topology.NewFifo([][2]int{{1, 1}, {1, 4}}, [][]uint64{{0, 10}, {10, 0}}, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	files, err := file.Load(strings.NewReader("f1 10 0"), topo, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	candidates := []Candidate{{Name: "stub", Scheduler: newStub(false)}, {Name: "SWAG", Scheduler: NewSwag(*topo)}, {Name: "GEODIS", Scheduler: NewGeoDis(*topo)}}
+	j := &job.Job{Id: "j1", Cpus: 1, Tasks: make([]job.Task, 4), File: files["f1"]}
+	for i := range j.Tasks {
+		j.Tasks[i].Duration = 100
+	}
+	// SWAG only uses DC0, which holds the input and runs one task at a time
+	if s := (MakespanPolicy{}).Select(0, []*job.Job{j}, candidates); s != 2 {
+		t.Errorf("expected GEODIS to expect the smallest makespan, found %v", candidates[s].Name)
+	}
+	if len(topo.DataCenters[0].RunningTasks()) != 0 {
+		t.Errorf("expected estimates to leave data centers untouched")
+	}
+}
+
+func TestBanditPolicy(t *testing.T) {
+	candidates := []Candidate{{Name: "a"}, {Name: "b"}}
+	policy := NewBanditPolicy()
+	if first, second := policy.Select(0, nil, candidates), policy.Select(0, nil, candidates); first != 0 || second != 1 {
+		t.Fatalf("expected every candidate to be tried in order, found %d and %d", first, second)
+	}
+	for i := 0; i < 20; i++ {
+		policy.Observe(0, 500)
+		policy.Observe(1, 100)
+	}
+	if s := policy.Select(0, nil, candidates); s != 1 {
+		t.Errorf("expected candidate with the lowest latency, found %d", s)
+	}
+}
@@ -0,0 +1,222 @@
+package scheduler
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/dsfalves/gdsim/job"
+	"github.com/dsfalves/gdsim/topology"
+)
+
+/*
+ThresholdPolicy selects the first candidate while a measure of the pending jobs is below a ratio,
+and the second one otherwise, including when the measure is undefined.
+It learns nothing from the jobs that complete.
+*/
+type ThresholdPolicy struct {
+	measure func(jobs []*job.Job) float64
+	ratio   float64
+}
+
+func (policy ThresholdPolicy) Select(now uint64, jobs []*job.Job, candidates []Candidate) int {
+	if policy.measure(jobs) < policy.ratio || len(candidates) < 2 {
+		return 0
+	}
+	return 1
+}
+
+func (ThresholdPolicy) Observe(candidate int, latency uint64) {}
+
+// Returns the ratio of the variance to the mean of values, NaN for fewer than two jobs.
+func dispersion(jobs []*job.Job, values func(j *job.Job) []float64) float64 {
+	if len(jobs) < 2 {
+		return math.NaN()
+	}
+	// Welford's online algorithm
+	var mean, m2, count float64
+	for _, j := range jobs {
+		for _, v := range values(j) {
+			count++
+			delta := v - mean
+			mean += delta / count
+			m2 += delta * (v - mean)
+		}
+	}
+	return m2 / (count - 1) / mean
+}
+
+// NewTaskCountPolicy selects the second candidate when the variance of the number of tasks of pending jobs reaches ratio times their mean.
+func NewTaskCountPolicy(ratio float64) ThresholdPolicy {
+	return ThresholdPolicy{ratio: ratio, measure: func(jobs []*job.Job) float64 {
+		return dispersion(jobs, func(j *job.Job) []float64 { return []float64{float64(len(j.Tasks))} })
+	}}
+}
+
+// NewDurationPolicy selects the second candidate when the variance of the durations of runnable tasks reaches ratio times their mean.
+func NewDurationPolicy(ratio float64) ThresholdPolicy {
+	return ThresholdPolicy{ratio: ratio, measure: func(jobs []*job.Job) float64 {
+		return dispersion(jobs, func(j *job.Job) []float64 {
+			res := make([]float64, len(j.Tasks))
+			for i, t := range j.Tasks {
+				res[i] = float64(t.Duration)
+			}
+			return res
+		})
+	}}
+}
+
+// Returns the single CPU slots of the data centers of t in total and free.
+func slots(t topology.Topology) (total, available int) {
+	for _, dc := range t.DataCenters {
+		total += dc.JobCapacity(1)
+		available += dc.JobAvailability(1)
+	}
+	return total, available
+}
+
+// NewAvailabilityPolicy selects the second candidate when the fraction of free CPUs in t reaches ratio.
+func NewAvailabilityPolicy(t topology.Topology, ratio float64) ThresholdPolicy {
+	return ThresholdPolicy{ratio: ratio, measure: func(jobs []*job.Job) float64 {
+		total, available := slots(t)
+		return float64(available) / float64(total)
+	}}
+}
+
+// Returns the CPUs required by each task of jobs, summed.
+func required(jobs []*job.Job) (res uint) {
+	for _, j := range jobs {
+		res += j.Cpus
+	}
+	return res
+}
+
+// NewDemandPolicy selects the second candidate when the CPUs required by pending jobs reach ratio times the CPUs of t.
+func NewDemandPolicy(t topology.Topology, ratio float64) ThresholdPolicy {
+	return ThresholdPolicy{ratio: ratio, measure: func(jobs []*job.Job) float64 {
+		total, _ := slots(t)
+		return float64(required(jobs)) / float64(total)
+	}}
+}
+
+// NewLoadPolicy selects the second candidate when the CPUs required by pending jobs reach ratio times the free CPUs of t.
+func NewLoadPolicy(t topology.Topology, ratio float64) ThresholdPolicy {
+	return ThresholdPolicy{ratio: ratio, measure: func(jobs []*job.Job) float64 {
+		_, available := slots(t)
+		return float64(required(jobs)) / float64(available)
+	}}
+}
+
+// Estimator is implemented by schedulers that can tell the makespan they expect for jobs
+type Estimator interface {
+	// Estimate returns the makespan expected for jobs if they were added at time now
+	Estimate(now uint64, jobs []*job.Job) uint64
+}
+
+/*
+MakespanPolicy selects the candidate that expects the smallest makespan for the pending jobs,
+the first one on ties. Candidates that are not Estimators are never selected, unless none is.
+*/
+type MakespanPolicy struct{}
+
+func (MakespanPolicy) Select(now uint64, jobs []*job.Job, candidates []Candidate) int {
+	best, least := 0, uint64(math.MaxUint64)
+	found := false
+	for i, c := range candidates {
+		e, ok := c.Scheduler.(Estimator)
+		if !ok {
+			continue
+		}
+		if makespan := e.Estimate(now, jobs); !found || makespan < least {
+			best, least, found = i, makespan, true
+		}
+	}
+	return best
+}
+
+func (MakespanPolicy) Observe(candidate int, latency uint64) {}
+
+/*
+BanditPolicy learns which candidate gives the lowest job latency, the time between submission and completion,
+with the UCB1 algorithm: it selects the candidate with the lowest mean latency so far, scaled by the highest
+latency seen, minus a bonus that shrinks as it completes more jobs.
+Candidates are first given jobs once each, in order; until a job of any completes, the candidate given jobs
+the fewest times is selected.
+*/
+type BanditPolicy struct {
+	given    []int     // times each candidate was given jobs
+	observed []int     // jobs each candidate completed
+	total    []float64 // latency of the jobs each candidate completed, summed
+	highest  float64
+}
+
+func NewBanditPolicy() *BanditPolicy {
+	return &BanditPolicy{}
+}
+
+// Makes room for n candidates.
+func (policy *BanditPolicy) grow(n int) {
+	for len(policy.given) < n {
+		policy.given = append(policy.given, 0)
+		policy.observed = append(policy.observed, 0)
+		policy.total = append(policy.total, 0)
+	}
+}
+
+func (policy *BanditPolicy) Select(now uint64, jobs []*job.Job, candidates []Candidate) int {
+	policy.grow(len(candidates))
+	best, completed := 0, 0
+	for i := range candidates {
+		completed += policy.observed[i]
+		if policy.given[i] < policy.given[best] {
+			best = i
+		}
+	}
+	if policy.given[best] > 0 && completed > 0 {
+		score := math.Inf(1)
+		for i := range candidates {
+			if policy.observed[i] == 0 {
+				continue
+			}
+			mean := policy.total[i] / float64(policy.observed[i])
+			if policy.highest > 0 {
+				mean /= policy.highest
+			}
+			if s := mean - math.Sqrt(2*math.Log(float64(completed))/float64(policy.observed[i])); s < score {
+				best, score = i, s
+			}
+		}
+	}
+	policy.given[best]++
+	return best
+}
+
+func (policy *BanditPolicy) Observe(candidate int, latency uint64) {
+	policy.grow(candidate + 1)
+	policy.observed[candidate]++
+	policy.total[candidate] += float64(latency)
+	policy.highest = math.Max(policy.highest, float64(latency))
+}
+
+/*
+NewPolicy returns the policy named "tasks", "durations", "availability", "demand" or "load", which are
+threshold policies with the given ratio, "makespan" or "bandit". Threshold policies on CPUs measure those of t.
+*/
+func NewPolicy(name string, t topology.Topology, ratio float64) (Policy, error) {
+	switch name {
+	case "tasks":
+		return NewTaskCountPolicy(ratio), nil
+	case "durations":
+		return NewDurationPolicy(ratio), nil
+	case "availability":
+		return NewAvailabilityPolicy(t, ratio), nil
+	case "demand":
+		return NewDemandPolicy(t, ratio), nil
+	case "load":
+		return NewLoadPolicy(t, ratio), nil
+	case "makespan":
+		return MakespanPolicy{}, nil
+	case "bandit":
+		return NewBanditPolicy(), nil
+	}
+	return nil, fmt.Errorf("unknown selection policy %v", name)
+}
@@ -0,0 +1,80 @@
+package scheduler
+
+import (
+	"math"
+	"sort"
+
+	"github.com/dsfalves/gdsim/file"
+	"github.com/dsfalves/gdsim/job"
+	"github.com/dsfalves/gdsim/topology"
+)
+
+// Charges the job of the task for the CPUs it used in dc from its start until now.
+func (event taskEndEvent) bill(now uint64, dc topology.DataCenter) {
+	p, ok := dc.(topology.Priced)
+	if !ok {
+		return
+	}
+	cost := p.ComputeCost(event.cpus, event.start, now)
+	event.job.ComputeCost += cost
+	stats.Add("compute_cost", cost)
+}
+
+/*
+Returns the egress cost of transferring all files in inputs to the data center with index to in topology t,
+each one from its cheapest copy. Files without copies are ignored.
+*/
+func inputsEgressCost(inputs []file.File, t topology.Topology, to int) float64 {
+	var res float64
+	for _, f := range inputs {
+		best := math.Inf(1)
+		for from, dc := range t.DataCenters {
+			if dc.Container().Has(f.Id()) {
+				best = math.Min(best, t.EgressCost(f.Size(), from, to))
+			}
+		}
+		if !math.IsInf(best, 1) {
+			res += best
+		}
+	}
+	return res
+}
+
+/*
+Returns a variant of fullBestDcs that trades transfer time against dollars, penalizing each data center
+by weight seconds for each dollar a task of j is expected to cost there: the egress of its inputs from
+their cheapest copies, and its CPUs for the mean duration of the tasks of j at the mean daily price.
+*/
+func pricedBestDcs(weight float64) func(job.Job, []file.File, topology.Topology) []transferCenter {
+	return func(j job.Job, inputs []file.File, t topology.Topology) []transferCenter {
+		res := fullBestDcs(j, inputs, t)
+		var duration float64
+		if len(j.Tasks) > 0 {
+			duration = float64(rpt(j)) / float64(len(j.Tasks))
+		}
+		for i := range res {
+			var cost float64
+			for k, dc := range t.DataCenters {
+				if dc == res[i].dataCenter {
+					cost = inputsEgressCost(inputs, t, k)
+				}
+			}
+			if p, ok := res[i].dataCenter.(topology.Priced); ok {
+				cost += p.ComputeCost(int(j.Cpus), 0, topology.Day) * duration / topology.Day
+			}
+			res[i].penalty = uint64(weight * cost)
+		}
+		sort.SliceStable(res, func(i, k int) bool {
+			return res[i].transferTime+res[i].penalty < res[k].transferTime+res[k].penalty
+		})
+		return res
+	}
+}
+
+/*
+NewCostGeoDis creates a GEODIS scheduler that also weighs the dollars a task is expected to cost
+in each data center, valuing each dollar as weight seconds of completion time.
+*/
+func NewCostGeoDis(t topology.Topology, weight float64) *MakespanScheduler {
+	return NewMakespanScheduler(t, pricedBestDcs(weight))
+}
@@ -0,0 +1,66 @@
+package scheduler
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/dsfalves/gdsim/file"
+	"github.com/dsfalves/gdsim/job"
+	"github.com/dsfalves/gdsim/network"
+	"github.com/dsfalves/gdsim/topology"
+)
+
+func TestCostGeoDis(t *testing.T) {
+	cap := [][2]int{
+		{1, 1},
+		{1, 1},
+	}
+	speeds := [][]uint64{
+		{0, 10},
+		{10, 0},
+	}
+	setup := func() (*topology.Topology, map[string]file.File) {
+		nw := network.NewSimpleNetwork()
+		topo, err := topology.NewFifo(cap, speeds, &nw)
+		if err != nil {
+			t.Fatalf("failure to setup test: %v", err)
+		}
+		topo.DataCenters[0].(*topology.FifoDataCenter).SetPrices([]float64{10})
+		files, err := file.Load(strings.NewReader("f1 100 0"), topo, &nw)
+		if err != nil {
+			t.Fatalf("failure to setup test: %v", err)
+		}
+		return topo, files
+	}
+	tests := []struct {
+		name     string
+		create   func(topology.Topology) Scheduler
+		expected string
+		cost     float64
+	}{
+		{"GEODIS", func(t topology.Topology) Scheduler { return NewGeoDis(t) }, "DC0", 10},
+		{"GEODIS-COST", func(t topology.Topology) Scheduler { return NewCostGeoDis(t, 3600) }, "DC1", 0},
+	}
+	for _, test := range tests {
+		topo, files := setup()
+		j := job.Job{Id: "j", Cpus: 1, Tasks: []job.Task{{Duration: 3600}}, File: files["f1"]}
+		scheduler := test.create(*topo)
+		scheduler.Add(&j)
+		scheduler.Schedule(0)
+		var task *taskEndEvent
+		var where topology.DataCenter
+		for _, dc := range topo.DataCenters {
+			for _, rt := range dc.RunningTasks() {
+				task, where = rt.(*taskEndEvent), dc
+			}
+		}
+		if task == nil || where.Id() != test.expected {
+			t.Fatalf("expected %s to run the task in %s, found %v", test.name, test.expected, where)
+		}
+		task.Finished(task.End(), where)
+		if math.Abs(task.job.ComputeCost-test.cost) > 1e-9 {
+			t.Errorf("expected %s to charge %v for the task, found %v", test.name, test.cost, task.job.ComputeCost)
+		}
+	}
+}
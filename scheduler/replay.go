@@ -0,0 +1,273 @@
+package scheduler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/dsfalves/gdsim/file"
+	"github.com/dsfalves/gdsim/job"
+	"github.com/dsfalves/gdsim/scheduler/event"
+	"github.com/dsfalves/gdsim/topology"
+)
+
+// Placement is where and from when a task runs according to a plan
+type Placement struct {
+	DataCenter string
+	NotBefore  uint64 // earliest time the task may be dispatched
+}
+
+/*
+Plan holds the placement of tasks, by job id and then by task. Tasks outside stages are numbered from 0
+in the order of the job trace, and tasks of a stage as "<stage id>:<number>", also from 0.
+*/
+type Plan map[string]map[string]Placement
+
+/*
+LoadPlan reads a plan from reader, one task per line, as the job id, the task, the data center id and
+optionally the earliest time the task may be dispatched, e.g. "job1 0 DC2" or "job1 reduce:3 DC0 3600".
+*/
+func LoadPlan(reader io.Reader) (Plan, error) {
+	res := make(Plan)
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 {
+			continue
+		}
+		if len(words) < 3 || len(words) > 4 {
+			return nil, fmt.Errorf("failure to read placement %d: expected 3 or 4 fields, found %d", line, len(words))
+		}
+		p := Placement{DataCenter: words[2]}
+		if len(words) == 4 {
+			var err error
+			if p.NotBefore, err = strconv.ParseUint(words[3], 10, 64); err != nil {
+				return nil, fmt.Errorf("failure to read placement %d: %v", line, err)
+			}
+		}
+		if res[words[0]] == nil {
+			res[words[0]] = make(map[string]Placement)
+		}
+		res[words[0]][words[1]] = p
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Deviation is a task whose run departed from the plan
+type Deviation struct {
+	Job, Task  string
+	DataCenter string
+	Reason     string // why the plan could not be followed, or "delayed"
+	Delay      uint64 // time the task started after its planned start
+}
+
+/*
+ReplayScheduler dispatches the tasks of each job to the data centers given by a plan, as soon as they are
+runnable and their earliest dispatch time has come, in order of submission. Tasks wait in the queue of
+their data center if it is full. Jobs with a task the plan does not place, or places where it cannot run,
+are left out of the simulation; every task of a job is checked when it is added, including those of later
+stages, and every runnable task before any is dispatched, so such jobs run as few tasks as possible.
+Tasks that start after their planned start, which is their earliest dispatch time, or when they were
+dispatched if none was given, plus the time to transfer their inputs, are reported along with the tasks
+the plan failed.
+*/
+type ReplayScheduler struct {
+	topology   topology.Topology
+	plan       Plan
+	index      map[string]int // index in the topology of each data center, by id
+	jobs       map[string]*job.Job
+	pending    []*job.Job                  // jobs with tasks to be dispatched, in order of submission
+	waiting    []*job.Job                  // jobs without runnable tasks whose later stages are not runnable yet
+	keys       map[*job.Job][]string       // key in the plan of each task of a job, in the order of its tasks
+	seen       map[*job.Job]map[string]int // number of tasks of each stage of a job seen so far
+	deviations []Deviation
+}
+
+func NewReplay(t topology.Topology, plan Plan) *ReplayScheduler {
+	index := make(map[string]int)
+	for i, dc := range t.DataCenters {
+		index[dc.Id()] = i
+	}
+	return &ReplayScheduler{
+		topology: t,
+		plan:     plan,
+		index:    index,
+		jobs:     make(map[string]*job.Job),
+		keys:     make(map[*job.Job][]string),
+		seen:     make(map[*job.Job]map[string]int),
+	}
+}
+
+func (scheduler *ReplayScheduler) Add(j *job.Job) {
+	logger.Debugf("%p.Add(%p)", scheduler, j)
+	scheduler.jobs[j.Id] = j
+	scheduler.seen[j] = make(map[string]int)
+	tasks := append([]job.Task{}, j.Tasks...)
+	for _, s := range j.Stages {
+		tasks = append(tasks, s.Tasks...)
+	}
+	for k, key := range planKeys(tasks, make(map[string]int)) {
+		if placement, _, reason := scheduler.check(j, key, tasks[k]); reason != "" {
+			scheduler.fail(j, key, placement, reason)
+			stats.Count("replay_dropped_jobs")
+			return
+		}
+	}
+	scheduler.pending = append(scheduler.pending, j)
+}
+
+func (scheduler ReplayScheduler) Pending() int {
+	return len(scheduler.pending) + len(scheduler.waiting)
+}
+
+// Returns the keys in the plan of tasks, numbering the tasks of each stage after those in seen, which is updated.
+func planKeys(tasks []job.Task, seen map[string]int) []string {
+	keys := make([]string, len(tasks))
+	for k, task := range tasks {
+		n := seen[task.Stage]
+		seen[task.Stage]++
+		keys[k] = strconv.Itoa(n)
+		if task.Stage != "" {
+			keys[k] = fmt.Sprintf("%s:%d", task.Stage, n)
+		}
+	}
+	return keys
+}
+
+// Gives keys in the plan to the tasks of j that became runnable since it was last seen.
+func (scheduler *ReplayScheduler) number(j *job.Job) {
+	keys := scheduler.keys[j]
+	scheduler.keys[j] = append(keys, planKeys(j.Tasks[len(keys):], scheduler.seen[j])...)
+}
+
+/*
+Returns the placement of task key of j in the plan and the index of its data center,
+along with why the task cannot run there, or "" if it can.
+*/
+func (scheduler *ReplayScheduler) check(j *job.Job, key string, task job.Task) (Placement, int, string) {
+	placement, planned := scheduler.plan[j.Id][key]
+	i, found := scheduler.index[placement.DataCenter]
+	switch {
+	case !planned:
+		return placement, i, "not in plan"
+	case !found:
+		return placement, i, "unknown data center"
+	case !permitted(*j, j.TaskInputs(task), scheduler.topology.DataCenters[i]):
+		return placement, i, "not permitted"
+	}
+	return placement, i, ""
+}
+
+// Records that the plan for task key of j failed for reason.
+func (scheduler *ReplayScheduler) fail(j *job.Job, key string, placement Placement, reason string) {
+	logger.Warnf("plan for task %s of job %s cannot be followed: %s", key, j.Id, reason)
+	stats.Count("replay_infeasible_tasks")
+	scheduler.deviations = append(scheduler.deviations, Deviation{Job: j.Id, Task: key, DataCenter: placement.DataCenter, Reason: reason})
+}
+
+/*
+Dispatches the runnable tasks of j that the plan allows at time now, returning the events of nodes that
+start running them and whether the plan can still be followed for j. Tasks are only dispatched if the
+plan can be followed for all of them.
+*/
+func (scheduler *ReplayScheduler) dispatch(now uint64, j *job.Job) ([]event.Event, bool) {
+	type ready struct {
+		taskEnd   *taskEndEvent
+		dc        topology.DataCenter
+		inputs    []file.File
+		key       string
+		placement Placement
+	}
+	scheduler.number(j)
+	keys := scheduler.keys[j]
+	tasks, left := j.Tasks[:0:0], keys[:0:0]
+	dispatched := make([]ready, 0)
+	for k, task := range j.Tasks {
+		key := keys[k]
+		placement, i, reason := scheduler.check(j, key, task)
+		if reason != "" {
+			scheduler.fail(j, key, placement, reason)
+			return nil, false
+		}
+		if now < placement.NotBefore {
+			tasks, left = append(tasks, task), append(left, key)
+			continue
+		}
+		dc := scheduler.topology.DataCenters[i]
+		inputs := j.TaskInputs(task)
+		taskEnd := newTaskEndEvent(j, task)
+		// whether dc accepts a task does not depend on the tasks hosted before it, so none is refused below
+		if !dc.Accepts(taskEnd) {
+			scheduler.fail(j, key, placement, "no capacity")
+			return nil, false
+		}
+		transfer := inputsTransferTime(inputs, scheduler.topology, i)
+		taskEnd.start = transfer + now
+		// the transfer of inputs to the planned data center is part of the plan
+		plannedStart := placement.NotBefore + transfer
+		if placement.NotBefore == 0 {
+			plannedStart = now + transfer
+		}
+		id, where := j.Id, placement.DataCenter
+		taskEnd.started = func(start uint64) {
+			if start > plannedStart {
+				stats.Add("replay_delay", float64(start-plannedStart))
+				scheduler.deviations = append(scheduler.deviations, Deviation{Job: id, Task: key, DataCenter: where, Reason: "delayed", Delay: start - plannedStart})
+			}
+		}
+		dispatched = append(dispatched, ready{taskEnd: taskEnd, dc: dc, inputs: inputs, key: key, placement: placement})
+	}
+	events := make([]event.Event, 0)
+	for _, r := range dispatched {
+		node, success := r.dc.Host(r.taskEnd)
+		if !success {
+			scheduler.fail(j, r.key, r.placement, "no capacity")
+			return events, false
+		}
+		access(r.dc, r.inputs, now)
+		if node != nil {
+			r.taskEnd.where = node.Location
+			if node.QueueLen() == 1 {
+				events = append(events, node)
+			}
+		} else {
+			stats.Count("replay_queued_tasks")
+		}
+	}
+	j.Tasks, scheduler.keys[j] = tasks, left
+	return events, true
+}
+
+func (scheduler *ReplayScheduler) Schedule(now uint64) []event.Event {
+	logger.Debugf("%p.Schedule(%v)", scheduler, now)
+	scheduler.pending = append(scheduler.pending, released(&scheduler.waiting)...)
+	events := make([]event.Event, 0)
+	left := scheduler.pending[:0]
+	for _, j := range scheduler.pending {
+		dispatched, feasible := scheduler.dispatch(now, j)
+		events = append(events, dispatched...)
+		if !feasible {
+			stats.Count("replay_dropped_jobs")
+		} else if len(j.Tasks) > 0 {
+			left = append(left, j)
+		} else if j.Waiting() {
+			scheduler.waiting = append(scheduler.waiting, j)
+		}
+	}
+	scheduler.pending = left
+	return events
+}
+
+func (scheduler ReplayScheduler) Results() map[string]*job.Job {
+	return scheduler.jobs
+}
+
+// Deviations returns the tasks whose run departed from the plan so far, in the order they did.
+func (scheduler ReplayScheduler) Deviations() []Deviation {
+	return scheduler.deviations
+}
@@ -0,0 +1,168 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dsfalves/gdsim/file"
+	"github.com/dsfalves/gdsim/job"
+	"github.com/dsfalves/gdsim/network"
+	"github.com/dsfalves/gdsim/topology"
+)
+
+func TestLoadPlan(t *testing.T) {
+	sample := "j1 0 DC1\n\nj1 reduce:2 DC0 3600\n"
+	plan, err := LoadPlan(strings.NewReader(sample))
+	if err != nil {
+		t.Fatalf("error '%v' while loading plan '%v', expected nil", err, sample)
+	}
+	if p := plan["j1"]["0"]; p.DataCenter != "DC1" || p.NotBefore != 0 {
+		t.Errorf("expected task 0 of j1 in DC1, found %+v", p)
+	}
+	if p := plan["j1"]["reduce:2"]; p.DataCenter != "DC0" || p.NotBefore != 3600 {
+		t.Errorf("expected task reduce:2 of j1 in DC0 from 3600, found %+v", p)
+	}
+	for _, bad := range []string{"j1 0\n", "j1 0 DC0 10 20\n", "j1 0 DC0 soon\n"} {
+		if _, err := LoadPlan(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected error for plan '%v', found nil", bad)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	cap := [][2]int{
+		{1, 1},
+		{1, 1},
+	}
+	speeds := [][]uint64{
+		{0, 10},
+		{10, 0},
+	}
+	nw := network.NewSimpleNetwork()
+	topo, err := topology.NewFifo(cap, speeds, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	plan, err := LoadPlan(strings.NewReader("j1 0 DC1\nj1 1 DC1 50\nj3 0 DC9\n"))
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	j1 := job.Job{Id: "j1", Cpus: 1, Tasks: []job.Task{{Duration: 100}, {Duration: 20}}}
+	j2 := job.Job{Id: "j2", Cpus: 1, Tasks: []job.Task{{Duration: 10}}}
+	j3 := job.Job{Id: "j3", Cpus: 1, Tasks: []job.Task{{Duration: 10}}}
+	scheduler := NewReplay(*topo, plan)
+	scheduler.Add(&j1)
+	scheduler.Add(&j2)
+	scheduler.Add(&j3)
+	events := scheduler.Schedule(0)
+	if len(events) != 1 || len(topo.DataCenters[1].RunningTasks()) != 1 {
+		t.Fatalf("expected task 0 of j1 to run in DC1, found %d events", len(events))
+	}
+	if scheduler.Pending() != 1 || len(j1.Tasks) != 1 {
+		t.Fatalf("expected task 1 of j1 to wait until 50, found %d pending jobs", scheduler.Pending())
+	}
+	deviations := scheduler.Deviations()
+	if len(deviations) != 2 || deviations[0].Reason != "not in plan" || deviations[1].Reason != "unknown data center" {
+		t.Errorf("expected j2 and j3 to be reported, found %+v", deviations)
+	}
+
+	if more := scheduler.Schedule(50); len(more) != 0 || scheduler.Pending() != 0 {
+		t.Fatalf("expected task 1 of j1 to wait in the queue of DC1, found %d events and %d pending jobs", len(more), scheduler.Pending())
+	}
+	events[0].Process()
+	deviations = scheduler.Deviations()
+	if d := deviations[len(deviations)-1]; d.Job != "j1" || d.Task != "1" || d.Reason != "delayed" || d.Delay != 50 {
+		t.Errorf("expected task 1 of j1 to start 50 after its planned start, found %+v", d)
+	}
+}
+
+func TestReplayWholeJob(t *testing.T) {
+	nw := network.NewSimpleNetwork()
+	topo, err := topology.NewFifo([][2]int{{1, 4}, {1, 1}}, [][]uint64{{0, 10}, {10, 0}}, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	plan, err := LoadPlan(strings.NewReader("j1 a:0 DC0\nj2 0 DC0\nj2 1 DC1\n"))
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	// the task of stage b of j1 is not in the plan, and j2 needs 2 CPUs in DC1, which has 1
+	j1 := job.Job{Id: "j1", Cpus: 1, Tasks: []job.Task{{Duration: 10, Stage: "a"}}, Stages: []job.Stage{
+		{Id: "a"},
+		{Id: "b", Parents: []string{"a"}, Tasks: []job.Task{{Duration: 10, Stage: "b"}}},
+	}}
+	j2 := job.Job{Id: "j2", Cpus: 2, Tasks: []job.Task{{Duration: 10}, {Duration: 10}}}
+	scheduler := NewReplay(*topo, plan)
+	scheduler.Add(&j1)
+	scheduler.Add(&j2)
+	if events := scheduler.Schedule(0); len(events) != 0 || len(topo.DataCenters[0].RunningTasks()) != 0 {
+		t.Fatalf("expected no task to run, found %d events", len(events))
+	}
+	if scheduler.Pending() != 0 {
+		t.Errorf("expected both jobs to be dropped, found %d pending jobs", scheduler.Pending())
+	}
+	deviations := scheduler.Deviations()
+	if len(deviations) != 2 || deviations[0].Task != "b:0" || deviations[0].Reason != "not in plan" || deviations[1].Task != "1" || deviations[1].Reason != "no capacity" {
+		t.Errorf("expected task b:0 of j1 and task 1 of j2 to be reported, found %+v", deviations)
+	}
+}
+
+func TestReplayRestoring(t *testing.T) {
+	nw := network.NewSimpleNetwork()
+	topo, err := topology.NewFifo([][2]int{{1, 4}, {1, 1}}, [][]uint64{{0, 10}, {10, 0}}, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	changes, _, err := topology.LoadCapacity(strings.NewReader("0 DC1 drain 1\n50 DC1 add 1 1\n"), topo)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	changes[0].Process()
+	plan, err := LoadPlan(strings.NewReader("j1 0 DC0\nj1 1 DC1\n"))
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	// DC1 expects nodes, but none with the 2 CPUs the tasks of j1 need
+	j1 := job.Job{Id: "j1", Cpus: 2, Tasks: []job.Task{{Duration: 10}, {Duration: 10}}}
+	scheduler := NewReplay(*topo, plan)
+	scheduler.Add(&j1)
+	if events := scheduler.Schedule(0); len(events) != 0 || len(topo.DataCenters[0].RunningTasks()) != 0 {
+		t.Fatalf("expected no task of j1 to run, found %d events", len(events))
+	}
+	if deviations := scheduler.Deviations(); scheduler.Pending() != 0 || len(deviations) != 1 || deviations[0].Reason != "no capacity" {
+		t.Errorf("expected j1 to be dropped for lack of capacity, found %d pending jobs and %+v", scheduler.Pending(), deviations)
+	}
+}
+
+func TestReplayTransfer(t *testing.T) {
+	nw := network.NewSimpleNetwork()
+	topo, err := topology.NewFifo([][2]int{{1, 1}, {1, 1}}, [][]uint64{{0, 10}, {10, 0}}, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	files, err := file.Load(strings.NewReader("f1 100 0"), topo, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	plan, err := LoadPlan(strings.NewReader("j1 0 DC1\nj1 1 DC1 20\n"))
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	j1 := job.Job{Id: "j1", Cpus: 1, Tasks: []job.Task{{Duration: 100}, {Duration: 10}}, File: files["f1"]}
+	scheduler := NewReplay(*topo, plan)
+	scheduler.Add(&j1)
+	events := scheduler.Schedule(0)
+	if len(events) != 1 || events[0].Time() != 110 {
+		t.Fatalf("expected task 0 of j1 to end at 110 after its input arrives, found %v", events)
+	}
+	if len(scheduler.Deviations()) != 0 {
+		t.Errorf("expected the transfer of the input not to count as a delay, found %+v", scheduler.Deviations())
+	}
+	// task 1 is dispatched at 20 and could start at 30, but waits for task 0 to end at 110
+	scheduler.Schedule(20)
+	events[0].Process()
+	deviations := scheduler.Deviations()
+	if len(deviations) != 1 || deviations[0].Task != "1" || deviations[0].Delay != 80 {
+		t.Errorf("expected task 1 of j1 to start 80 after its planned start, found %+v", deviations)
+	}
+}
@@ -2,19 +2,23 @@ package scheduler
 
 import (
 	"fmt"
+	"math"
 	"sort"
 
 	"github.com/dsfalves/gdsim/file"
 	"github.com/dsfalves/gdsim/job"
 	"github.com/dsfalves/gdsim/log"
+	"github.com/dsfalves/gdsim/metrics"
 	"github.com/dsfalves/gdsim/scheduler/event"
 	"github.com/dsfalves/gdsim/topology"
 )
 
 var logger log.Context
+var stats metrics.Context
 
 func init() {
 	logger = log.New("scheduler")
+	stats = metrics.New("scheduler")
 }
 
 type jobHeap []*job.Job
@@ -56,37 +60,151 @@ func transferTime(size uint64, t topology.Topology, from, to int) uint64 {
 	return size / t.Speeds[from][to]
 }
 
+// demand returns the resources required by each task of j
+func demand(j job.Job) topology.Resources {
+	return topology.Resources{
+		Cpus:   int(j.Cpus),
+		Memory: int(j.Memory),
+	}
+}
+
+// Records in the storage of dc that a task requiring inputs was hosted there at time now.
+func access(dc topology.DataCenter, inputs []file.File, now uint64) {
+	if fc, ok := dc.Container().(*file.FileContainer); ok {
+		for _, f := range inputs {
+			fc.Access(now, f.Id())
+		}
+	}
+}
+
 type transferCenter struct {
 	transferTime           uint64
+	penalty                uint64 /* added to the transfer time when comparing data centers */
 	freeJobSlots, capacity int
 	dataCenter             topology.DataCenter
 }
 
 /*
-Returns a list of data centers suitable for running a job that requires file f,
-sorted by transfer time in topology t and with capacity according to cost.
+Returns the time to transfer all files in inputs to the data center with index to in topology t,
+each one from its nearest copy. Files are transferred in parallel, and files without copies are ignored.
 */
-func fullBestDcs(f file.File, t topology.Topology, cost int) []transferCenter {
-	res := make([]transferCenter, len(t.DataCenters))
-	locations := make([]int, 0, len(t.DataCenters))
-	for i, dc := range t.DataCenters {
-		if dc.Container().Has(f.Id()) {
-			locations = append(locations, i)
+func inputsTransferTime(inputs []file.File, t topology.Topology, to int) uint64 {
+	var res uint64
+	for _, f := range inputs {
+		best := uint64(math.MaxUint64)
+		for from, dc := range t.DataCenters {
+			if !dc.Container().Has(f.Id()) {
+				continue
+			}
+			if transfer := transferTime(f.Size(), t, from, to); transfer < best {
+				best = transfer
+			}
+		}
+		if best != math.MaxUint64 && best > res {
+			res = best
 		}
 	}
+	return res
+}
 
-	for i := range t.DataCenters {
-		res[i].dataCenter = t.DataCenters[i]
-		res[i].transferTime = transferTime(f.Size(), t, locations[0], i)
-		res[i].capacity = t.DataCenters[i].JobCapacity(cost)
-		res[i].freeJobSlots = t.DataCenters[i].JobAvailability(cost)
-		for k := 1; k < len(locations); k++ {
-			from := locations[k]
-			if transfer := transferTime(f.Size(), t, from, i); transfer < res[i].transferTime {
-				res[i].transferTime = transfer
-			}
+/*
+Returns whether tasks of j reading inputs may run in dc, according to the data centers allowed and
+forbidden for j and the data centers where inputs must not be stored. Anti-affinity is not considered.
+*/
+func permitted(j job.Job, inputs []file.File, dc topology.DataCenter) bool {
+	if !j.Permits(dc.Id()) {
+		return false
+	}
+	fc, ok := dc.Container().(*file.FileContainer)
+	if !ok {
+		return true
+	}
+	for _, f := range inputs {
+		if !fc.Has(f.Id()) && !fc.Permits(f.Id()) {
+			return false
 		}
 	}
+	return true
+}
+
+/*
+Returns whether dc is running or queueing tasks of a job that j must not share a data center with,
+or of a job that must not share a data center with j.
+*/
+func conflicts(j job.Job, dc topology.DataCenter) bool {
+	for _, rt := range append(dc.RunningTasks(), dc.QueuedTasks()...) {
+		task, ok := rt.(*taskEndEvent)
+		if ok && task.job.Id != j.Id && (j.Avoids(task.job.Id) || task.job.Avoids(j.Id)) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Returns whether a task of j that cannot be hosted in any of dcs never will, as none of them has capacity
+for it or expects nodes to be added, and no data center in t is running tasks in conflict with j.
+*/
+func unschedulable(j job.Job, dcs []transferCenter, t topology.Topology) bool {
+	for _, dc := range dcs {
+		if dc.capacity > 0 || restoring(dc.dataCenter) {
+			return false
+		}
+	}
+	return !inConflict(j, t)
+}
+
+// Returns whether dc has no nodes in service but expects new ones.
+func restoring(dc topology.DataCenter) bool {
+	r, ok := dc.(topology.Restorer)
+	return ok && r.Restoring()
+}
+
+// Returns whether some data center where tasks of j may run expects nodes to be added.
+func awaitsNodes(j job.Job, t topology.Topology) bool {
+	for _, dc := range fullBestDcs(j, j.TaskInputs(job.Task{}), t) {
+		if restoring(dc.dataCenter) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns whether some data center in t is running or queueing tasks in conflict with j.
+func inConflict(j job.Job, t topology.Topology) bool {
+	for _, dc := range t.DataCenters {
+		if conflicts(j, dc) {
+			return true
+		}
+	}
+	return false
+}
+
+// Records that j cannot be scheduled on any data center, so it is left out of the simulation.
+func reportUnschedulable(j *job.Job) {
+	logger.Warnf("job %s cannot be scheduled on any data center", j.Id)
+	stats.Count("unschedulable_jobs")
+}
+
+/*
+Returns a list of data centers suitable for running a task of j that requires files inputs,
+sorted by transfer time in topology t and with capacity according to the demand of j.
+Data centers where the constraints of j or inputs do not allow the task to run are left out.
+*/
+func fullBestDcs(j job.Job, inputs []file.File, t topology.Topology) []transferCenter {
+	cost := demand(j)
+	res := make([]transferCenter, 0, len(t.DataCenters))
+	for i, dc := range t.DataCenters {
+		if !permitted(j, inputs, dc) || conflicts(j, dc) {
+			continue
+		}
+		res = append(res, transferCenter{
+			dataCenter:   dc,
+			transferTime: inputsTransferTime(inputs, t, i),
+			capacity:     dc.Capacity(cost),
+			freeJobSlots: dc.Availability(cost),
+		})
+	}
 	sort.Slice(res, func(i, k int) bool { return res[i].transferTime < res[k].transferTime })
 	return res
 }
@@ -95,6 +213,7 @@ type transferFileEvent struct {
 	f     file.File
 	where topology.DataCenter
 	when  uint64
+	job   *job.Job // job whose task reads f, charged for the transfer
 }
 
 func (event transferFileEvent) Time() uint64 {
@@ -102,26 +221,130 @@ func (event transferFileEvent) Time() uint64 {
 }
 
 func (tfe transferFileEvent) Process() []event.Event {
-	return tfe.where.Container().Transfer(tfe.when, tfe.f.Id(), tfe.f,
+	var cost float64
+	if fc, ok := tfe.where.Container().(*file.FileContainer); ok {
+		cost = fc.TransferCost(tfe.f)
+	}
+	events, err := tfe.where.Container().Transfer(tfe.when, tfe.f.Id(), tfe.f,
 		func(time uint64) []event.Event { return nil })
+	if err != nil {
+		logger.Warnf("transfer of %s to %s failed: %v", tfe.f.Id(), tfe.where.Id(), err)
+		stats.Count("transfer_failures")
+	} else if tfe.job != nil {
+		tfe.job.EgressCost += cost
+	}
+	return events
+}
+
+// PreemptionMode defines what happens to the work done by a task when it is preempted
+type PreemptionMode int
+
+const (
+	// NoPreemption means running tasks are never preempted
+	NoPreemption PreemptionMode = iota
+	// KillRestart discards the work done, and the task restarts from the beginning
+	KillRestart
+	// SuspendResume keeps the work done, and the task resumes with its remaining duration
+	SuspendResume
+)
+
+// ParsePreemptionMode returns the preemption mode named "none", "kill" or "suspend".
+func ParsePreemptionMode(name string) (PreemptionMode, error) {
+	switch name {
+	case "none":
+		return NoPreemption, nil
+	case "kill":
+		return KillRestart, nil
+	case "suspend":
+		return SuspendResume, nil
+	}
+	return NoPreemption, fmt.Errorf("unknown preemption mode %v", name)
 }
 
 type taskEndEvent struct {
 	start, duration uint64
 	cpus            int
+	minCpus         int
+	memory          int
 	where           int
 	job             *job.Job
+	partitions      []file.File
+	stage           string
 	transferTime    uint64
+	speed           float64
+	preemption      PreemptionMode
+	started         func(start uint64) // called when the task starts running, if not nil
+	run             int                // id of the execution of the task in the results of its job
+}
+
+// newTaskEndEvent creates the event for the end of task of j.
+func newTaskEndEvent(j *job.Job, task job.Task) *taskEndEvent {
+	return &taskEndEvent{
+		duration:   task.Duration,
+		cpus:       int(j.Cpus),
+		minCpus:    int(j.MinCpus),
+		memory:     int(j.Memory),
+		job:        j,
+		partitions: task.Partitions,
+		stage:      task.Stage,
+	}
+}
+
+// Returns the work left of the task, as a task of its job.
+func (event taskEndEvent) task() job.Task {
+	return job.Task{Duration: event.duration, Partitions: event.partitions, Stage: event.stage}
+}
+
+/*
+Returns the rate at which the task does its work on the node hosting it, relative to
+running with all requested CPUs on a reference computer.
+*/
+func (event taskEndEvent) rate() float64 {
+	speed := event.speed
+	if speed <= 0 {
+		speed = 1
+	}
+	return speed / event.job.Stretch(uint(event.cpus))
+}
+
+/*
+Returns how long the task takes to run on the node hosting it,
+which is its duration scaled by the relative speed of the node
+and by the number of CPUs it is running with.
+*/
+func (event taskEndEvent) runTime() uint64 {
+	if rate := event.rate(); rate != 1 {
+		return uint64(math.Ceil(float64(event.duration) / rate))
+	}
+	return event.duration
 }
 
 func (event taskEndEvent) End() uint64 {
-	return event.start + event.duration
+	return event.start + event.runTime()
 }
 
 func (event taskEndEvent) Cpus() int {
 	return event.cpus
 }
 
+func (event taskEndEvent) Memory() int {
+	return event.memory
+}
+
+func (event taskEndEvent) MinCpus() int {
+	if event.minCpus == 0 {
+		return event.cpus
+	}
+	return event.minCpus
+}
+
+func (event *taskEndEvent) Resize(cpus int) {
+	stats.Count("malleable_reduced_tasks")
+	stats.Add("malleable_slowdown", event.job.Stretch(uint(cpus)))
+	logger.Infof("task of job %v resized from %d to %d CPUs", event.job.Id, event.cpus, cpus)
+	event.cpus = cpus
+}
+
 func (event *taskEndEvent) SetStart(start uint64) {
 	event.start = start + event.transferTime
 }
@@ -130,17 +353,114 @@ func (event *taskEndEvent) SetWhere(where int) {
 	event.where = where
 }
 
-func (event taskEndEvent) Process() []event.Event {
+func (event *taskEndEvent) SetSpeed(speed float64) {
+	event.speed = speed
+}
+
+/*
+Updates the remaining duration of a preempted task according to its preemption mode,
+and removes its execution from the results of its job.
+Its inputs stay where it ran, so if it runs there again it only waits for those still being transferred.
+*/
+func (event *taskEndEvent) Preempted(now uint64) {
+	var elapsed uint64
+	if now > event.start {
+		elapsed = now - event.start
+		event.transferTime = 0
+	} else {
+		event.transferTime = event.start - now
+	}
+	done := uint64(float64(elapsed) * event.rate())
+	if done > event.duration {
+		done = event.duration
+	}
+	event.job.Unrecord(event.run)
+	stats.Count("preemptions")
+	if event.preemption == SuspendResume {
+		event.duration -= done
+		stats.Add("preempted_work_kept", float64(done))
+	} else {
+		stats.Add("preempted_work_lost", float64(done))
+	}
+	logger.Infof("task of job %v preempted at %d after %d units of work", event.job.Id, now, done)
+}
+
+func (event *taskEndEvent) Process() []event.Event {
 	logger.Debugf("%v.Process()", event)
-	event.job.Scheduled = append(event.job.Scheduled, job.DoneTask{
+	event.run = event.job.Record(job.DoneTask{
 		Start:    event.start,
-		Duration: event.duration,
+		Duration: event.runTime(),
 		Location: fmt.Sprintf("DC%v", event.where),
 	})
 	logger.Infof("added event to Scheduled - len(Scheduled) = %v\n", len(event.job.Scheduled))
+	if event.started != nil {
+		event.started(event.start)
+	}
 	return nil
 }
 
+/*
+Stores the output of the task in dc when it ends at time now, shipping it to the origin of its job
+if needed. The task only counts as done for its job after its output arrives at the origin.
+Tasks of stages that other stages depend on store instead the partitions of their output read by
+the tasks of those stages.
+*/
+func (task *taskEndEvent) Finished(now uint64, dc topology.DataCenter) []event.Event {
+	j := task.job
+	task.bill(now, dc)
+	for _, p := range j.Finish(task.task()) {
+		dc.Container().Add(p.Id(), p)
+		stats.Add("shuffle_bytes", float64(p.Size()))
+	}
+	if j.Output == 0 || !j.Final(task.task()) {
+		j.Conclude(task.run)
+		return nil
+	}
+	output := file.New(fmt.Sprintf("%s.out%d", j.Id, len(j.Outputs)), j.Output)
+	j.Outputs = append(j.Outputs, output)
+	dc.Container().Add(output.Id(), output)
+	if !j.Ships() || j.Origin == dc.Id() {
+		j.Conclude(task.run)
+		return nil
+	}
+	fc, ok := dc.Container().(*file.FileContainer)
+	if !ok {
+		j.Conclude(task.run)
+		return nil
+	}
+	events, err := fc.Ship(now, output, j.Origin, func(time uint64) []event.Event {
+		j.Deliver(task.run, time)
+		j.Conclude(task.run)
+		stats.Add("result_shipping_time", float64(time-now))
+		return nil
+	})
+	if err != nil {
+		logger.Warnf("output of job %s cannot be shipped to its origin: %v", j.Id, err)
+		stats.Count("transfer_failures")
+		j.Conclude(task.run)
+	} else {
+		j.EgressCost += fc.ShipCost(output, j.Origin)
+	}
+	return events
+}
+
+/*
+Returns the jobs in waiting that have tasks of new stages to run, which are removed from waiting.
+*/
+func released(waiting *[]*job.Job) []*job.Job {
+	res := make([]*job.Job, 0)
+	kept := (*waiting)[:0]
+	for _, j := range *waiting {
+		if len(j.Tasks) > 0 {
+			res = append(res, j)
+		} else {
+			kept = append(kept, j)
+		}
+	}
+	*waiting = kept
+	return res
+}
+
 type Scheduler interface {
 	//Pop() *job.Task
 	Add(t *job.Job)
@@ -7,6 +7,7 @@ import (
 
 	"github.com/dsfalves/gdsim/file"
 	"github.com/dsfalves/gdsim/job"
+	"github.com/dsfalves/gdsim/network"
 	"github.com/dsfalves/gdsim/scheduler/event"
 	"github.com/dsfalves/gdsim/topology"
 	"github.com/google/go-cmp/cmp"
@@ -17,12 +18,21 @@ type schedulerHeap interface {
 	heap.Interface
 }
 
+// makespanJobs exposes the job on top of a makespanHeap to checkHeap
+type makespanJobs struct {
+	*makespanHeap
+}
+
+func (h makespanJobs) Top() *job.Job {
+	return &h.makespanHeap.Top().Job
+}
+
 func checkHeap(t *testing.T, heap schedulerHeap, length int, j *job.Job) {
 	if heap.Len() != 2 {
 		t.Fatalf("error adding jobs, expected %d added, found %v", length, heap.Len())
 	}
 	top := heap.Top()
-	if !cmp.Equal(*j, *top) {
+	if !cmp.Equal(*j, *top, cmp.AllowUnexported(job.Job{}, job.DoneTask{})) {
 		t.Errorf("error adding job, expected heap[0]=%v, found %v", j, top)
 	}
 }
@@ -48,6 +58,7 @@ func checkEvents(t *testing.T, events []event.Event, answers []expected) {
 }
 
 func TestGSRPT(t *testing.T) {
+	nw := network.NewSimpleNetwork()
 	cap := [][2]int{
 		{1, 1},
 		{1, 1},
@@ -56,13 +67,13 @@ func TestGSRPT(t *testing.T) {
 		{0, 10},
 		{10, 0},
 	}
-	topo, err := topology.NewFifo(cap, speeds)
+	topo, err := topology.NewFifo(cap, speeds, &nw)
 	if err != nil {
 		t.Fatalf("failure to setup test: %v", err)
 	}
 	sample := "f1 100 0\nf2 200 1"
 	reader := strings.NewReader(sample)
-	files, err := file.Load(reader, topo)
+	files, err := file.Load(reader, topo, &nw)
 	if err != nil {
 		t.Fatalf("failure to setup test: %v", err)
 	}
@@ -110,6 +121,7 @@ func TestGSRPT(t *testing.T) {
 }
 
 func TestGSRPT2(t *testing.T) {
+	nw := network.NewSimpleNetwork()
 	cap := [][2]int{
 		{1, 1},
 		{1, 1},
@@ -118,13 +130,13 @@ func TestGSRPT2(t *testing.T) {
 		{0, 10},
 		{10, 0},
 	}
-	topo, err := topology.NewFifo(cap, speeds)
+	topo, err := topology.NewFifo(cap, speeds, &nw)
 	if err != nil {
 		t.Fatalf("failure to setup test: %v", err)
 	}
 	sample := "f1 100 0\nf2 200 1"
 	reader := strings.NewReader(sample)
-	files, err := file.Load(reader, topo)
+	files, err := file.Load(reader, topo, &nw)
 	job1 := job.Job{
 		Id:         "job1",
 		Submission: 0,
@@ -170,6 +182,7 @@ func TestGSRPT2(t *testing.T) {
 }
 
 func TestGeoDis(t *testing.T) {
+	nw := network.NewSimpleNetwork()
 	cap := [][2]int{
 		{1, 1},
 		{1, 1},
@@ -178,13 +191,13 @@ func TestGeoDis(t *testing.T) {
 		{0, 10},
 		{10, 0},
 	}
-	topo, err := topology.NewFifo(cap, speeds)
+	topo, err := topology.NewFifo(cap, speeds, &nw)
 	if err != nil {
 		t.Fatalf("failure to setup test: %v", err)
 	}
 	sample := "f1 100 0\nf2 200 1"
 	reader := strings.NewReader(sample)
-	files, err := file.Load(reader, topo)
+	files, err := file.Load(reader, topo, &nw)
 	job1 := job.Job{
 		Id:         "job1",
 		Submission: 0,
@@ -210,7 +223,7 @@ func TestGeoDis(t *testing.T) {
 	scheduler.Add(&job2)
 
 	scheduler.Update(0)
-	checkHeap(t, &scheduler.heap, 2, &job2)
+	checkHeap(t, makespanJobs{&scheduler.heap}, 2, &job2)
 
 	events := scheduler.Schedule(0)
 	answers := []expected{
@@ -230,6 +243,7 @@ func TestGeoDis(t *testing.T) {
 }
 
 func TestGeoDis2(t *testing.T) {
+	nw := network.NewSimpleNetwork()
 	cap := [][2]int{
 		{1, 1},
 		{1, 1},
@@ -238,13 +252,13 @@ func TestGeoDis2(t *testing.T) {
 		{0, 10},
 		{10, 0},
 	}
-	topo, err := topology.NewFifo(cap, speeds)
+	topo, err := topology.NewFifo(cap, speeds, &nw)
 	if err != nil {
 		t.Fatalf("failure to setup test: %v", err)
 	}
 	sample := "f1 20 0\nf2 10 1"
 	reader := strings.NewReader(sample)
-	files, err := file.Load(reader, topo)
+	files, err := file.Load(reader, topo, &nw)
 	job1 := job.Job{
 		Id:         "job1",
 		Submission: 0,
@@ -271,20 +285,25 @@ func TestGeoDis2(t *testing.T) {
 	scheduler.Add(&job2)
 
 	scheduler.Update(0)
-	checkHeap(t, &scheduler.heap, 2, &job2)
+	checkHeap(t, makespanJobs{&scheduler.heap}, 2, &job2)
 
 	events := scheduler.Schedule(0)
 	answers := []expected{
-		{
-			time: 20,
-			node: topo.DataCenters[1].Get(0),
-		},
 		{
 			time: 21,
 			node: topo.DataCenters[0].Get(0),
 		},
+		{
+			time: 20,
+			node: topo.DataCenters[1].Get(0),
+		},
 	}
-	checkEvents(t, events, answers)
+	// f2 is copied to DC0 for the second task of job2
+	transfer, ok := events[0].(transferFileEvent)
+	if !ok || transfer.f.Id() != "f2" || transfer.where != topo.DataCenters[0] {
+		t.Fatalf("error scheduling jobs, expected transfer of f2 to DC0 first, found %v", events[0])
+	}
+	checkEvents(t, events[1:], answers)
 
 	if scheduler.heap.Len() != 0 {
 		t.Fatalf("error scheduling jobs, expected job heap to have size 0, found %v", scheduler.heap.Len())
@@ -292,6 +311,7 @@ func TestGeoDis2(t *testing.T) {
 }
 
 func TestGeoDis3(t *testing.T) {
+	nw := network.NewSimpleNetwork()
 	cap := [][2]int{
 		{1, 1},
 		{1, 1},
@@ -300,13 +320,13 @@ func TestGeoDis3(t *testing.T) {
 		{0, 10},
 		{10, 0},
 	}
-	topo, err := topology.NewFifo(cap, speeds)
+	topo, err := topology.NewFifo(cap, speeds, &nw)
 	if err != nil {
 		t.Fatalf("failure to setup test: %v", err)
 	}
 	sample := "f1 20 0\nf2 200 1"
 	reader := strings.NewReader(sample)
-	files, err := file.Load(reader, topo)
+	files, err := file.Load(reader, topo, &nw)
 	job1 := job.Job{
 		Id:         "job1",
 		Submission: 0,
@@ -333,7 +353,7 @@ func TestGeoDis3(t *testing.T) {
 	scheduler.Add(&job2)
 
 	scheduler.Update(0)
-	checkHeap(t, &scheduler.heap, 2, &job1)
+	checkHeap(t, makespanJobs{&scheduler.heap}, 2, &job1)
 
 	events := scheduler.Schedule(0)
 	answers := []expected{
@@ -354,6 +374,7 @@ func TestGeoDis3(t *testing.T) {
 }
 
 func TestSwag(t *testing.T) {
+	nw := network.NewSimpleNetwork()
 	cap := [][2]int{
 		{1, 1},
 		{1, 1},
@@ -362,13 +383,13 @@ func TestSwag(t *testing.T) {
 		{0, 10},
 		{10, 0},
 	}
-	topo, err := topology.NewFifo(cap, speeds)
+	topo, err := topology.NewFifo(cap, speeds, &nw)
 	if err != nil {
 		t.Fatalf("failure to setup test: %v", err)
 	}
 	sample := "f1 100 0\nf2 200 1"
 	reader := strings.NewReader(sample)
-	files, err := file.Load(reader, topo)
+	files, err := file.Load(reader, topo, &nw)
 	job1 := job.Job{
 		Id:         "job1",
 		Submission: 0,
@@ -394,7 +415,7 @@ func TestSwag(t *testing.T) {
 	scheduler.Add(&job2)
 
 	scheduler.Update(0)
-	checkHeap(t, &scheduler.heap, 2, &job2)
+	checkHeap(t, makespanJobs{&scheduler.heap}, 2, &job2)
 
 	events := scheduler.Schedule(0)
 	answers := []expected{
@@ -414,6 +435,7 @@ func TestSwag(t *testing.T) {
 }
 
 func TestSwag2(t *testing.T) {
+	nw := network.NewSimpleNetwork()
 	cap := [][2]int{
 		{1, 1},
 		{1, 1},
@@ -422,13 +444,13 @@ func TestSwag2(t *testing.T) {
 		{0, 10},
 		{10, 0},
 	}
-	topo, err := topology.NewFifo(cap, speeds)
+	topo, err := topology.NewFifo(cap, speeds, &nw)
 	if err != nil {
 		t.Fatalf("failure to setup test: %v", err)
 	}
 	sample := "f1 20 0\nf2 10 1"
 	reader := strings.NewReader(sample)
-	files, err := file.Load(reader, topo)
+	files, err := file.Load(reader, topo, &nw)
 	job1 := job.Job{
 		Id:         "job1",
 		Submission: 0,
@@ -455,7 +477,7 @@ func TestSwag2(t *testing.T) {
 	scheduler.Add(&job2)
 
 	scheduler.Update(0)
-	checkHeap(t, &scheduler.heap, 2, &job1)
+	checkHeap(t, makespanJobs{&scheduler.heap}, 2, &job1)
 
 	events := scheduler.Schedule(0)
 	answers := []expected{
@@ -476,6 +498,7 @@ func TestSwag2(t *testing.T) {
 }
 
 func TestSwag3(t *testing.T) {
+	nw := network.NewSimpleNetwork()
 	cap := [][2]int{
 		{1, 1},
 		{1, 1},
@@ -484,13 +507,13 @@ func TestSwag3(t *testing.T) {
 		{0, 10},
 		{10, 0},
 	}
-	topo, err := topology.NewFifo(cap, speeds)
+	topo, err := topology.NewFifo(cap, speeds, &nw)
 	if err != nil {
 		t.Fatalf("failure to setup test: %v", err)
 	}
 	sample := "f1 20 0\nf2 200 1"
 	reader := strings.NewReader(sample)
-	files, err := file.Load(reader, topo)
+	files, err := file.Load(reader, topo, &nw)
 	job1 := job.Job{
 		Id:         "job1",
 		Submission: 0,
@@ -517,7 +540,7 @@ func TestSwag3(t *testing.T) {
 	scheduler.Add(&job2)
 
 	scheduler.Update(0)
-	checkHeap(t, &scheduler.heap, 2, &job1)
+	checkHeap(t, makespanJobs{&scheduler.heap}, 2, &job1)
 
 	events := scheduler.Schedule(0)
 	answers := []expected{
@@ -536,3 +559,70 @@ func TestSwag3(t *testing.T) {
 		t.Fatalf("error scheduling jobs, expected job heap to have size 0, found %v", scheduler.heap.Len())
 	}
 }
+
+func TestGeoDisRestoring(t *testing.T) {
+	nw := network.NewSimpleNetwork()
+	topo, err := topology.NewFifo([][2]int{{1, 1}}, [][]uint64{{0}}, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	files, err := file.Load(strings.NewReader("f1 10 0"), topo, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	changes, _, err := topology.LoadCapacity(strings.NewReader("0 DC0 drain 1\n50 DC0 add 1 1\n"), topo)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	changes[0].Process()
+	j := job.Job{Id: "j", Cpus: 1, Tasks: []job.Task{{Duration: 10}}, File: files["f1"]}
+	scheduler := NewGeoDis(*topo)
+	scheduler.Add(&j)
+	if events := scheduler.Schedule(0); len(events) != 0 || scheduler.Pending() != 1 {
+		t.Fatalf("expected job to wait for nodes, found %d events and %d pending jobs", len(events), scheduler.Pending())
+	}
+	changes[1].Process()
+	checkEvents(t, scheduler.Schedule(50), []expected{{time: 60, node: topo.DataCenters[0].Get(0)}})
+}
+
+func TestGeoDisAntiAffinity(t *testing.T) {
+	cap := [][2]int{
+		{1, 1},
+		{1, 1},
+	}
+	speeds := [][]uint64{
+		{0, 1},
+		{1, 0},
+	}
+	nw := network.NewSimpleNetwork()
+	topo, err := topology.NewFifo(cap, speeds, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	files, err := file.Load(strings.NewReader("f1 1000 0"), topo, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	busy := job.Job{Id: "busy", Cpus: 1, Tasks: []job.Task{{Duration: 10}}, File: files["f1"]}
+	// waiting in DC0 beats transferring the input to DC1, so both jobs are meant for DC0
+	first := job.Job{Id: "first", Cpus: 1, Tasks: []job.Task{{Duration: 10}}, File: files["f1"]}
+	second := job.Job{Id: "second", Cpus: 1, AntiAffinity: []string{"first"}, Tasks: []job.Task{{Duration: 20}}, File: files["f1"]}
+
+	scheduler := NewGeoDis(*topo)
+	scheduler.Add(&busy)
+	scheduler.Schedule(0)
+	scheduler.Add(&first)
+	scheduler.Add(&second)
+	scheduler.Schedule(0)
+	if queued := topo.DataCenters[0].QueuedTasks(); len(queued) != 1 || queued[0].(*taskEndEvent).job.Id != "first" {
+		t.Fatalf("expected first job to wait in DC0, found %v", queued)
+	}
+	deferred := scheduler.Results()["second"]
+	if scheduler.Pending() != 1 || len(deferred.Scheduled) != 0 {
+		t.Fatalf("expected job in conflict with a queued job to be deferred, found %d pending jobs", scheduler.Pending())
+	}
+	scheduler.Schedule(0)
+	if len(deferred.Scheduled) != 1 || deferred.Scheduled[0].Location != "DC1" {
+		t.Errorf("expected deferred job to run in DC1, found %v", deferred.Scheduled)
+	}
+}
@@ -10,15 +10,28 @@ import (
 )
 
 type GlobalSRPTScheduler struct {
-	heap     jobHeap
-	topology topology.Topology
-	jobs     map[string]*job.Job
+	heap       jobHeap
+	topology   topology.Topology
+	jobs       map[string]*job.Job
+	preemption PreemptionMode
+	queued     map[*job.Job]bool
+	waiting    []*job.Job // jobs without runnable tasks whose later stages are not runnable yet
 }
 
 func NewGRPTS(t topology.Topology) *GlobalSRPTScheduler {
+	return NewPreemptiveGRPTS(t, NoPreemption)
+}
+
+/*
+NewPreemptiveGRPTS creates a Global-SRPT scheduler that preempts running tasks
+of jobs with longer remaining processing time when a data center is full.
+*/
+func NewPreemptiveGRPTS(t topology.Topology, mode PreemptionMode) *GlobalSRPTScheduler {
 	scheduler := &GlobalSRPTScheduler{
-		topology: t,
-		jobs:     make(map[string]*job.Job),
+		topology:   t,
+		jobs:       make(map[string]*job.Job),
+		preemption: mode,
+		queued:     make(map[*job.Job]bool),
 	}
 	heap.Init(&scheduler.heap)
 	return scheduler
@@ -28,31 +41,100 @@ func (scheduler *GlobalSRPTScheduler) Add(j *job.Job) {
 	logger.Debugf("%p.Add(%p)", scheduler, j)
 	sort.Slice(j.Tasks, func(i, k int) bool { return j.Tasks[i].Duration < j.Tasks[k].Duration })
 	heap.Push(&scheduler.heap, j)
+	scheduler.queued[j] = true
 	scheduler.jobs[j.Id] = j
 }
 
 func (scheduler GlobalSRPTScheduler) Pending() int {
-	return scheduler.heap.Len()
+	return scheduler.heap.Len() + len(scheduler.waiting)
+}
+
+/*
+Returns the remaining processing time of a running task at time now,
+added to the remaining processing time of its job.
+*/
+func remaining(task *taskEndEvent, now uint64) uint64 {
+	var left uint64
+	if end := task.End(); end > now {
+		left = end - now
+	}
+	return left + rpt(*task.job)
+}
+
+/*
+Preempts the running task in dc with the longest remaining processing time, if it is longer
+than the remaining processing time of j and it frees enough resources for a task of j.
+Returns the preempted task, or nil if no task was preempted.
+*/
+func (scheduler *GlobalSRPTScheduler) preemptFor(now uint64, dc topology.DataCenter, j *job.Job) *taskEndEvent {
+	need := demand(*j)
+	limit := rpt(*j)
+	var victim *taskEndEvent
+	for _, rt := range dc.RunningTasks() {
+		task, ok := rt.(*taskEndEvent)
+		if !ok || task.job == j || task.cpus < need.Cpus || task.memory < need.Memory {
+			continue
+		}
+		if left := remaining(task, now); left > limit && (victim == nil || left > remaining(victim, now)) {
+			victim = task
+		}
+	}
+	if victim == nil || !dc.Preempt(now, victim) {
+		return nil
+	}
+	victim.bill(now, dc)
+	return victim
+}
+
+// Returns the remaining work of preempted tasks to their jobs and the jobs to the heap.
+func (scheduler *GlobalSRPTScheduler) requeue(preempted []*taskEndEvent) {
+	for _, task := range preempted {
+		j := task.job
+		j.Tasks = append(j.Tasks, task.task())
+		sort.Slice(j.Tasks, func(i, k int) bool { return j.Tasks[i].Duration < j.Tasks[k].Duration })
+		if !scheduler.queued[j] {
+			heap.Push(&scheduler.heap, j)
+			scheduler.queued[j] = true
+		}
+	}
+	heap.Init(&scheduler.heap)
 }
 
 func (scheduler *GlobalSRPTScheduler) Schedule(now uint64) []event.Event {
 	logger.Debugf("%p.Schedule(%v)", scheduler, now)
 	events := make([]event.Event, 0)
+	preempted := make([]*taskEndEvent, 0)
+	defer func() { scheduler.requeue(preempted) }()
+	for _, j := range released(&scheduler.waiting) {
+		sort.Slice(j.Tasks, func(i, k int) bool { return j.Tasks[i].Duration < j.Tasks[k].Duration })
+		if !scheduler.queued[j] {
+			heap.Push(&scheduler.heap, j)
+			scheduler.queued[j] = true
+		}
+	}
 	for scheduler.heap.Len() > 0 {
 		top := scheduler.heap[0]
-		dcs := fullBestDcs(top.File, scheduler.topology, int(top.Cpus))
-		for len(top.Tasks) > 0 {
+		jobDcs := fullBestDcs(*top, top.TaskInputs(job.Task{}), scheduler.topology)
+		dropped := false
+		for len(top.Tasks) > 0 && !dropped {
+			task := top.Tasks[len(top.Tasks)-1]
+			dcs := jobDcs
+			if len(task.Partitions) > 0 {
+				dcs = fullBestDcs(*top, top.TaskInputs(task), scheduler.topology)
+			}
 			hosted := false
 			for _, dc := range dcs {
-				task := top.Tasks[len(top.Tasks)-1]
-				taskEnd := &taskEndEvent{
-					start:    dc.transferTime + now,
-					duration: task.Duration,
-					cpus:     int(top.Cpus),
-					job:      top,
+				taskEnd := newTaskEndEvent(top, task)
+				taskEnd.start = dc.transferTime + now
+				taskEnd.preemption = scheduler.preemption
+				if scheduler.preemption != NoPreemption && dc.dataCenter.Availability(demand(*top)) == 0 {
+					if victim := scheduler.preemptFor(now, dc.dataCenter, top); victim != nil {
+						preempted = append(preempted, victim)
+					}
 				}
 				if node, success := dc.dataCenter.Host(taskEnd); success {
 					top.Tasks = top.Tasks[:len(top.Tasks)-1]
+					access(dc.dataCenter, top.TaskInputs(task), now)
 					if node != nil {
 						taskEnd.where = node.Location
 						if node.QueueLen() == 1 {
@@ -66,11 +148,18 @@ func (scheduler *GlobalSRPTScheduler) Schedule(now uint64) []event.Event {
 					logger.Infof("failed scheduling task for job %p", top.Id)
 				}
 			}
-			if !hosted {
+			if !hosted && !unschedulable(*top, dcs, scheduler.topology) {
 				return events
 			}
+			dropped = !hosted
 		}
 		heap.Pop(&scheduler.heap)
+		delete(scheduler.queued, top)
+		if dropped {
+			reportUnschedulable(top)
+		} else if top.Waiting() {
+			scheduler.waiting = append(scheduler.waiting, top)
+		}
 	}
 	return events
 }
@@ -0,0 +1,399 @@
+package scheduler
+
+import (
+	"container/heap"
+	"strings"
+	"testing"
+
+	"github.com/dsfalves/gdsim/file"
+	"github.com/dsfalves/gdsim/job"
+	"github.com/dsfalves/gdsim/network"
+	"github.com/dsfalves/gdsim/scheduler/event"
+	"github.com/dsfalves/gdsim/topology"
+)
+
+func TestPreemptiveGSRPT(t *testing.T) {
+	modes := map[PreemptionMode]uint64{
+		KillRestart:   100,
+		SuspendResume: 90,
+	}
+	for mode, remainingDuration := range modes {
+		cap := [][2]int{
+			{1, 1},
+		}
+		speeds := [][]uint64{
+			{0},
+		}
+		nw := network.NewSimpleNetwork()
+		topo, err := topology.NewFifo(cap, speeds, &nw)
+		if err != nil {
+			t.Fatalf("failure to setup test: %v", err)
+		}
+		files, err := file.Load(strings.NewReader("f1 100 0"), topo, &nw)
+		if err != nil {
+			t.Fatalf("failure to setup test: %v", err)
+		}
+		long := job.Job{
+			Id:    "long",
+			Cpus:  1,
+			Tasks: []job.Task{{Duration: 100}},
+			File:  files["f1"],
+		}
+		short := job.Job{
+			Id:    "short",
+			Cpus:  1,
+			Tasks: []job.Task{{Duration: 5}},
+			File:  files["f1"],
+		}
+
+		scheduler := NewPreemptiveGRPTS(*topo, mode)
+		scheduler.Add(&long)
+		scheduler.Schedule(0)
+		if scheduler.Pending() != 0 {
+			t.Fatalf("expected no pending jobs, found %d", scheduler.Pending())
+		}
+
+		scheduler.Add(&short)
+		scheduler.Schedule(10)
+		if scheduler.Pending() != 1 {
+			t.Fatalf("expected preempted job to be pending, found %d pending jobs", scheduler.Pending())
+		}
+		if len(long.Tasks) != 1 || long.Tasks[0].Duration != remainingDuration {
+			t.Errorf("expected preempted task with duration %d, found %v", remainingDuration, long.Tasks)
+		}
+		if len(long.Scheduled) != 0 {
+			t.Errorf("expected preempted execution to be removed from results, found %v", long.Scheduled)
+		}
+		running := topo.DataCenters[0].RunningTasks()
+		if len(running) != 1 || running[0].(*taskEndEvent).job != &short {
+			t.Errorf("expected short job to be running, found %v", running)
+		}
+	}
+}
+
+func TestParsePreemptionMode(t *testing.T) {
+	keys := map[string]PreemptionMode{
+		"none":    NoPreemption,
+		"kill":    KillRestart,
+		"suspend": SuspendResume,
+	}
+	for name, key := range keys {
+		if mode, err := ParsePreemptionMode(name); err != nil || mode != key {
+			t.Errorf("expected ParsePreemptionMode(%v) = %v, found %v, %v", name, key, mode, err)
+		}
+	}
+	if _, err := ParsePreemptionMode("sometimes"); err == nil {
+		t.Errorf("expected error for unknown preemption mode")
+	}
+}
+
+func TestMalleableGSRPT(t *testing.T) {
+	cap := [][2]int{
+		{1, 4},
+	}
+	speeds := [][]uint64{
+		{0},
+	}
+	nw := network.NewSimpleNetwork()
+	topo, err := topology.NewFifo(cap, speeds, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	files, err := file.Load(strings.NewReader("f1 100 0"), topo, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	first := job.Job{
+		Id:    "first",
+		Cpus:  2,
+		Tasks: []job.Task{{Duration: 100}},
+		File:  files["f1"],
+	}
+	malleable := job.Job{
+		Id:      "malleable",
+		Cpus:    4,
+		MinCpus: 1,
+		Tasks:   []job.Task{{Duration: 10}},
+		File:    files["f1"],
+	}
+
+	scheduler := NewGRPTS(*topo)
+	scheduler.Add(&first)
+	scheduler.Schedule(0)
+	scheduler.Add(&malleable)
+	scheduler.Schedule(0)
+
+	if len(malleable.Scheduled) != 1 {
+		t.Fatalf("expected malleable task to start immediately, found %v", malleable.Scheduled)
+	}
+	if d := malleable.Scheduled[0].Duration; d != 20 {
+		t.Errorf("expected malleable task running with 2 of 4 CPUs to take 20, found %d", d)
+	}
+}
+
+func TestPartitionLocality(t *testing.T) {
+	cap := [][2]int{
+		{1, 1},
+		{1, 1},
+	}
+	speeds := [][]uint64{
+		{0, 1},
+		{1, 0},
+	}
+	nw := network.NewSimpleNetwork()
+	topo, err := topology.NewFifo(cap, speeds, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	files, err := file.Load(strings.NewReader("f1 10 0 1\np0 100 0\np1 100 1"), topo, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	j := job.Job{
+		Id:     "j",
+		Cpus:   1,
+		Inputs: []file.File{files["f1"]},
+		Tasks: []job.Task{
+			{Duration: 10, Partitions: []file.File{files["p1"]}},
+			{Duration: 20, Partitions: []file.File{files["p0"]}},
+		},
+	}
+	if dcs := fullBestDcs(j, j.TaskInputs(j.Tasks[0]), *topo); dcs[0].dataCenter.Id() != "DC1" || dcs[1].transferTime != 100 {
+		t.Errorf("expected DC1 to be the best data center for partition p1, found %v", dcs)
+	}
+
+	scheduler := NewGRPTS(*topo)
+	scheduler.Add(&j)
+	scheduler.Schedule(0)
+	if scheduler.Pending() != 0 {
+		t.Fatalf("expected no pending jobs, found %d", scheduler.Pending())
+	}
+	for _, dc := range topo.DataCenters {
+		for _, task := range dc.RunningTasks() {
+			taskEnd := task.(*taskEndEvent)
+			if taskEnd.start != 0 || taskEnd.partitions[0].Id() != "p"+dc.Id()[2:] {
+				t.Errorf("expected task reading %v to start at 0 in its partition data center, found %v starting at %d", taskEnd.partitions[0].Id(), dc.Id(), taskEnd.start)
+			}
+		}
+	}
+}
+
+func TestOutputShipping(t *testing.T) {
+	cap := [][2]int{
+		{1, 1},
+		{1, 1},
+	}
+	speeds := [][]uint64{
+		{0, 100},
+		{100, 0},
+	}
+	nw := network.NewSimpleNetwork()
+	topo, err := topology.NewFifo(cap, speeds, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	files, err := file.Load(strings.NewReader("f1 10 0"), topo, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	shipped := job.Job{
+		Id:     "shipped",
+		Cpus:   1,
+		Tasks:  []job.Task{{Duration: 10}},
+		File:   files["f1"],
+		Origin: "DC1",
+		Output: 1000,
+	}
+	intermediate := shipped
+	intermediate.Id = "intermediate"
+	intermediate.Tasks = []job.Task{{Duration: 10}}
+	intermediate.Intermediate = true
+
+	for _, j := range []*job.Job{&shipped, &intermediate} {
+		scheduler := NewGRPTS(*topo)
+		scheduler.Add(j)
+		events := make(event.EventHeap, 0)
+		for _, e := range scheduler.Schedule(0) {
+			heap.Push(&events, e)
+		}
+		for events.Len() > 0 {
+			for _, e := range heap.Pop(&events).(event.Event).Process() {
+				heap.Push(&events, e)
+			}
+		}
+		if len(j.Outputs) != 1 || !topo.DataCenters[0].Container().Has(j.Outputs[0].Id()) {
+			t.Fatalf("expected output of job %s to be stored in DC0, found %v", j.Id, j.Outputs)
+		}
+	}
+
+	// the output takes 10 seconds of link delay and 10 seconds of transfer
+	if end := shipped.Scheduled[0].End(); end != 30 {
+		t.Errorf("expected shipped task to end at 30 after its output arrives, found %d", end)
+	}
+	if end := intermediate.Scheduled[0].End(); end != 10 {
+		t.Errorf("expected task with intermediate output to end at 10, found %d", end)
+	}
+}
+
+func TestPreemptedRecord(t *testing.T) {
+	nw := network.NewSimpleNetwork()
+	topo, err := topology.NewFifo([][2]int{{1, 2}, {1, 1}}, [][]uint64{{0, 100}, {100, 0}}, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	files, err := file.Load(strings.NewReader("f1 10 0"), topo, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	j := &job.Job{Id: "j", Cpus: 1, Tasks: []job.Task{{Duration: 10}, {Duration: 10}}, File: files["f1"], Origin: "DC1", Output: 1000}
+	// both tasks start at 0 with the same duration in the same data center
+	first, second := newTaskEndEvent(j, j.Tasks[0]), newTaskEndEvent(j, j.Tasks[1])
+	first.Process()
+	second.Process()
+	events := make(event.EventHeap, 0)
+	for _, e := range second.Finished(10, topo.DataCenters[0]) {
+		heap.Push(&events, e)
+	}
+	first.Preempted(15)
+	for events.Len() > 0 {
+		for _, e := range heap.Pop(&events).(event.Event).Process() {
+			heap.Push(&events, e)
+		}
+	}
+	if len(j.Scheduled) != 1 || j.Scheduled[0].Delivered != 30 {
+		t.Errorf("expected the execution of the second task delivered at 30, found %v", j.Scheduled)
+	}
+	// the first task runs again, and is preempted again after the second one was delivered
+	first.Process()
+	first.Preempted(35)
+	if len(j.Scheduled) != 1 || j.Scheduled[0].Delivered != 30 {
+		t.Errorf("expected only the execution of the second task left, found %v", j.Scheduled)
+	}
+}
+
+func TestEvictedTransfer(t *testing.T) {
+	nw := network.NewSimpleNetwork()
+	topo, err := topology.NewFifo([][2]int{{2, 1}}, [][]uint64{{0}}, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	dc := topo.DataCenters[0].(*topology.FifoDataCenter)
+	j := &job.Job{Id: "j", Cpus: 1, Tasks: []job.Task{{Duration: 10}, {Duration: 20}}}
+	// the first task waits 5 for its inputs, the second one needs no transfer
+	evicted, other := newTaskEndEvent(j, j.Tasks[0]), newTaskEndEvent(j, j.Tasks[1])
+	evicted.transferTime = 5
+	evicted.SetStart(0)
+	dc.Host(evicted)
+	node, _ := dc.Host(other)
+	dc.Drain(8, 1, true)
+	if dc.QueueLen() != 1 {
+		t.Fatalf("expected evicted task to wait in the queue, found %d tasks", dc.QueueLen())
+	}
+	// the inputs arrived before the eviction, so the task starts as soon as the other one ends
+	node.Process()
+	if evicted.start != 20 {
+		t.Errorf("expected evicted task to start again at 20, found %d", evicted.start)
+	}
+}
+
+func TestStagesGSRPT(t *testing.T) {
+	cap := [][2]int{
+		{1, 1},
+		{1, 1},
+	}
+	speeds := [][]uint64{
+		{0, 1},
+		{1, 0},
+	}
+	nw := network.NewSimpleNetwork()
+	topo, err := topology.NewFifo(cap, speeds, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	files, err := file.Load(strings.NewReader("f1 10 1"), topo, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	jobs, err := job.Load(strings.NewReader("j 1 0 f1 stage=map shuffle=1000 10 stage=reduce:map 5"), files)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	j := &jobs[0]
+
+	scheduler := NewGRPTS(*topo)
+	scheduler.Add(j)
+	events := make(event.EventHeap, 0)
+	for _, e := range scheduler.Schedule(0) {
+		heap.Push(&events, e)
+	}
+	if scheduler.Pending() != 1 {
+		t.Fatalf("expected job waiting for its reduce stage to be pending, found %d", scheduler.Pending())
+	}
+	for events.Len() > 0 {
+		for _, e := range heap.Pop(&events).(event.Event).Process() {
+			heap.Push(&events, e)
+		}
+	}
+	scheduler.Schedule(20)
+	if scheduler.Pending() != 0 {
+		t.Fatalf("expected no pending jobs, found %d", scheduler.Pending())
+	}
+	if len(j.Scheduled) != 2 {
+		t.Fatalf("expected map and reduce tasks to be scheduled, found %v", j.Scheduled)
+	}
+	// the reduce task runs where the map task left its 1000 bytes of shuffle data
+	if reduce := j.Scheduled[1]; reduce.Location != "DC1" || reduce.Start != 20 {
+		t.Errorf("expected reduce task to start at 20 in DC1, found %+v", reduce)
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	cap := [][2]int{
+		{1, 1},
+		{1, 1},
+		{1, 1},
+	}
+	speeds := [][]uint64{
+		{0, 1, 1},
+		{1, 0, 1},
+		{1, 1, 0},
+	}
+	nw := network.NewSimpleNetwork()
+	topo, err := topology.NewFifo(cap, speeds, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	files, err := file.Load(strings.NewReader("local 100 0 forbidden=1\nshared 100 0"), topo, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	second := job.Job{Id: "second", Cpus: 1, Allowed: []string{"DC2"}, Tasks: []job.Task{{Duration: 10}}, File: files["shared"]}
+	// DC1 cannot receive its input and DC2 runs a job to avoid
+	resident := job.Job{Id: "resident", Cpus: 1, AntiAffinity: []string{"second"}, Tasks: []job.Task{{Duration: 10}}, File: files["local"]}
+	// only allowed in DC2, which runs a job to avoid
+	avoiding := job.Job{Id: "avoiding", Cpus: 1, Allowed: []string{"DC2"}, AntiAffinity: []string{"second"}, Tasks: []job.Task{{Duration: 10}}, File: files["shared"]}
+	// only allowed in DC1, where its input cannot be stored
+	impossible := job.Job{Id: "impossible", Cpus: 1, Allowed: []string{"DC1"}, Tasks: []job.Task{{Duration: 10}}, File: files["local"]}
+
+	scheduler := NewGRPTS(*topo)
+	scheduler.Add(&second)
+	scheduler.Schedule(0)
+	if len(second.Scheduled) != 1 || second.Scheduled[0].Location != "DC2" {
+		t.Fatalf("expected second job to run in DC2, found %v", second.Scheduled)
+	}
+	scheduler.Add(&impossible)
+	scheduler.Schedule(0)
+	if scheduler.Pending() != 0 || len(impossible.Scheduled) != 0 {
+		t.Errorf("expected unschedulable job to be dropped, found %d pending jobs", scheduler.Pending())
+	}
+	scheduler.Add(&resident)
+	scheduler.Schedule(0)
+	if len(resident.Scheduled) != 1 || resident.Scheduled[0].Location != "DC0" {
+		t.Errorf("expected resident job to run in DC0, found %v", resident.Scheduled)
+	}
+	scheduler.Add(&avoiding)
+	scheduler.Schedule(0)
+	if scheduler.Pending() != 1 || len(avoiding.Scheduled) != 0 {
+		t.Errorf("expected job kept out by anti-affinity to be pending, found %d pending jobs", scheduler.Pending())
+	}
+}
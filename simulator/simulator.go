@@ -2,19 +2,24 @@ package simulator
 
 import (
 	"container/heap"
+	"fmt"
+	"sort"
 
 	"github.com/dsfalves/gdsim/file"
 	"github.com/dsfalves/gdsim/job"
 	"github.com/dsfalves/gdsim/log"
+	"github.com/dsfalves/gdsim/metrics"
 	"github.com/dsfalves/gdsim/scheduler"
 	"github.com/dsfalves/gdsim/scheduler/event"
 	"github.com/dsfalves/gdsim/topology"
 )
 
 var logger log.Context
+var stats metrics.Context
 
 func init() {
 	logger = log.New("simulator")
+	stats = metrics.New("simulator")
 }
 
 type JobArrival struct {
@@ -47,6 +52,13 @@ func (scheduling WindowScheduling) Process() []event.Event {
 	logger.Debugf("%d tasks remaining", scheduling.sim.Len())
 	logger.Debugf("%d jobs remaining", scheduling.Scheduler.Pending())
 	jobEvents := scheduling.Scheduler.Schedule(scheduling.When)
+	if scheduling.sim.Replication != nil {
+		jobEvents = append(jobEvents, scheduling.sim.Replication.Replicate(scheduling.When)...)
+	}
+	for _, scaler := range scheduling.sim.Autoscalers {
+		jobEvents = append(jobEvents, scaler.Scale(scheduling.When)...)
+	}
+	scheduling.sim.sample()
 	if scheduling.sim.Len() > 0 || scheduling.Scheduler.Pending() > 0 {
 		when := scheduling.When + scheduling.Window
 		logger.Debugf("first when: %d (%d + %d)", when, scheduling.When, scheduling.Window)
@@ -74,6 +86,16 @@ type Simulation struct {
 	Topo      *topology.Topology
 	Heap      event.EventHeap
 	Scheduler scheduler.Scheduler
+	// Replication copies files among data centers at every scheduling window, if not nil
+	Replication *file.ReplicationManager
+	// Autoscalers resize the node pools of their data centers at every scheduling window
+	Autoscalers []*topology.Autoscaler
+	costs       []int
+	tenants     []string
+	last        uint64             /* time up to which energy was accounted */
+	energy      map[string]float64 /* energy drawn by each data center, in kWh */
+	emissions   map[string]float64 /* carbon emitted by each data center, in gCO2 */
+	nodeTime    map[string]uint64  /* time nodes of each data center were in service, in node-seconds */
 }
 
 func New(jobs []job.Job, files map[string]file.File, topo *topology.Topology, scheduler scheduler.Scheduler, window uint64) *Simulation {
@@ -82,10 +104,23 @@ func New(jobs []job.Job, files map[string]file.File, topo *topology.Topology, sc
 		Files:     files,
 		Topo:      topo,
 		Scheduler: scheduler,
+		energy:    make(map[string]float64),
+		emissions: make(map[string]float64),
+		nodeTime:  make(map[string]uint64),
 	}
 	heap.Init(&sim.Heap)
 	min := jobs[0].Submission
+	seen := make(map[int]bool)
+	tenants := make(map[string]bool)
 	for _, j := range jobs {
+		if j.Tenant != "" && !tenants[j.Tenant] {
+			tenants[j.Tenant] = true
+			sim.tenants = append(sim.tenants, j.Tenant)
+		}
+		if !seen[int(j.Cpus)] {
+			seen[int(j.Cpus)] = true
+			sim.costs = append(sim.costs, int(j.Cpus))
+		}
 		heap.Push(&sim.Heap, JobArrival{
 			Job:       j,
 			Scheduler: scheduler,
@@ -94,6 +129,9 @@ func New(jobs []job.Job, files map[string]file.File, topo *topology.Topology, sc
 			min = j.Submission
 		}
 	}
+	sim.last = min
+	sort.Ints(sim.costs)
+	sort.Strings(sim.tenants)
 	heap.Push(&sim.Heap, WindowScheduling{
 		When:      min + 1,
 		Window:    window,
@@ -104,6 +142,20 @@ func New(jobs []job.Job, files map[string]file.File, topo *topology.Topology, sc
 	return sim
 }
 
+// AddBackground adds the arrivals of background tasks to the simulation.
+func (simulation *Simulation) AddBackground(arrivals []topology.BackgroundArrival) {
+	for _, arrival := range arrivals {
+		heap.Push(&simulation.Heap, arrival)
+	}
+}
+
+// AddCapacityChanges adds changes to the capacity of data centers to the simulation.
+func (simulation *Simulation) AddCapacityChanges(changes []topology.CapacityChange) {
+	for _, change := range changes {
+		heap.Push(&simulation.Heap, change)
+	}
+}
+
 func (simulation *Simulation) Run() ([]Result, error) {
 	// Create JobArrival Events
 	// While there are events to process
@@ -117,14 +169,84 @@ func (simulation *Simulation) Run() ([]Result, error) {
 			logger.Infof("next event is of type %T", simulation.Heap[0])
 		}
 		logger.Infof("%d events remaining:", len(simulation.Heap))
+		simulation.account(e.Time())
 		for _, new_event := range e.Process() {
 			logger.Infof("simulator adding event of type %T", new_event)
 			heap.Push(&simulation.Heap, new_event)
 		}
 	}
+	simulation.recordEnergy()
+	simulation.recordNodeHours()
 	return nil, nil
 }
 
+/*
+Accounts the energy drawn by every data center, the carbon it emitted and the time its nodes were in service,
+from the time accounted so far until now. The tasks running in the data centers, and their nodes,
+only change as events are processed.
+*/
+func (simulation *Simulation) account(now uint64) {
+	if now <= simulation.last {
+		return
+	}
+	for _, dc := range simulation.Topo.DataCenters {
+		watts := topology.Power(dc)
+		simulation.energy[dc.Id()] += watts * float64(now-simulation.last) / 3.6e6
+		simulation.emissions[dc.Id()] += simulation.Topo.Carbon.Emissions(dc.Id(), watts, simulation.last, now)
+		simulation.nodeTime[dc.Id()] += uint64(len(dc.Nodes())) * (now - simulation.last)
+	}
+	simulation.last = now
+}
+
+// Records the energy drawn and the carbon emitted by each data center during the run, and their totals.
+func (simulation Simulation) recordEnergy() {
+	var energy, emissions float64
+	for _, dc := range simulation.Topo.DataCenters {
+		energy += simulation.energy[dc.Id()]
+		emissions += simulation.emissions[dc.Id()]
+	}
+	if energy == 0 {
+		return
+	}
+	for _, dc := range simulation.Topo.DataCenters {
+		stats.Add(fmt.Sprintf("%s.energy", dc.Id()), simulation.energy[dc.Id()])
+		stats.Add(fmt.Sprintf("%s.emissions", dc.Id()), simulation.emissions[dc.Id()])
+	}
+	stats.Add("energy", energy)
+	stats.Add("emissions", emissions)
+}
+
+// Records the node-hours consumed by each data center during the run, and their total.
+func (simulation Simulation) recordNodeHours() {
+	var total uint64
+	for _, dc := range simulation.Topo.DataCenters {
+		stats.Add(fmt.Sprintf("%s.node_hours", dc.Id()), float64(simulation.nodeTime[dc.Id()])/3600)
+		total += simulation.nodeTime[dc.Id()]
+	}
+	stats.Add("node_hours", float64(total)/3600)
+}
+
+/*
+Records the fragmentation of every data center for each task size present in the workload,
+the CPUs used by background tasks in every data center and the dominant share of the topology
+used by each tenant.
+*/
+func (simulation Simulation) sample() {
+	if len(simulation.tenants) > 0 {
+		shares := scheduler.Shares(*simulation.Topo)
+		for _, tenant := range simulation.tenants {
+			stats.Add(fmt.Sprintf("tenant.%s.share", tenant), shares[tenant])
+		}
+	}
+	for _, dc := range simulation.Topo.DataCenters {
+		stats.Add(fmt.Sprintf("%s.background_cpus", dc.Id()), float64(topology.BackgroundCpus(dc)))
+		for _, cost := range simulation.costs {
+			stats.Add(fmt.Sprintf("%s.fragmentation.cpus%d", dc.Id(), cost), topology.Fragmentation(dc, cost))
+			stats.Add(fmt.Sprintf("%s.availability.cpus%d", dc.Id(), cost), float64(dc.JobAvailability(cost)))
+		}
+	}
+}
+
 func (simulation Simulation) Len() int {
 	return simulation.Heap.Len()
 }
@@ -0,0 +1,144 @@
+package topology
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dsfalves/gdsim/scheduler/event"
+)
+
+// BackgroundTask is local load of a data center, which uses its CPUs outside the control of the schedulers
+type BackgroundTask struct {
+	start, duration uint64
+	cpus            int
+}
+
+func (task BackgroundTask) End() uint64            { return task.start + task.duration }
+func (task BackgroundTask) Cpus() int              { return task.cpus }
+func (task BackgroundTask) Memory() int            { return 0 }
+func (task *BackgroundTask) SetStart(start uint64) { task.start = start }
+func (task BackgroundTask) SetWhere(where int)     {}
+func (task BackgroundTask) SetSpeed(speed float64) {}
+func (task BackgroundTask) Process() []event.Event { return nil }
+
+// BackgroundArrival is the arrival of a background task in a data center
+type BackgroundArrival struct {
+	When     uint64
+	Dc       DataCenter
+	Cpus     int
+	Duration uint64
+}
+
+func (arrival BackgroundArrival) Time() uint64 {
+	return arrival.When
+}
+
+/*
+Process hosts the background task in its data center, where it waits for free CPUs like any other task
+if the data center is full. Tasks that no node of the data center can host are left out.
+*/
+func (arrival BackgroundArrival) Process() []event.Event {
+	task := &BackgroundTask{start: arrival.When, duration: arrival.Duration, cpus: arrival.Cpus}
+	node, success := arrival.Dc.Host(task)
+	if !success {
+		logger.Warnf("background task with %d CPUs does not fit in %s", arrival.Cpus, arrival.Dc.Id())
+		return nil
+	}
+	if node != nil && node.QueueLen() == 1 {
+		return []event.Event{node}
+	}
+	return nil
+}
+
+// BackgroundCpus returns the CPUs of dc used by background tasks.
+func BackgroundCpus(dc DataCenter) int {
+	var cpus int
+	for _, rt := range dc.RunningTasks() {
+		if task, ok := rt.(*BackgroundTask); ok {
+			cpus += task.cpus
+		}
+	}
+	return cpus
+}
+
+/*
+LoadBackground reads the background load of the data centers of topo from reader, one entry per line, as either
+a single task, with its arrival time, data center id, CPUs and duration, e.g. "3600 DC0 4 600",
+or a Poisson process, with "poisson", the data center id, the mean number of arrivals per hour,
+the CPUs of each task, their mean duration, exponentially distributed, and the time arrivals stop,
+e.g. "poisson DC1 30 2 900 86400". Random values are drawn from a generator initialized with seed.
+Arrivals are returned sorted by time.
+*/
+func LoadBackground(reader io.Reader, topo *Topology, seed int64) ([]BackgroundArrival, error) {
+	dcs := make(map[string]DataCenter)
+	for _, dc := range topo.DataCenters {
+		dcs[dc.Id()] = dc
+	}
+	random := rand.New(rand.NewSource(seed))
+	res := make([]BackgroundArrival, 0)
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 {
+			continue
+		}
+		poisson := words[0] == "poisson"
+		if poisson {
+			words = words[1:]
+		}
+		if poisson && len(words) != 5 || !poisson && len(words) != 4 {
+			return nil, fmt.Errorf("failure to read background load %d: wrong number of values", line)
+		}
+		id := words[1]
+		if poisson {
+			id = words[0]
+		}
+		dc, ok := dcs[id]
+		if !ok {
+			return nil, fmt.Errorf("failure to read background load %d: unknown data center %v", line, id)
+		}
+		if !poisson {
+			values, err := parseValues(append(words[:1:1], words[2:]...))
+			if err != nil {
+				return nil, fmt.Errorf("failure to read background load %d: %v", line, err)
+			}
+			res = append(res, BackgroundArrival{When: uint64(values[0]), Dc: dc, Cpus: int(values[1]), Duration: uint64(values[2])})
+			continue
+		}
+		values, err := parseValues(words[1:])
+		if err != nil {
+			return nil, fmt.Errorf("failure to read background load %d: %v", line, err)
+		}
+		rate, cpus, mean, until := values[0]/3600, int(values[1]), values[2], values[3]
+		if rate == 0 {
+			continue
+		}
+		for t := random.ExpFloat64() / rate; t < until; t += random.ExpFloat64() / rate {
+			duration := uint64(random.ExpFloat64()*mean) + 1
+			res = append(res, BackgroundArrival{When: uint64(t), Dc: dc, Cpus: cpus, Duration: duration})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(res, func(i, k int) bool { return res[i].When < res[k].When })
+	return res, nil
+}
+
+// Parses words as non-negative numbers.
+func parseValues(words []string) ([]float64, error) {
+	values := make([]float64, len(words))
+	for i, word := range words {
+		value, err := strconv.ParseFloat(word, 64)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("invalid value %v", word)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
@@ -0,0 +1,67 @@
+package topology
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dsfalves/gdsim/network"
+)
+
+func TestLoadBackground(t *testing.T) {
+	nw := network.NewSimpleNetwork()
+	topo, err := NewFifo([][2]int{{2, 4}, {1, 4}}, [][]uint64{{0, 1}, {1, 0}}, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	sample := "100 DC1 2 50\n\npoisson DC0 60 1 30 36000\n10 DC0 3 20\n"
+	arrivals, err := LoadBackground(strings.NewReader(sample), topo, 1)
+	if err != nil {
+		t.Fatalf("error '%v' while loading background load '%v', expected nil", err, sample)
+	}
+	if len(arrivals) < 300 || len(arrivals) > 900 {
+		t.Errorf("expected about 600 background arrivals, found %d", len(arrivals))
+	}
+	for i := 1; i < len(arrivals); i++ {
+		if arrivals[i].When < arrivals[i-1].When {
+			t.Fatalf("expected arrivals sorted by time, found %d after %d", arrivals[i].When, arrivals[i-1].When)
+		}
+	}
+	again, _ := LoadBackground(strings.NewReader(sample), topo, 1)
+	if len(again) != len(arrivals) {
+		t.Errorf("expected the same arrivals for the same seed, found %d and %d", len(arrivals), len(again))
+	}
+	for _, bad := range []string{"10 DC0 3\n", "10 DC9 3 20\n", "poisson DC0 60 1 30\n", "10 DC0 -3 20\n"} {
+		if _, err := LoadBackground(strings.NewReader(bad), topo, 1); err == nil {
+			t.Errorf("expected error for background load '%v', found nil", bad)
+		}
+	}
+}
+
+func TestBackgroundArrival(t *testing.T) {
+	nw := network.NewSimpleNetwork()
+	topo, err := NewFifo([][2]int{{2, 4}}, [][]uint64{{0}}, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	dc := topo.DataCenters[0]
+	events := BackgroundArrival{When: 10, Dc: dc, Cpus: 3, Duration: 20}.Process()
+	if len(events) != 1 {
+		t.Fatalf("expected event for the node hosting the background task, found %v", events)
+	}
+	if free := dc.JobAvailability(2); free != 2 {
+		t.Errorf("expected room for 2 tasks with 2 CPUs, found %d", free)
+	}
+	if endings := dc.ExpectedEndings(); len(endings) != 1 || endings[0] != 30 {
+		t.Errorf("expected background task to end at 30, found %v", endings)
+	}
+	if cpus := BackgroundCpus(dc); cpus != 3 {
+		t.Errorf("expected 3 CPUs used by background tasks, found %d", cpus)
+	}
+	events[0].Process()
+	if free := dc.JobAvailability(1); free != 8 {
+		t.Errorf("expected all CPUs free after the background task ends, found %d", free)
+	}
+	if events := (BackgroundArrival{When: 10, Dc: dc, Cpus: 5, Duration: 20}).Process(); len(events) != 0 || BackgroundCpus(dc) != 0 {
+		t.Errorf("expected background task larger than the nodes to be left out")
+	}
+}
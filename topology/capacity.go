@@ -0,0 +1,278 @@
+package topology
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/dsfalves/gdsim/scheduler/event"
+)
+
+/*
+AddNodes adds the computers of group to dc and returns the new nodes.
+New nodes draw the same power per core as the first node of dc.
+*/
+func (dc *FifoDataCenter) AddNodes(group NodeGroup) ([]*Node, error) {
+	if group.Speed <= 0 {
+		return nil, fmt.Errorf("invalid node speed %v", group.Speed)
+	}
+	added := make([]*Node, 0, group.Computers)
+	for k := 0; k < group.Computers; k++ {
+		n := NewNode(group.Cores, dc.id)
+		n.memory = group.Memory
+		n.freeMemory = group.Memory
+		n.speed = group.Speed
+		n.datacenter = dc
+		if len(dc.nodes) > 0 {
+			n.SetPower(dc.nodes[0].idleWatts, dc.nodes[0].activeWatts)
+		}
+		dc.nodes = append(dc.nodes, n)
+		added = append(added, n)
+	}
+	if group.Computers > 0 && group.Cores > dc.nodeMax {
+		dc.nodeMax = group.Cores
+	}
+	return added, nil
+}
+
+// Removes n from the nodes of dc.
+func (dc *FifoDataCenter) remove(n *Node) {
+	for i, node := range dc.nodes {
+		if node == n {
+			dc.nodes = append(dc.nodes[:i], dc.nodes[i+1:]...)
+			return
+		}
+	}
+}
+
+// ActiveNodes returns how many nodes of dc are not draining.
+func (dc FifoDataCenter) ActiveNodes() int {
+	active := 0
+	for _, n := range dc.nodes {
+		if !n.draining {
+			active++
+		}
+	}
+	return active
+}
+
+// Restorer is implemented by data centers that may have all their nodes out of service for a while
+type Restorer interface {
+	// Restoring returns whether the data center has no nodes in service but expects new ones
+	Restoring() bool
+}
+
+/*
+Restoring returns whether dc has no nodes in service but expects new ones, either from capacity
+changes not processed yet or from an autoscaler, which adds nodes when tasks wait in dc.
+*/
+func (dc FifoDataCenter) Restoring() bool {
+	return dc.ActiveNodes() == 0 && (dc.incoming > 0 || dc.scaled)
+}
+
+// QueueLen returns how many tasks wait in dc for free resources.
+func (dc FifoDataCenter) QueueLen() int {
+	return dc.queue.Len()
+}
+
+/*
+Drain takes count nodes of dc out of service at time now, preferring those running the fewest tasks.
+Drained nodes take no new tasks and leave dc once their tasks end. With evict, preemptible tasks are
+stopped instead, keeping or losing the work done according to their preemption mode, and wait in the
+queue of dc to run again, while other tasks are left to finish. Returns the events of the nodes that start running tasks of the queue.
+*/
+func (dc *FifoDataCenter) Drain(now uint64, count int, evict bool) []event.Event {
+	for ; count > 0; count-- {
+		var victim *Node
+		for _, n := range dc.nodes {
+			if !n.draining && (victim == nil || len(n.RunningTasks()) < len(victim.RunningTasks())) {
+				victim = n
+			}
+		}
+		if victim == nil {
+			break
+		}
+		victim.draining = true
+		if evict {
+			for _, task := range victim.RunningTasks() {
+				if victim.Preempt(now, task) {
+					stats.Count("evictions")
+					dc.Enqueue(task)
+				}
+			}
+		}
+		if len(victim.RunningTasks()) == 0 {
+			dc.remove(victim)
+		}
+	}
+	return dc.Dequeue(now, nil)
+}
+
+// CapacityChange adds nodes to a data center or drains some of its nodes at a given time
+type CapacityChange struct {
+	When  uint64
+	Dc    *FifoDataCenter
+	Add   NodeGroup // computers added to the data center
+	Drain int       // nodes drained from the data center
+	Evict bool      // tasks running on drained nodes are evicted instead of left to finish
+	// autoscaler that requested the added computers, if any
+	scaler *Autoscaler
+}
+
+func (change CapacityChange) Time() uint64 {
+	return change.When
+}
+
+func (change CapacityChange) Process() []event.Event {
+	if change.scaler != nil {
+		change.scaler.pending -= change.Add.Computers
+	} else {
+		// computers of changes loaded ahead are expected by the data center
+		change.Dc.incoming -= change.Add.Computers
+		if change.Dc.incoming < 0 {
+			change.Dc.incoming = 0
+		}
+	}
+	if change.Add.Computers > 0 {
+		if _, err := change.Dc.AddNodes(change.Add); err != nil {
+			logger.Warnf("failure to add nodes to %s: %v", change.Dc.Id(), err)
+		}
+	}
+	return change.Dc.Drain(change.When, change.Drain, change.Evict)
+}
+
+/*
+Autoscaler grows the node pool of a data center when tasks wait in its queue, requesting a node for every
+PerNode waiting tasks, and shrinks it by draining one idle node at a time when no task waits,
+keeping between Min and Max nodes. New nodes are like the first node of the data center when the autoscaler
+was created, and only join it Delay seconds after they are requested.
+*/
+type Autoscaler struct {
+	Dc       *FifoDataCenter
+	Min, Max int
+	Delay    uint64
+	PerNode  int
+	template NodeGroup
+	pending  int // nodes requested and not provisioned yet
+}
+
+func NewAutoscaler(dc *FifoDataCenter, min, max int, delay uint64, perNode int) (*Autoscaler, error) {
+	if len(dc.nodes) == 0 {
+		return nil, fmt.Errorf("data center %s has no nodes to scale", dc.Id())
+	}
+	if min > max || perNode < 1 {
+		return nil, fmt.Errorf("invalid autoscaling limits for %s", dc.Id())
+	}
+	first := dc.nodes[0]
+	dc.scaled = true
+	return &Autoscaler{
+		Dc:       dc,
+		Min:      min,
+		Max:      max,
+		Delay:    delay,
+		PerNode:  perNode,
+		template: NodeGroup{Computers: 1, Cores: first.capacity, Memory: first.memory, Speed: first.speed},
+	}, nil
+}
+
+// Scale resizes the node pool at time now, returning the events of the changes it causes.
+func (scaler *Autoscaler) Scale(now uint64) []event.Event {
+	nodes := scaler.Dc.ActiveNodes() + scaler.pending
+	if queued := scaler.Dc.QueueLen(); queued > 0 {
+		add := (queued+scaler.PerNode-1)/scaler.PerNode - scaler.pending
+		if add > scaler.Max-nodes {
+			add = scaler.Max - nodes
+		}
+		if add <= 0 {
+			return nil
+		}
+		group := scaler.template
+		group.Computers = add
+		scaler.pending += add
+		stats.Add(fmt.Sprintf("%s.autoscaling.added", scaler.Dc.Id()), float64(add))
+		return []event.Event{CapacityChange{When: now + scaler.Delay, Dc: scaler.Dc, Add: group, scaler: scaler}}
+	}
+	if scaler.pending > 0 || nodes <= scaler.Min {
+		return nil
+	}
+	for _, n := range scaler.Dc.nodes {
+		if !n.draining && len(n.RunningTasks()) == 0 {
+			stats.Add(fmt.Sprintf("%s.autoscaling.drained", scaler.Dc.Id()), 1)
+			return scaler.Dc.Drain(now, 1, false)
+		}
+	}
+	return nil
+}
+
+/*
+LoadCapacity reads changes to the capacity of the data centers of topo from reader, one per line, as either
+the time, data center id, "add" and a node group, e.g. "7200 DC2 add 4 8" to add 4 computers with 8 cores,
+the time, data center id, "drain", the number of nodes and optionally "evict", e.g. "3600 DC2 drain 4 evict",
+or "autoscale", the data center id, the least and most nodes, the provisioning delay and the waiting tasks
+that justify a new node, e.g. "autoscale DC0 2 10 300 4".
+*/
+func LoadCapacity(reader io.Reader, topo *Topology) ([]CapacityChange, []*Autoscaler, error) {
+	dcs := make(map[string]*FifoDataCenter)
+	for _, dc := range topo.DataCenters {
+		if fifo, ok := dc.(*FifoDataCenter); ok {
+			dcs[dc.Id()] = fifo
+		}
+	}
+	changes := make([]CapacityChange, 0)
+	scalers := make([]*Autoscaler, 0)
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 {
+			continue
+		}
+		if len(words) < 3 {
+			return nil, nil, fmt.Errorf("failure to read capacity change %d: missing values", line)
+		}
+		if words[0] == "autoscale" {
+			dc, ok := dcs[words[1]]
+			values, err := parseValues(words[2:])
+			if !ok || err != nil || len(values) != 4 {
+				return nil, nil, fmt.Errorf("failure to read capacity change %d: invalid autoscaling %v", line, words[1:])
+			}
+			scaler, err := NewAutoscaler(dc, int(values[0]), int(values[1]), uint64(values[2]), int(values[3]))
+			if err != nil {
+				return nil, nil, fmt.Errorf("failure to read capacity change %d: %v", line, err)
+			}
+			scalers = append(scalers, scaler)
+			continue
+		}
+		when, err := strconv.ParseUint(words[0], 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failure to read capacity change %d: %v", line, err)
+		}
+		dc, ok := dcs[words[1]]
+		if !ok {
+			return nil, nil, fmt.Errorf("failure to read capacity change %d: unknown data center %v", line, words[1])
+		}
+		change := CapacityChange{When: when, Dc: dc}
+		switch {
+		case words[2] == "add":
+			groups, err := parseGroups(strings.Join(words[3:], " "))
+			if err != nil || len(groups) != 1 {
+				return nil, nil, fmt.Errorf("failure to read capacity change %d: invalid node group %v", line, words[3:])
+			}
+			change.Add = groups[0]
+			dc.incoming += change.Add.Computers
+		case words[2] == "drain" && (len(words) == 4 || len(words) == 5 && words[4] == "evict"):
+			if change.Drain, err = strconv.Atoi(words[3]); err != nil || change.Drain < 0 {
+				return nil, nil, fmt.Errorf("failure to read capacity change %d: invalid number of nodes %v", line, words[3])
+			}
+			change.Evict = len(words) == 5
+		default:
+			return nil, nil, fmt.Errorf("failure to read capacity change %d: unknown change %v", line, words[2:])
+		}
+		changes = append(changes, change)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return changes, scalers, nil
+}
@@ -0,0 +1,149 @@
+package topology
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dsfalves/gdsim/network"
+)
+
+func TestLoadCapacity(t *testing.T) {
+	nw := network.NewSimpleNetwork()
+	topo, err := NewFifo([][2]int{{2, 4}, {1, 8}}, [][]uint64{{0, 1}, {1, 0}}, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	sample := "3600 DC1 drain 1 evict\n\n7200 DC0 add 3 16 2\nautoscale DC1 1 4 300 2\n"
+	changes, scalers, err := LoadCapacity(strings.NewReader(sample), topo)
+	if err != nil {
+		t.Fatalf("error '%v' while loading capacity '%v', expected nil", err, sample)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 capacity changes, found %d", len(changes))
+	}
+	if c := changes[0]; c.When != 3600 || c.Dc.Id() != "DC1" || c.Drain != 1 || !c.Evict {
+		t.Errorf("expected DC1 to drain 1 node with eviction at 3600, found %+v", c)
+	}
+	if c := changes[1]; c.When != 7200 || c.Dc.Id() != "DC0" || c.Add != (NodeGroup{Computers: 3, Cores: 16, Speed: 2}) {
+		t.Errorf("expected 3 computers with 16 cores added to DC0 at 7200, found %+v", c)
+	}
+	if len(scalers) != 1 {
+		t.Fatalf("expected 1 autoscaler, found %d", len(scalers))
+	}
+	if s := scalers[0]; s.Dc.Id() != "DC1" || s.Min != 1 || s.Max != 4 || s.Delay != 300 || s.PerNode != 2 {
+		t.Errorf("expected autoscaler of DC1 with 1 to 4 nodes, found %+v", s)
+	}
+	for _, bad := range []string{"10 DC0 drain\n", "10 DC9 drain 1\n", "10 DC0 drain 1 now\n", "10 DC0 add 4\n", "10 DC0 resize 4\n", "autoscale DC0 4 1 300 2\n"} {
+		if _, _, err := LoadCapacity(strings.NewReader(bad), topo); err == nil {
+			t.Errorf("expected error for capacity change '%v', found nil", bad)
+		}
+	}
+}
+
+func TestDrain(t *testing.T) {
+	nw := network.NewSimpleNetwork()
+	topo, err := NewFifo([][2]int{{2, 4}}, [][]uint64{{0}}, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	dc := topo.DataCenters[0].(*FifoDataCenter)
+	t1 := sampleTask{end: 100, cpus: 4}
+	t2 := &samplePreemptible{sampleTask: sampleTask{end: 100, cpus: 4}}
+	first, _ := dc.Host(t1)
+	dc.Host(t2)
+
+	events := dc.Drain(10, 2, true)
+	if len(events) != 0 {
+		t.Errorf("expected no node to start a task after draining, found %v", events)
+	}
+	if t2.preempted != 10 {
+		t.Errorf("expected preemptible task to be evicted at 10, found %d", t2.preempted)
+	}
+	if n := dc.NumNodes(); n != 1 {
+		t.Errorf("expected the node without running tasks to leave, found %d nodes", n)
+	}
+	if total := dc.TotalResources(); total.Cpus != 0 {
+		t.Errorf("expected no CPUs in service, found %d", total.Cpus)
+	}
+	if l := dc.QueueLen(); l != 1 {
+		t.Errorf("expected evicted task to wait in the queue, found %d tasks", l)
+	}
+
+	first.Process()
+	if n := dc.NumNodes(); n != 0 {
+		t.Errorf("expected drained node to leave once its task ended, found %d nodes", n)
+	}
+	events = CapacityChange{When: 200, Dc: dc, Add: NodeGroup{Computers: 1, Cores: 4, Speed: 1}}.Process()
+	if len(events) != 1 || dc.QueueLen() != 0 {
+		t.Errorf("expected evicted task to restart on the new node, found %d events and %d waiting tasks", len(events), dc.QueueLen())
+	}
+}
+
+func TestHostDrained(t *testing.T) {
+	nw := network.NewSimpleNetwork()
+	topo, err := NewFifo([][2]int{{1, 4}}, [][]uint64{{0}}, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	dc := topo.DataCenters[0].(*FifoDataCenter)
+	changes, _, err := LoadCapacity(strings.NewReader("10 DC0 drain 1\n20 DC0 add 1 4\n"), topo)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	changes[0].Process()
+	if n, ok := dc.Host(sampleTask{end: 100, cpus: 2}); n != nil || !ok || dc.QueueLen() != 1 {
+		t.Fatalf("expected task to wait for nodes in a drained data center, found %p, %v and %d waiting tasks", n, ok, dc.QueueLen())
+	}
+	if _, ok := dc.Host(sampleTask{end: 100, cpus: 8}); ok {
+		t.Errorf("expected task larger than any node to be rejected")
+	}
+	events := changes[1].Process()
+	if len(events) != 1 || dc.QueueLen() != 0 {
+		t.Errorf("expected waiting task to start on the new node, found %d events and %d waiting tasks", len(events), dc.QueueLen())
+	}
+	CapacityChange{When: 30, Dc: dc, Drain: 1}.Process()
+	if _, ok := dc.Host(sampleTask{end: 100, cpus: 2}); ok || dc.Restoring() {
+		t.Errorf("expected task to be rejected by a drained data center expecting no nodes")
+	}
+}
+
+func TestAutoscaler(t *testing.T) {
+	nw := network.NewSimpleNetwork()
+	topo, err := NewFifo([][2]int{{1, 4}, {3, 4}}, [][]uint64{{0, 1}, {1, 0}}, &nw)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	dc := topo.DataCenters[0].(*FifoDataCenter)
+	scaler, err := NewAutoscaler(dc, 1, 2, 300, 1)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		dc.Host(sampleTask{end: 1000, cpus: 4})
+	}
+	events := scaler.Scale(10)
+	if len(events) != 1 {
+		t.Fatalf("expected a request for nodes, found %v", events)
+	}
+	change, ok := events[0].(CapacityChange)
+	if !ok || change.Time() != 310 || change.Add.Computers != 1 || change.Add.Cores != 4 {
+		t.Fatalf("expected 1 node with 4 cores at 310, found %+v", events[0])
+	}
+	if events := scaler.Scale(20); len(events) != 0 {
+		t.Errorf("expected no request beyond the most nodes, found %v", events)
+	}
+	if events := change.Process(); len(events) != 1 || dc.NumNodes() != 2 {
+		t.Errorf("expected a waiting task to start on the new node, found %v and %d nodes", events, dc.NumNodes())
+	}
+
+	idle := topo.DataCenters[1].(*FifoDataCenter)
+	scaler, err = NewAutoscaler(idle, 2, 4, 300, 1)
+	if err != nil {
+		t.Fatalf("failure to setup test: %v", err)
+	}
+	scaler.Scale(10)
+	scaler.Scale(20)
+	if n := idle.NumNodes(); n != 2 {
+		t.Errorf("expected idle data center to shrink to 2 nodes, found %d", n)
+	}
+}
@@ -0,0 +1,125 @@
+package topology
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SetPower sets the power drawn by each core of n, in watts, when idle and when running a task.
+func (n *Node) SetPower(idle, active float64) {
+	n.idleWatts = idle
+	n.activeWatts = active
+}
+
+// Power returns the power currently drawn by n, in watts.
+func (n *Node) Power() float64 {
+	used := n.capacity - n.freeCpus
+	return float64(used)*n.activeWatts + float64(n.freeCpus)*n.idleWatts
+}
+
+// Power returns the power currently drawn by all nodes of dc, in watts.
+func Power(dc DataCenter) float64 {
+	var watts float64
+	for _, n := range dc.Nodes() {
+		watts += n.Power()
+	}
+	return watts
+}
+
+// IntensityChange is a new carbon intensity, in gCO2/kWh, that holds from Time on
+type IntensityChange struct {
+	Time  uint64
+	Value float64
+}
+
+/*
+CarbonIntensity holds the carbon intensity of the electricity used by each data center over time,
+as changes sorted by time, by data center id.
+*/
+type CarbonIntensity map[string][]IntensityChange
+
+/*
+LoadCarbonIntensity reads carbon intensities from reader, one per line, as the time from which it holds,
+the data center id and the intensity in gCO2/kWh, e.g. "3600 DC0 250".
+*/
+func LoadCarbonIntensity(reader io.Reader) (CarbonIntensity, error) {
+	res := make(CarbonIntensity)
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 {
+			continue
+		}
+		if len(words) != 3 {
+			return nil, fmt.Errorf("failure to read carbon intensity %d: expected 3 fields, found %d", line, len(words))
+		}
+		time, err := strconv.ParseUint(words[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failure to read carbon intensity %d: %v", line, err)
+		}
+		value, err := strconv.ParseFloat(words[2], 64)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("failure to read carbon intensity %d: invalid intensity %v", line, words[2])
+		}
+		res[words[1]] = append(res[words[1]], IntensityChange{Time: time, Value: value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, changes := range res {
+		sort.SliceStable(changes, func(i, k int) bool { return changes[i].Time < changes[k].Time })
+	}
+	return res, nil
+}
+
+/*
+At returns the carbon intensity of the data center with id dc at time t.
+The first intensity of a data center also holds before its time, and data centers without intensities have 0.
+*/
+func (ci CarbonIntensity) At(dc string, t uint64) float64 {
+	changes := ci[dc]
+	i := sort.Search(len(changes), func(i int) bool { return changes[i].Time > t })
+	if i == 0 {
+		if len(changes) == 0 {
+			return 0
+		}
+		return changes[0].Value
+	}
+	return changes[i-1].Value
+}
+
+// Lowest returns the lowest carbon intensity of the data center with id dc from time start to end.
+func (ci CarbonIntensity) Lowest(dc string, start, end uint64) float64 {
+	lowest := ci.At(dc, start)
+	for _, c := range ci[dc] {
+		if c.Time > start && c.Time <= end {
+			lowest = math.Min(lowest, c.Value)
+		}
+	}
+	return lowest
+}
+
+/*
+Emissions returns the grams of CO2 emitted by the data center with id dc drawing a constant power
+of watts from time start to end, in seconds.
+*/
+func (ci CarbonIntensity) Emissions(dc string, watts float64, start, end uint64) float64 {
+	var total float64 /* intensity integrated over time, in gCO2 s/kWh */
+	for t := start; t < end; {
+		next := end
+		for _, c := range ci[dc] {
+			if c.Time > t && c.Time < next {
+				next = c.Time
+				break
+			}
+		}
+		total += float64(next-t) * ci.At(dc, t)
+		t = next
+	}
+	return watts * total / 3.6e6
+}
@@ -0,0 +1,60 @@
+package topology
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestLoadCarbonIntensity(t *testing.T) {
+	sample := "3600 DC0 100\n0 DC0 400\n\n0 DC1 50\n"
+	ci, err := LoadCarbonIntensity(strings.NewReader(sample))
+	if err != nil {
+		t.Fatalf("error '%v' while loading carbon intensity '%v', expected nil", err, sample)
+	}
+	tests := []struct {
+		dc       string
+		time     uint64
+		expected float64
+	}{
+		{"DC0", 0, 400},
+		{"DC0", 3599, 400},
+		{"DC0", 3600, 100},
+		{"DC1", 10000, 50},
+		{"DC2", 0, 0},
+	}
+	for _, test := range tests {
+		if value := ci.At(test.dc, test.time); value != test.expected {
+			t.Errorf("expected intensity of %s at %d to be %v, found %v", test.dc, test.time, test.expected, value)
+		}
+	}
+	if lowest := ci.Lowest("DC0", 0, 3000); lowest != 400 {
+		t.Errorf("expected lowest intensity of DC0 before 3000 to be 400, found %v", lowest)
+	}
+	if lowest := ci.Lowest("DC0", 0, 4000); lowest != 100 {
+		t.Errorf("expected lowest intensity of DC0 before 4000 to be 100, found %v", lowest)
+	}
+	// 1kW for an hour at 400 g/kWh and another at 100 g/kWh
+	if emissions := ci.Emissions("DC0", 1000, 0, 7200); math.Abs(emissions-500) > 1e-9 {
+		t.Errorf("expected emissions of 500g, found %v", emissions)
+	}
+	for _, bad := range []string{"0 DC0\n", "x DC0 10\n", "0 DC0 -1\n"} {
+		if _, err := LoadCarbonIntensity(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected error for carbon intensity '%v', found nil", bad)
+		}
+	}
+}
+
+func TestPower(t *testing.T) {
+	dc := FifoDataCenter{nodes: []*Node{NewNode(4, 0), NewNode(2, 0)}, placement: FirstFit{}, nodeMax: 4}
+	for _, n := range dc.nodes {
+		n.SetPower(10, 25)
+	}
+	if watts := Power(&dc); watts != 60 {
+		t.Errorf("expected idle data center to draw 60W, found %v", watts)
+	}
+	dc.Host(sampleTask{end: 10, cpus: 3})
+	if watts := Power(&dc); watts != 105 {
+		t.Errorf("expected data center with 3 busy cores to draw 105W, found %v", watts)
+	}
+}
@@ -0,0 +1,133 @@
+package topology
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Placement is an interface to model how a data center chooses the node that will host a task
+type Placement interface {
+	// Select should return the node in nodes that will host task, or nil if no node can host it
+	Select(nodes []*Node, task RunningTask) *Node
+}
+
+// FirstFit selects the first node with enough free resources.
+type FirstFit struct{}
+
+func (FirstFit) Select(nodes []*Node, task RunningTask) *Node {
+	for _, n := range nodes {
+		if n.Fits(task) {
+			return n
+		}
+	}
+	return nil
+}
+
+/*
+Returns whether n has less free resources than other: fewer free CPUs,
+or as many and less free memory, if both nodes track memory.
+*/
+func tighter(n, other *Node) bool {
+	if n.freeCpus != other.freeCpus {
+		return n.freeCpus < other.freeCpus
+	}
+	return n.memory > 0 && other.memory > 0 && n.freeMemory < other.freeMemory
+}
+
+// BestFit selects the node with enough free resources that will have the least free CPUs left after hosting the task, then the least free memory.
+type BestFit struct{}
+
+func (BestFit) Select(nodes []*Node, task RunningTask) *Node {
+	var best *Node
+	for _, n := range nodes {
+		if n.Fits(task) && (best == nil || tighter(n, best)) {
+			best = n
+		}
+	}
+	return best
+}
+
+// WorstFit selects the node with enough free resources that will have the most free CPUs left after hosting the task, then the most free memory.
+type WorstFit struct{}
+
+func (WorstFit) Select(nodes []*Node, task RunningTask) *Node {
+	var best *Node
+	for _, n := range nodes {
+		if n.Fits(task) && (best == nil || tighter(best, n)) {
+			best = n
+		}
+	}
+	return best
+}
+
+// RoundRobin selects the first node with enough free resources, starting after the last node selected.
+type RoundRobin struct {
+	next int
+}
+
+func (rr *RoundRobin) Select(nodes []*Node, task RunningTask) *Node {
+	for i := range nodes {
+		k := (rr.next + i) % len(nodes)
+		if nodes[k].Fits(task) {
+			rr.next = k + 1
+			return nodes[k]
+		}
+	}
+	return nil
+}
+
+// RandomFit selects uniformly among the nodes with enough free resources.
+type RandomFit struct {
+	rng *rand.Rand
+}
+
+func NewRandomFit(seed int64) *RandomFit {
+	return &RandomFit{
+		rng: rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (rf *RandomFit) Select(nodes []*Node, task RunningTask) *Node {
+	candidates := make([]*Node, 0, len(nodes))
+	for _, n := range nodes {
+		if n.Fits(task) {
+			candidates = append(candidates, n)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	return candidates[rf.rng.Intn(len(candidates))]
+}
+
+/*
+NewPlacement returns the placement strategy identified by name.
+Valid names are "first", "best", "worst", "roundrobin" and "random"; seed is only used by "random".
+*/
+func NewPlacement(name string, seed int64) (Placement, error) {
+	switch name {
+	case "first":
+		return FirstFit{}, nil
+	case "best":
+		return BestFit{}, nil
+	case "worst":
+		return WorstFit{}, nil
+	case "roundrobin":
+		return &RoundRobin{}, nil
+	case "random":
+		return NewRandomFit(seed), nil
+	}
+	return nil, fmt.Errorf("unknown placement strategy %v", name)
+}
+
+/*
+Fragmentation returns the fraction of free CPUs in dc that cannot be used by tasks requiring *cost* CPUs,
+because they are spread over nodes without enough free CPUs.
+*/
+func Fragmentation(dc DataCenter, cost int) float64 {
+	free := dc.JobAvailability(1)
+	if free == 0 {
+		return 0
+	}
+	return 1 - float64(dc.JobAvailability(cost)*cost)/float64(free)
+}
@@ -0,0 +1,109 @@
+package topology
+
+import (
+	"testing"
+
+	"github.com/dsfalves/gdsim/network"
+)
+
+func placementNodes(free ...int) []*Node {
+	nodes := make([]*Node, len(free))
+	for i, f := range free {
+		nodes[i] = NewNode(8, 0)
+		nodes[i].freeCpus = f
+	}
+	return nodes
+}
+
+func TestPlacementSelect(t *testing.T) {
+	nodes := placementNodes(1, 6, 3, 8)
+	task := sampleTask{end: 10, cpus: 2}
+	tests := []struct {
+		name      string
+		placement Placement
+		expected  int
+	}{
+		{"first", FirstFit{}, 1},
+		{"best", BestFit{}, 2},
+		{"worst", WorstFit{}, 3},
+	}
+	for _, test := range tests {
+		if n := test.placement.Select(nodes, task); n != nodes[test.expected] {
+			t.Errorf("expected %s placement to select node %d, found %p", test.name, test.expected, n)
+		}
+	}
+
+	big := sampleTask{end: 10, cpus: 9}
+	for _, test := range tests {
+		if n := test.placement.Select(nodes, big); n != nil {
+			t.Errorf("expected %s placement to select no node, found %p", test.name, n)
+		}
+	}
+}
+
+func TestPlacementMemory(t *testing.T) {
+	nodes := placementNodes(2, 4, 4, 8)
+	for i, free := range []int{1000, 3000, 2000, 500} {
+		nodes[i].memory, nodes[i].freeMemory = 4000, free
+	}
+	task := sampleTask{end: 10, cpus: 2, memory: 1500}
+	// node 0 has the fewest free CPUs and node 3 the most, but neither has enough memory
+	if n := (BestFit{}).Select(nodes, task); n != nodes[2] {
+		t.Errorf("expected best fit to select node 2, found %p", n)
+	}
+	if n := (WorstFit{}).Select(nodes, task); n != nodes[1] {
+		t.Errorf("expected worst fit to select node 1, found %p", n)
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	nodes := placementNodes(2, 0, 2)
+	task := sampleTask{end: 10, cpus: 1}
+	rr := &RoundRobin{}
+	for _, expected := range []int{0, 2, 0, 2} {
+		if n := rr.Select(nodes, task); n != nodes[expected] {
+			t.Errorf("expected round robin to select node %d, found %p", expected, n)
+		}
+	}
+}
+
+func TestRandomFit(t *testing.T) {
+	nodes := placementNodes(0, 4, 0, 4)
+	task := sampleTask{end: 10, cpus: 2}
+	r1, r2 := NewRandomFit(7), NewRandomFit(7)
+	for i := 0; i < 10; i++ {
+		n := r1.Select(nodes, task)
+		if n != nodes[1] && n != nodes[3] {
+			t.Fatalf("expected random placement to select a node with free CPUs, found %p", n)
+		}
+		if m := r2.Select(nodes, task); m != n {
+			t.Fatalf("expected random placement with equal seeds to match, found %p and %p", n, m)
+		}
+	}
+}
+
+func TestFragmentation(t *testing.T) {
+	cap := [][2]int{
+		{2, 4},
+	}
+	speed := [][]uint64{
+		{0},
+	}
+	nw := network.NewSimpleNetwork()
+	topo, err := NewFifo(cap, speed, &nw)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	dc := topo.DataCenters[0]
+	if f := Fragmentation(dc, 4); f != 0 {
+		t.Errorf("expected Fragmentation(dc, 4) == 0 on idle data center, found %v", f)
+	}
+	dc.Get(0).freeCpus = 2
+	dc.Get(1).freeCpus = 2
+	if f := Fragmentation(dc, 4); f != 1 {
+		t.Errorf("expected Fragmentation(dc, 4) == 1, found %v", f)
+	}
+	if f := Fragmentation(dc, 2); f != 0 {
+		t.Errorf("expected Fragmentation(dc, 2) == 0, found %v", f)
+	}
+}
@@ -0,0 +1,93 @@
+package topology
+
+import (
+	"container/heap"
+
+	"github.com/dsfalves/gdsim/scheduler/event"
+)
+
+// Preemptible is implemented by running tasks that can be interrupted before they end
+type Preemptible interface {
+	RunningTask
+	// Preempted informs the task that it stopped running at time now
+	Preempted(now uint64)
+}
+
+/*
+preemptedTask takes the place of a preempted task in the heap of its node.
+It keeps the original ending time, so the node's time does not change while the node
+is waiting in the event heap, but it uses no resources.
+*/
+type preemptedTask struct {
+	end uint64
+}
+
+func (t preemptedTask) End() uint64            { return t.end }
+func (t preemptedTask) Cpus() int              { return 0 }
+func (t preemptedTask) Memory() int            { return 0 }
+func (t preemptedTask) SetStart(start uint64)  {}
+func (t preemptedTask) SetWhere(where int)     {}
+func (t preemptedTask) SetSpeed(speed float64) {}
+func (t preemptedTask) Process() []event.Event { return nil }
+
+/*
+Preempt stops task if it is running in n, releasing its resources at time now.
+Returns false if task is not running in n or cannot be preempted.
+Tasks waiting in the data center queue are not started as a consequence of preemption;
+the freed resources are meant to be used by the caller.
+*/
+func (n *Node) Preempt(now uint64, task RunningTask) bool {
+	p, ok := task.(Preemptible)
+	if !ok {
+		return false
+	}
+	for i, t := range n.heap {
+		if t == task {
+			n.heap[i] = preemptedTask{end: t.End()}
+			heap.Fix(&n.heap, i)
+			n.Free(t.Cpus())
+			if n.memory > 0 {
+				n.freeMemory += t.Memory()
+			}
+			p.Preempted(now)
+			logger.Debugf("%p.Preempt(%v): preempted task ending at %d", n, now, t.End())
+			return true
+		}
+	}
+	return false
+}
+
+// RunningTasks returns the tasks currently running in n.
+func (n *Node) RunningTasks() []RunningTask {
+	tasks := make([]RunningTask, 0, len(n.heap))
+	for _, task := range n.heap {
+		if _, ok := task.(preemptedTask); !ok {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// RunningTasks returns the tasks currently running in all nodes of dc.
+func (dc FifoDataCenter) RunningTasks() []RunningTask {
+	tasks := make([]RunningTask, 0)
+	for _, n := range dc.nodes {
+		tasks = append(tasks, n.RunningTasks()...)
+	}
+	return tasks
+}
+
+// QueuedTasks returns the tasks hosted in dc that are waiting in its queue for a node.
+func (dc FifoDataCenter) QueuedTasks() []RunningTask {
+	return append([]RunningTask{}, dc.queue...)
+}
+
+// Preempt stops task if it is running in any node of dc.
+func (dc *FifoDataCenter) Preempt(now uint64, task RunningTask) bool {
+	for _, n := range dc.nodes {
+		if n.Preempt(now, task) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package topology
+
+import (
+	"testing"
+
+	"github.com/dsfalves/gdsim/scheduler/event"
+)
+
+// dummy preemptible task to be used in tests
+type samplePreemptible struct {
+	sampleTask
+	preempted uint64
+}
+
+func (t *samplePreemptible) Preempted(now uint64) { t.preempted = now }
+
+func TestNodePreempt(t *testing.T) {
+	n := NewNode(4, 0)
+	n.memory, n.freeMemory = 100, 100
+	t1 := &samplePreemptible{sampleTask: sampleTask{end: 10, cpus: 2, memory: 50}}
+	t2 := &samplePreemptible{sampleTask: sampleTask{end: 20, cpus: 1}}
+	t3 := sampleTask{end: 30, cpus: 1}
+	n.Host(t1)
+	n.Host(t2)
+	n.Host(t3)
+
+	if n.Preempt(5, t3) {
+		t.Errorf("expected n.Preempt() of a task that is not Preemptible to fail")
+	}
+	if !n.Preempt(5, t1) {
+		t.Fatalf("expected n.Preempt() = true, found false")
+	}
+	if t1.preempted != 5 {
+		t.Errorf("expected task to be preempted at 5, found %d", t1.preempted)
+	}
+	if n.freeCpus != 2 || n.freeMemory != 100 {
+		t.Errorf("expected 2 free CPUs and 100 MB after preemption, found %d and %d", n.freeCpus, n.freeMemory)
+	}
+	if n.Preempt(6, t1) {
+		t.Errorf("expected second n.Preempt() of the same task to fail")
+	}
+	if l := len(n.RunningTasks()); l != 2 {
+		t.Errorf("expected 2 running tasks, found %d", l)
+	}
+	if time := n.Time(); time != 10 {
+		t.Errorf("expected node time to remain 10 after preemption, found %d", time)
+	}
+
+	var events []event.Event
+	for n.QueueLen() > 0 {
+		events = n.Process()
+	}
+	if len(events) != 0 || n.freeCpus != 4 {
+		t.Errorf("expected node to be free after processing all tasks, found %d free CPUs", n.freeCpus)
+	}
+}
@@ -0,0 +1,50 @@
+package topology
+
+// Day is the length of a day in seconds, over which time-of-day prices repeat
+const Day = 24 * 60 * 60
+
+// Priced is implemented by data centers that charge for the use of their CPUs
+type Priced interface {
+	// ComputeCost returns the price in dollars of using cpus CPUs from time start to end, in seconds
+	ComputeCost(cpus int, start, end uint64) float64
+}
+
+/*
+SetPrices sets the compute price of dc in dollars per core-hour. The day is split in len(prices)
+periods of equal length, each with its own price, so a single price applies at all times.
+*/
+func (dc *FifoDataCenter) SetPrices(prices []float64) {
+	dc.prices = prices
+}
+
+/*
+ComputeCost returns the price in dollars of using cpus CPUs of dc from time start to end,
+following the price of each period of the day. Data centers without prices are free.
+*/
+func (dc FifoDataCenter) ComputeCost(cpus int, start, end uint64) float64 {
+	if len(dc.prices) == 0 || end <= start {
+		return 0
+	}
+	period := uint64(Day / len(dc.prices))
+	var coreSeconds float64
+	for t := start; t < end; {
+		next := (t/period + 1) * period
+		if next > end {
+			next = end
+		}
+		coreSeconds += float64(next-t) * dc.prices[(t/period)%uint64(len(dc.prices))]
+		t = next
+	}
+	return coreSeconds * float64(cpus) / 3600
+}
+
+/*
+EgressCost returns the price in dollars of sending size bytes from the data center with index from
+to the one with index to. Transfers within a data center, and topologies without egress prices, are free.
+*/
+func (topo Topology) EgressCost(size uint64, from, to int) float64 {
+	if from == to || len(topo.Egress) == 0 {
+		return 0
+	}
+	return float64(size) / 1e9 * topo.Egress[from][to]
+}
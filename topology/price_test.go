@@ -0,0 +1,56 @@
+package topology
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/dsfalves/gdsim/network"
+)
+
+func TestComputeCost(t *testing.T) {
+	var dc FifoDataCenter
+	if cost := dc.ComputeCost(4, 0, 3600); cost != 0 {
+		t.Errorf("expected data center without prices to be free, found %v", cost)
+	}
+	dc.SetPrices([]float64{0.04, 0.02})
+	tests := []struct {
+		cpus       int
+		start, end uint64
+		expected   float64
+	}{
+		{1, 0, 3600, 0.04},
+		{2, Day/2 - 3600, Day/2 + 3600, 0.12},
+		{1, Day - 1800, Day + 1800, 0.03},
+		{1, 100, 100, 0},
+	}
+	for _, test := range tests {
+		if cost := dc.ComputeCost(test.cpus, test.start, test.end); math.Abs(cost-test.expected) > 1e-9 {
+			t.Errorf("expected %d cores from %d to %d to cost %v, found %v", test.cpus, test.start, test.end, test.expected, cost)
+		}
+	}
+}
+
+func TestLoadPrices(t *testing.T) {
+	sample := "2\n2 1\n1 4\n1000 99\n99 1000\nprices 2\n0.04 0.02\n0.1 0.1\negress\n0 0.05\n0.08 0\n"
+	nw := network.NewSimpleNetwork()
+	topo, err := LoadFifo(strings.NewReader(sample), &nw)
+	if err != nil {
+		t.Fatalf("error '%v' while processing topology '%v', expected nil", err, sample)
+	}
+	if cost := topo.DataCenters[1].(Priced).ComputeCost(1, Day/2, Day/2+3600); math.Abs(cost-0.1) > 1e-9 {
+		t.Errorf("expected an hour of DC1 to cost 0.1, found %v", cost)
+	}
+	if cost := topo.EgressCost(2e9, 1, 0); math.Abs(cost-0.16) > 1e-9 {
+		t.Errorf("expected 2GB from DC1 to DC0 to cost 0.16, found %v", cost)
+	}
+	status, err := nw.Status("DC0", "DC1")
+	if err != nil || math.Abs(status.Cost*1e9-0.05) > 1e-9 {
+		t.Errorf("expected egress price from DC0 to DC1 to be set in the network, found %v (%v)", status.Cost, err)
+	}
+	for _, bad := range []string{"1\n1 1\n0\nprices 0\n", "1\n1 1\n0\nprices 2\n0.1\n", "1\n1 1\n0\negress\n"} {
+		if _, err := LoadFifo(strings.NewReader(bad), &nw); err == nil {
+			t.Errorf("expected error for topology '%v', found nil", bad)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package topology
+
+// Snapshotter is implemented by data centers that can copy their current state
+type Snapshotter interface {
+	// Snapshot returns a data center whose resources and running tasks are those of the original one when copied
+	Snapshot() DataCenter
+}
+
+/*
+Snapshot copies the nodes of dc, with their free resources and running tasks, so the copy keeps answering
+for the state of dc at this time. The copy shares the storage of dc, and must not host tasks.
+*/
+func (dc FifoDataCenter) Snapshot() DataCenter {
+	nodes := make([]*Node, len(dc.nodes))
+	for i, n := range dc.nodes {
+		copied := *n
+		copied.heap = append(taskHeap(nil), n.heap...)
+		nodes[i] = &copied
+	}
+	return &FifoDataCenter{
+		id:        dc.id,
+		nodes:     nodes,
+		container: dc.container,
+		nodeMax:   dc.nodeMax,
+		placement: dc.placement,
+		prices:    dc.prices,
+	}
+}
+
+// Hostable returns whether dc has capacity for task, even if not free at the moment.
+func Hostable(dc DataCenter, task RunningTask) bool {
+	return dc.Capacity(minimum(task)) > 0
+}
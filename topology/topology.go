@@ -1,27 +1,37 @@
 package topology
 
 import (
+	"bufio"
 	"container/heap"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
 
 	"github.com/dsfalves/gdsim/log"
+	"github.com/dsfalves/gdsim/metrics"
 	"github.com/dsfalves/gdsim/network"
 	"github.com/dsfalves/gdsim/scheduler/event"
 	"github.com/google/go-cmp/cmp"
 )
 
 var logger log.Context
+var stats metrics.Context
 
 func init() {
 	logger = log.New("topology")
+	stats = metrics.New("topology")
 }
 
 type RunningTask interface {
 	End() uint64
 	Cpus() int
+	// Memory returns the memory required by the task, in MB
+	Memory() int
 	SetStart(start uint64)
 	SetWhere(where int)
+	// SetSpeed informs the task of the relative CPU speed of the node hosting it
+	SetSpeed(speed float64)
 	Process() []event.Event
 }
 
@@ -37,6 +47,9 @@ type Database interface {
 
 	// Record will update the database to store that the file with given id can be found at the given location
 	Record(fileId, locationId string)
+
+	// Remove will update the database to store that the file with given id is no longer at the given location
+	Remove(fileId, locationId string)
 }
 
 // Container is an interface to model storage for data
@@ -45,7 +58,7 @@ type Container interface {
 	Has(id string) bool
 	Find(id string) Data
 	Pop(id string) Data
-	Transfer(when uint64, id string, data Data, consequence func(time uint64) []event.Event) []event.Event
+	Transfer(when uint64, id string, data Data, consequence func(time uint64) []event.Event) ([]event.Event, error)
 	SetNetwork(network network.Network)
 	SetDatabase(db Database)
 }
@@ -55,14 +68,23 @@ type DataCenter interface {
 	Dequeue(now uint64, calling *Node) []event.Event
 	JobCapacity(cost int) int
 	JobAvailability(cost int) int
+	Capacity(demand Resources) int
+	Availability(demand Resources) int
+	TotalResources() Resources
+	FreeResources() Resources
 	ExpectedEndings() []uint64
+	RunningTasks() []RunningTask
+	QueuedTasks() []RunningTask
 	Host(task RunningTask) (*Node, bool)
+	Accepts(task RunningTask) bool
+	Preempt(now uint64, task RunningTask) bool
 	Equal(otherDc DataCenter) bool
 	Container() Container
 	AddContainer(container Container)
 	NumNodes() int
 	Nodes() []*Node
 	Id() string
+	SetPlacement(placement Placement)
 
 	// this function meant for testing
 	Get(n int) *Node
@@ -94,12 +116,78 @@ func (h *taskHeap) Pop() interface{} {
 	return x
 }
 
+// Malleable is implemented by running tasks that can run with fewer CPUs than requested
+type Malleable interface {
+	RunningTask
+	// MinCpus returns the least number of CPUs the task can run with
+	MinCpus() int
+	// Resize sets the number of CPUs the task will run with, which must be at least MinCpus
+	Resize(cpus int)
+}
+
+// Finisher is implemented by running tasks that cause events when they end
+type Finisher interface {
+	RunningTask
+	// Finished informs the task that it ended at time now in data center dc, and returns the events it causes
+	Finished(now uint64, dc DataCenter) []event.Event
+}
+
+/*
+Returns the least resources task can run with.
+*/
+func minimum(task RunningTask) Resources {
+	least := Resources{Cpus: task.Cpus(), Memory: task.Memory()}
+	if m, ok := task.(Malleable); ok && m.MinCpus() > 0 && m.MinCpus() < least.Cpus {
+		least.Cpus = m.MinCpus()
+	}
+	return least
+}
+
+// Resources describes an amount of each schedulable resource
+type Resources struct {
+	Cpus int
+	// Memory in MB; 0 means that memory is not limited or not required
+	Memory int
+}
+
+/*
+DominantShare returns the largest fraction of total that demand requires of any single resource.
+Resources with zero total are ignored.
+*/
+func DominantShare(demand, total Resources) float64 {
+	share := 0.0
+	if total.Cpus > 0 {
+		share = float64(demand.Cpus) / float64(total.Cpus)
+	}
+	if total.Memory > 0 {
+		if memShare := float64(demand.Memory) / float64(total.Memory); memShare > share {
+			share = memShare
+		}
+	}
+	return share
+}
+
 type Node struct {
-	Location   int
-	freeCpus   int
-	capacity   int
-	heap       taskHeap
-	datacenter DataCenter
+	Location    int
+	freeCpus    int
+	capacity    int
+	freeMemory  int
+	memory      int     /* memory capacity in MB, 0 if not limited */
+	speed       float64 /* relative CPU speed, 1 is the reference */
+	idleWatts   float64 /* power drawn by each idle core */
+	activeWatts float64 /* power drawn by each core running a task */
+	draining    bool    /* takes no new tasks, and leaves its data center once its tasks end */
+	heap        taskHeap
+	datacenter  DataCenter
+}
+
+// NodeGroup describes a set of identical computers in a data center
+type NodeGroup struct {
+	Computers, Cores int
+	// Memory is the memory of each computer in MB, 0 if not limited
+	Memory int
+	// Speed is the CPU speed relative to a reference computer; tasks take Duration/Speed to run
+	Speed float64
 }
 
 type FifoDataCenter struct {
@@ -110,6 +198,10 @@ type FifoDataCenter struct {
 	queue     taskHeap
 	/* tasks that have been assigned to this data center but
 	   cannot be scheduled yet */
+	placement Placement
+	prices    []float64 /* compute price in dollars per core-hour for each period of the day */
+	incoming  int       /* computers to be added by capacity changes not processed yet */
+	scaled    bool      /* an autoscaler adds nodes when tasks wait */
 }
 
 func (dc FifoDataCenter) Id() string {
@@ -124,6 +216,36 @@ func (dc *FifoDataCenter) AddContainer(container Container) {
 	dc.container = container
 }
 
+func (dc *FifoDataCenter) SetPlacement(placement Placement) {
+	dc.placement = placement
+}
+
+/*
+Selects a node for task using the data center's placement strategy and hosts it there.
+If no node has enough free CPUs and the task is malleable, it is hosted with fewer CPUs
+in the node with the most free CPUs.
+Returns nil if no node can currently host task.
+*/
+func (dc *FifoDataCenter) place(task RunningTask) *Node {
+	if n := dc.placement.Select(dc.nodes, task); n != nil && n.Host(task) {
+		return n
+	}
+	m, ok := task.(Malleable)
+	if !ok {
+		return nil
+	}
+	var best *Node
+	for _, n := range dc.nodes {
+		if n.canHostReduced(m) && (best == nil || n.freeCpus > best.freeCpus) {
+			best = n
+		}
+	}
+	if best == nil || !best.HostReduced(m) {
+		return nil
+	}
+	return best
+}
+
 func (dc *FifoDataCenter) NumNodes() int {
 	return len(dc.nodes)
 }
@@ -136,16 +258,58 @@ func (dc *FifoDataCenter) Nodes() []*Node {
 Returns how many jobs requiring *cost* CPU slots a data center can host at most.
 */
 func (dc FifoDataCenter) JobCapacity(cost int) int {
-	return (dc.nodes[0].capacity / cost) * len(dc.nodes)
+	return dc.Capacity(Resources{Cpus: cost})
 }
 
 /*
 Returns how many jobs requiring *cost* CPU slots a data center can currently host
 given available free space.
 */
-func (dc FifoDataCenter) JobAvailability(cost int) (free int) {
+func (dc FifoDataCenter) JobAvailability(cost int) int {
+	return dc.Availability(Resources{Cpus: cost})
+}
+
+/*
+Returns how many tasks requiring *demand* resources a data center can host at most.
+*/
+func (dc FifoDataCenter) Capacity(demand Resources) (total int) {
+	for _, n := range dc.nodes {
+		total += n.count(demand, n.capacity, n.memory)
+	}
+	return total
+}
+
+/*
+Returns how many tasks requiring *demand* resources a data center can currently host
+given available free resources.
+*/
+func (dc FifoDataCenter) Availability(demand Resources) (free int) {
+	for _, n := range dc.nodes {
+		free += n.count(demand, n.freeCpus, n.freeMemory)
+	}
+	return free
+}
+
+// TotalResources returns the sum of the resources of all nodes in dc.
+func (dc FifoDataCenter) TotalResources() (total Resources) {
+	for _, n := range dc.nodes {
+		if n.draining {
+			continue
+		}
+		total.Cpus += n.capacity
+		total.Memory += n.memory
+	}
+	return total
+}
+
+// FreeResources returns the sum of the free resources of all nodes in dc.
+func (dc FifoDataCenter) FreeResources() (free Resources) {
 	for _, n := range dc.nodes {
-		free += n.freeCpus / cost
+		if n.draining {
+			continue
+		}
+		free.Cpus += n.freeCpus
+		free.Memory += n.freeMemory
 	}
 	return free
 }
@@ -167,7 +331,10 @@ func (dc FifoDataCenter) Get(n int) *Node {
 func (dc FifoDataCenter) ExpectedEndings() []uint64 {
 	endings := make([]uint64, 0)
 	for _, node := range dc.nodes {
-		for _, task := range node.heap {
+		if node.draining {
+			continue // their tasks do not free resources for other tasks
+		}
+		for _, task := range node.RunningTasks() {
 			endings = append(endings, task.End())
 		}
 	}
@@ -189,7 +356,7 @@ func (dc FifoDataCenter) Equal(otherDc DataCenter) bool {
 	// TODO: this assumes that the order of the nodes was not changed
 	// it will possible require a fix
 	for i := range dc.nodes {
-		if dc.nodes[i].freeCpus != other.nodes[i].freeCpus {
+		if dc.nodes[i].freeCpus != other.nodes[i].freeCpus || dc.nodes[i].freeMemory != other.nodes[i].freeMemory {
 			return false
 		}
 	}
@@ -202,23 +369,20 @@ func (dc *FifoDataCenter) Enqueue(rt RunningTask) {
 
 func (dc *FifoDataCenter) Dequeue(now uint64, calling *Node) []event.Event {
 	events := make([]event.Event, 0)
+	if calling != nil && calling.draining && len(calling.RunningTasks()) == 0 {
+		dc.remove(calling)
+	}
 	for dc.queue.Len() > 0 {
 		task := dc.queue.Top()
 		task.SetStart(now)
-		success := false
-		for _, n := range dc.nodes {
-			if n.Host(task) {
-				heap.Pop(&dc.queue)
-				success = true
-				if n != calling && n.QueueLen() == 1 {
-					events = append(events, n)
-				}
-				break
-			}
-		}
-		if !success {
+		n := dc.place(task)
+		if n == nil {
 			break
 		}
+		heap.Pop(&dc.queue)
+		if n != calling && n.QueueLen() == 1 {
+			events = append(events, n)
+		}
 	}
 	return events
 }
@@ -226,6 +390,9 @@ func (dc *FifoDataCenter) Dequeue(now uint64, calling *Node) []event.Event {
 type Topology struct {
 	DataCenters []DataCenter
 	Speeds      [][]uint64
+	Storage     []uint64        /* storage capacity of each data center in bytes, 0 if not limited */
+	Egress      [][]float64     /* price in dollars per GB sent between data centers, nil if free */
+	Carbon      CarbonIntensity /* carbon intensity of the electricity of each data center, nil if unknown */
 }
 
 // NewFifo creates a new topology using FIFO scheduling in all data centers.
@@ -233,32 +400,44 @@ type Topology struct {
 // speed holds the bandwidth between datacenters
 // nw is the network that will be used to connect the data centers
 func NewFifo(capacity [][2]int, speeds [][]uint64, nw network.Network) (*Topology, error) {
+	groups := make([][]NodeGroup, len(capacity))
+	for i, dc := range capacity {
+		groups[i] = []NodeGroup{{Computers: dc[0], Cores: dc[1], Speed: 1}}
+	}
+	return NewFifoGroups(groups, speeds, nw)
+}
+
+// NewFifoGroups creates a new topology using FIFO scheduling in all data centers,
+// where each data center may mix computers with different number of cores and speed.
+// groups holds the node groups of each data center
+// speed holds the bandwidth between datacenters
+// nw is the network that will be used to connect the data centers
+func NewFifoGroups(groups [][]NodeGroup, speeds [][]uint64, nw network.Network) (*Topology, error) {
 	var topo Topology
-	topo.DataCenters = make([]DataCenter, len(capacity))
-	topo.Speeds = make([][]uint64, len(capacity))
-	if len(speeds) != len(capacity) {
-		return nil, fmt.Errorf("len(capacity)=%d != len(speeds)=%d", len(capacity), len(speeds))
+	topo.DataCenters = make([]DataCenter, len(groups))
+	topo.Speeds = make([][]uint64, len(groups))
+	topo.Storage = make([]uint64, len(groups))
+	if len(speeds) != len(groups) {
+		return nil, fmt.Errorf("len(groups)=%d != len(speeds)=%d", len(groups), len(speeds))
 	}
-	for i, dc := range capacity {
-		nNodes := dc[0]
-		nCpus := dc[1]
-		n := make([]*Node, nNodes)
+	for i, dcGroups := range groups {
 		dc := &FifoDataCenter{
-			id:      i,
-			nodes:   n,
-			nodeMax: nCpus,
+			id:        i,
+			nodes:     make([]*Node, 0),
+			placement: FirstFit{},
 		}
-		for k := range dc.nodes {
-			dc.nodes[k] = NewNode(nCpus, i)
-			dc.nodes[k].datacenter = dc
+		for _, group := range dcGroups {
+			if _, err := dc.AddNodes(group); err != nil {
+				return nil, fmt.Errorf("data center %d: %v", i, err)
+			}
 		}
 		topo.DataCenters[i] = dc
-		if len(speeds[i]) != len(capacity) {
-			return nil, fmt.Errorf("len(capacity)=%d != len(speeds[%d])=%d", len(capacity), i, len(speeds))
+		if len(speeds[i]) != len(groups) {
+			return nil, fmt.Errorf("len(groups)=%d != len(speeds[%d])=%d", len(groups), i, len(speeds[i]))
 		}
 	}
-	for i := range capacity {
-		topo.Speeds[i] = make([]uint64, len(capacity))
+	for i := range groups {
+		topo.Speeds[i] = make([]uint64, len(groups))
 		for k := range speeds[i] {
 			topo.Speeds[i][k] = speeds[i][k]
 			// TODO: the delay is hardcoded at 10ms until I find better values
@@ -268,34 +447,87 @@ func NewFifo(capacity [][2]int, speeds [][]uint64, nw network.Network) (*Topolog
 	return &topo, nil
 }
 
+/*
+Parses the description of the node groups of a data center.
+Groups are separated by commas, and each group has the number of computers,
+the number of cores in each computer and, optionally, their relative speed
+and their memory in MB.
+*/
+func parseGroups(line string) ([]NodeGroup, error) {
+	groups := make([]NodeGroup, 0)
+	for _, description := range strings.Split(line, ",") {
+		words := strings.Fields(description)
+		if len(words) < 2 || len(words) > 4 {
+			return nil, fmt.Errorf("expected 2 to 4 elements in node group, found %d", len(words))
+		}
+		group := NodeGroup{Speed: 1}
+		var err error
+		if group.Computers, err = strconv.Atoi(words[0]); err != nil {
+			return nil, err
+		}
+		if group.Cores, err = strconv.Atoi(words[1]); err != nil {
+			return nil, err
+		}
+		if len(words) >= 3 {
+			if group.Speed, err = strconv.ParseFloat(words[2], 64); err != nil {
+				return nil, err
+			}
+		}
+		if len(words) == 4 {
+			if group.Memory, err = strconv.Atoi(words[3]); err != nil {
+				return nil, err
+			}
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
 func LoadFifo(topoInfo io.Reader, nw network.Network) (*Topology, error) {
 	var size int
 
-	n, err := fmt.Fscan(topoInfo, &size)
+	scanner := bufio.NewScanner(topoInfo)
+	nextLine := func() (string, bool) {
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				return line, true
+			}
+		}
+		return "", false
+	}
+
+	line, ok := nextLine()
+	if !ok {
+		return nil, fmt.Errorf("failure to read topology: size error: missing size")
+	}
+	n, err := fmt.Sscan(line, &size)
 	if err != nil {
 		return nil, fmt.Errorf("failure to read topology: size error: %v", err)
 	} else if n != 1 {
 		return nil, fmt.Errorf("failure to read topology: size error: missing size")
 	}
 
-	capacity := make([][2]int, size)
+	groups := make([][]NodeGroup, size)
 	for i := 0; i < size; i++ {
-		n, err := fmt.Fscan(topoInfo, &capacity[i][0], &capacity[i][1])
-		if err != nil {
-			return nil, fmt.Errorf("failure to read topology: data center %v: %v", i, err)
-		} else if n != 2 {
+		line, ok := nextLine()
+		if !ok {
 			return nil, fmt.Errorf("failure to read topology: data center %v: missing elements in capacity line", i)
 		}
+		if groups[i], err = parseGroups(line); err != nil {
+			return nil, fmt.Errorf("failure to read topology: data center %v: %v", i, err)
+		}
+	}
+	var rest strings.Builder
+	for line, ok := nextLine(); ok; line, ok = nextLine() {
+		rest.WriteString(line)
+		rest.WriteString("\n")
 	}
+	restInfo := strings.NewReader(rest.String())
 	speeds := make([][]uint64, size)
 	for i := 0; i < size; i++ {
 		speeds[i] = make([]uint64, size)
-		/*_, err := fmt.Fscanf(topoInfo, "\n")
-		if err != nil {
-			return nil, fmt.Errorf("failure to read topology: speeds %v: %v", i, err)
-		}*/
 		for k := 0; k < size; k++ {
-			n, err := fmt.Fscan(topoInfo, &speeds[i][k])
+			n, err := fmt.Fscan(restInfo, &speeds[i][k])
 			if n != 1 {
 				return nil, fmt.Errorf("failure to read topology: speeds %v: missing speeds", i)
 			} else if err != nil {
@@ -305,31 +537,180 @@ func LoadFifo(topoInfo io.Reader, nw network.Network) (*Topology, error) {
 	}
 	// TODO: inspect here for proper validation of speeds
 
-	return NewFifo(capacity, speeds, nw)
+	topo, err := NewFifoGroups(groups, speeds, nw)
+	if err != nil {
+		return nil, err
+	}
+	if err := loadSections(restInfo, topo); err != nil {
+		return nil, fmt.Errorf("failure to read topology: %v", err)
+	}
+	if priced, ok := nw.(network.Priced); ok && topo.Egress != nil {
+		for i, from := range topo.DataCenters {
+			for k, to := range topo.DataCenters {
+				if err := priced.SetCost(from.Id(), to.Id(), topo.Egress[i][k]/1e9); err != nil {
+					return nil, fmt.Errorf("failure to read topology: egress %v: %v", i, err)
+				}
+			}
+		}
+	}
+	return topo, nil
+}
+
+/*
+Reads the optional sections that may follow the bandwidth matrix in a topology description.
+Each section starts with its name, followed by its values:
+"storage" is followed by the storage capacity of each data center,
+"prices" by the number of periods in a day and the compute price of each data center in each period,
+"egress" by the matrix of prices to send data between data centers,
+and "power" by the watts drawn by each idle core and by each busy core in each data center.
+*/
+func loadSections(info io.Reader, topo *Topology) error {
+	size := len(topo.DataCenters)
+	for {
+		var section string
+		if n, _ := fmt.Fscan(info, &section); n == 0 {
+			return nil
+		}
+		switch section {
+		case "storage":
+			for i := 0; i < size; i++ {
+				if n, err := fmt.Fscan(info, &topo.Storage[i]); n != 1 {
+					return fmt.Errorf("storage %v: %v", i, err)
+				}
+			}
+		case "prices":
+			var periods int
+			if n, err := fmt.Fscan(info, &periods); n != 1 {
+				return fmt.Errorf("prices: %v", err)
+			} else if periods < 1 || periods > Day {
+				return fmt.Errorf("prices: invalid number of periods %v", periods)
+			}
+			for i, dc := range topo.DataCenters {
+				prices := make([]float64, periods)
+				for k := range prices {
+					if n, err := fmt.Fscan(info, &prices[k]); n != 1 {
+						return fmt.Errorf("prices %v: %v", i, err)
+					}
+				}
+				if fifo, ok := dc.(*FifoDataCenter); ok {
+					fifo.SetPrices(prices)
+				}
+			}
+		case "power":
+			for i, dc := range topo.DataCenters {
+				var idle, active float64
+				if n, err := fmt.Fscan(info, &idle, &active); n != 2 {
+					return fmt.Errorf("power %v: %v", i, err)
+				}
+				for _, n := range dc.Nodes() {
+					n.SetPower(idle, active)
+				}
+			}
+		case "egress":
+			topo.Egress = make([][]float64, size)
+			for i := range topo.Egress {
+				topo.Egress[i] = make([]float64, size)
+				for k := range topo.Egress[i] {
+					if n, err := fmt.Fscan(info, &topo.Egress[i][k]); n != 1 {
+						return fmt.Errorf("egress %v: %v", i, err)
+					}
+				}
+			}
+		default:
+			return fmt.Errorf("unknown section %v", section)
+		}
+	}
 }
 
 func NewNode(capacity int, location int) *Node {
 	var n Node
 	n.freeCpus = capacity
 	n.capacity = capacity
+	n.speed = 1
 	n.Location = location
 	n.heap = NewTaskHeap()
 	heap.Init(&n.heap)
 	return &n
 }
 
+// Fits returns whether n currently has enough free resources to host task.
+func (n *Node) Fits(task RunningTask) bool {
+	return !n.draining && task.Cpus() <= n.freeCpus && (n.memory == 0 || task.Memory() <= n.freeMemory)
+}
+
+/*
+Returns how many tasks requiring demand fit in the given amount of cpus and memory of n.
+Memory is ignored if either n or demand do not use it.
+Draining nodes fit no tasks.
+*/
+func (n *Node) count(demand Resources, cpus, memory int) int {
+	if n.draining {
+		return 0
+	}
+	fit := -1
+	if demand.Cpus > 0 {
+		fit = cpus / demand.Cpus
+	}
+	if demand.Memory > 0 && n.memory > 0 {
+		if m := memory / demand.Memory; fit < 0 || m < fit {
+			fit = m
+		}
+	}
+	if fit < 0 {
+		return 0
+	}
+	return fit
+}
+
 func (n *Node) Host(task RunningTask) bool {
-	if task.Cpus() <= n.freeCpus {
+	if n.Fits(task) {
 		task.SetWhere(n.Location)
+		task.SetSpeed(n.speed)
 		task.Process()
 		n.freeCpus -= task.Cpus()
+		if n.memory > 0 {
+			n.freeMemory -= task.Memory()
+		}
 		heap.Push(&n.heap, task)
 		return true
-	} // TODO: add else case to allow running with less CPUs than requested
-	logger.Debugf("node failed to host task with %d CPUS: available capacity is %d", task.Cpus(), n.freeCpus)
+	} // tasks that can run with less CPUs than requested are hosted with HostReduced
+	logger.Debugf("node failed to host task with %d CPUS and %d MB: available capacity is %d CPUS and %d MB", task.Cpus(), task.Memory(), n.freeCpus, n.freeMemory)
 	return false
 }
 
+/*
+Returns whether n has enough free resources to host task with fewer CPUs than requested.
+*/
+func (n *Node) canHostReduced(task Malleable) bool {
+	least := minimum(task)
+	return !n.draining && least.Cpus <= n.freeCpus && (n.memory == 0 || least.Memory <= n.freeMemory)
+}
+
+/*
+HostReduced hosts a malleable task using all free CPUs of n, up to the number of CPUs the task requested.
+Returns false if n does not have the minimum resources the task requires.
+*/
+func (n *Node) HostReduced(task Malleable) bool {
+	if !n.canHostReduced(task) {
+		logger.Debugf("node failed to host task with at least %d CPUS: available capacity is %d CPUS", task.MinCpus(), n.freeCpus)
+		return false
+	}
+	if task.Cpus() > n.freeCpus {
+		task.Resize(n.freeCpus)
+	}
+	return n.Host(task)
+}
+
+// Speed returns the CPU speed of n relative to the reference computer.
+func (n *Node) Speed() float64 {
+	return n.speed
+}
+
+// Cores returns the number of cores of n.
+func (n *Node) Cores() int {
+	return n.capacity
+}
+
 func (n *Node) Free(cpus int) {
 	n.freeCpus += cpus
 }
@@ -343,9 +724,15 @@ func (n *Node) Process() []event.Event {
 	now := n.Time()
 	t := heap.Pop(&n.heap).(RunningTask)
 	n.Free(t.Cpus())
+	if n.memory > 0 {
+		n.freeMemory += t.Memory()
+	}
 	var events []event.Event
 	if n.datacenter != nil {
 		events = n.datacenter.Dequeue(now, n)
+		if f, ok := t.(Finisher); ok {
+			events = append(events, f.Finished(now, n.datacenter)...)
+		}
 	} else {
 		events = make([]event.Event, 0)
 	}
@@ -366,20 +753,38 @@ func (n *Node) Time() uint64 {
 	return n.heap[0].End()
 }
 
+/*
+Host runs task on a node of dc with enough free resources, or queues it until one has them.
+Returns false if no node of dc can ever host task. While dc is restoring, tasks that fit
+the largest node dc had wait in the queue for nodes to be added.
+*/
 func (dc *FifoDataCenter) Host(task RunningTask) (*Node, bool) {
 	logger.Debugf("%p.Host()", dc)
-	if task.Cpus() > dc.nodeMax {
+	if !dc.Accepts(task) {
 		return nil, false
 	}
-	for _, n := range dc.nodes {
-		if n.Host(task) {
-			return n, true
-		}
+	if dc.Capacity(minimum(task)) == 0 {
+		logger.Infof("%s has no nodes in service, task waits for new nodes", dc.Id())
+		stats.Count(fmt.Sprintf("%s.waiting_for_nodes", dc.Id()))
+		dc.Enqueue(task)
+		return nil, true
+	}
+	if n := dc.place(task); n != nil {
+		return n, true
 	}
 	dc.Enqueue(task)
 	return nil, true
 }
 
+/*
+Accepts returns whether Host runs or queues task instead of refusing it, which depends only on the
+nodes dc has or expects, and not on the tasks it is running.
+*/
+func (dc FifoDataCenter) Accepts(task RunningTask) bool {
+	least := minimum(task)
+	return least.Cpus <= dc.nodeMax && (dc.Capacity(least) > 0 || dc.Restoring())
+}
+
 func (topo Topology) Equal(other Topology) bool {
 	if len(topo.DataCenters) != len(other.DataCenters) {
 		return false
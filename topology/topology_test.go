@@ -6,20 +6,24 @@ import (
 
 	"container/heap"
 
+	"github.com/dsfalves/gdsim/network"
 	"github.com/dsfalves/gdsim/scheduler/event"
 	"github.com/google/go-cmp/cmp"
 )
 
 // dummy struct to be used in tests
 type sampleTask struct {
-	end  uint64
-	cpus int
+	end    uint64
+	cpus   int
+	memory int
 }
 
 func (t sampleTask) End() uint64            { return t.end }
 func (t sampleTask) Cpus() int              { return t.cpus }
+func (t sampleTask) Memory() int            { return t.memory }
 func (t sampleTask) SetStart(start uint64)  {}
 func (t sampleTask) SetWhere(where int)     {}
+func (t sampleTask) SetSpeed(speed float64) {}
 func (t sampleTask) Process() []event.Event { return nil }
 
 func checkHeap(t *testing.T, h taskHeap, length int, top uint64) {
@@ -35,10 +39,10 @@ func checkHeap(t *testing.T, h taskHeap, length int, top uint64) {
 func TestTaskHeap(t *testing.T) {
 	h := NewTaskHeap()
 	tasks := []sampleTask{
-		{2, 1},
-		{3, 1},
-		{0, 1},
-		{1, 1},
+		{end: 2, cpus: 1},
+		{end: 3, cpus: 1},
+		{end: 0, cpus: 1},
+		{end: 1, cpus: 1},
 	}
 
 	checkHeap(t, h, 0, 0)
@@ -61,6 +65,7 @@ func TestTaskHeap(t *testing.T) {
 }
 
 func TestDataCenterEqual(t *testing.T) {
+	nw := network.NewSimpleNetwork()
 	cap := [][2]int{
 		{1, 2},
 		{1, 2},
@@ -73,7 +78,7 @@ func TestDataCenterEqual(t *testing.T) {
 		{1, 1, 0, 1},
 		{1, 1, 1, 0},
 	}
-	topo, err := NewFifo(cap, speed)
+	topo, err := NewFifo(cap, speed, &nw)
 	if err != nil {
 		t.Fatalf("setup error: %v", err)
 	}
@@ -89,6 +94,7 @@ func TestDataCenterEqual(t *testing.T) {
 }
 
 func TestNewFifo(t *testing.T) {
+	nw := network.NewSimpleNetwork()
 	cap := [][2]int{
 		{1, 2},
 		{2, 1},
@@ -102,7 +108,7 @@ func TestNewFifo(t *testing.T) {
 		{1, 1, 1, 0},
 	}
 
-	topo, err := NewFifo(cap, speed)
+	topo, err := NewFifo(cap, speed, &nw)
 	if err != nil {
 		t.Errorf("expected err = nil, found %v", err)
 	}
@@ -131,7 +137,7 @@ func TestNewFifo(t *testing.T) {
 		{1, 1, 1, 0},
 		{1, 1, 1, 0},
 	}
-	_, err = NewFifo(cap, badSpeed)
+	_, err = NewFifo(cap, badSpeed, &nw)
 	if err == nil {
 		t.Errorf("expected err != nil, found nil")
 	}
@@ -141,13 +147,14 @@ func TestNewFifo(t *testing.T) {
 		{1, 1, 0, 1, 0},
 		{1, 1, 1, 0},
 	}
-	_, err = NewFifo(cap, badSpeed)
-	if err == nil {
-		t.Errorf("expected err != nil, found nil")
+	_, err = NewFifo(cap, badSpeed, &nw)
+	if err == nil || !strings.Contains(err.Error(), "len(speeds[2])=5") {
+		t.Errorf("expected error for the length of speeds[2], found %v", err)
 	}
 }
 
 func TestDCCapacity(t *testing.T) {
+	nw := network.NewSimpleNetwork()
 	cap := [][2]int{
 		{1, 2},
 		{2, 1},
@@ -161,7 +168,7 @@ func TestDCCapacity(t *testing.T) {
 		{1, 1, 1, 0},
 	}
 
-	topo, err := NewFifo(cap, speed)
+	topo, err := NewFifo(cap, speed, &nw)
 	if err != nil {
 		t.Fatalf("failed to build topology: %v", err)
 	}
@@ -211,6 +218,7 @@ func TestNodeHost(t *testing.T) {
 }
 
 func TestDCHost(t *testing.T) {
+	nw := network.NewSimpleNetwork()
 	cap := [][2]int{
 		{1, 2},
 		{2, 1},
@@ -228,7 +236,7 @@ func TestDCHost(t *testing.T) {
 		cpus: 1,
 	}
 
-	topo, err := NewFifo(cap, speed)
+	topo, err := NewFifo(cap, speed, &nw)
 	if err != nil {
 		t.Errorf("expected err = nil, found %v", err)
 	}
@@ -278,9 +286,10 @@ func testDC(t *testing.T, size, cpus int, dc DataCenter) {
 }
 
 func TestLoad(t *testing.T) {
+	nw := network.NewSimpleNetwork()
 	sample := "3\n2 1\n3 2\n4 3\n1000 99 200\n99 1000 500\n200 500 1000\n"
 	reader := strings.NewReader(sample)
-	topo, err := LoadFifo(reader)
+	topo, err := LoadFifo(reader, &nw)
 	if err != nil {
 		t.Fatalf("error '%v' while processing topology '%v', expected nil", err, sample)
 	}
@@ -304,6 +313,7 @@ func TestLoad(t *testing.T) {
 }
 
 func TestTopologyEqual(t *testing.T) {
+	nw := network.NewSimpleNetwork()
 	cap := [][2]int{
 		{1, 2},
 		{2, 1},
@@ -321,19 +331,19 @@ func TestTopologyEqual(t *testing.T) {
 		{1, 0},
 	}
 
-	topo1, err := NewFifo(cap, speed)
+	topo1, err := NewFifo(cap, speed, &nw)
 	if err != nil {
 		t.Fatalf("setup error: %v", err)
 	}
-	topo2, err := NewFifo(cap, speed)
+	topo2, err := NewFifo(cap, speed, &nw)
 	if err != nil {
 		t.Fatalf("setup error: %v", err)
 	}
-	topo3, err := NewFifo(fakeCap, speed)
+	topo3, err := NewFifo(fakeCap, speed, &nw)
 	if err != nil {
 		t.Fatalf("setup error: %v", err)
 	}
-	topo4, err := NewFifo(cap, fakeSpeed)
+	topo4, err := NewFifo(cap, fakeSpeed, &nw)
 	if err != nil {
 		t.Fatalf("setup error: %v", err)
 	}
@@ -350,6 +360,7 @@ func TestTopologyEqual(t *testing.T) {
 }
 
 func TestDCAvailability(t *testing.T) {
+	nw := network.NewSimpleNetwork()
 	cap := [][2]int{
 		{1, 2},
 		{2, 1},
@@ -367,7 +378,7 @@ func TestDCAvailability(t *testing.T) {
 		cpus: 4,
 	}
 
-	topo, err := NewFifo(cap, speed)
+	topo, err := NewFifo(cap, speed, &nw)
 	if err != nil {
 		t.Fatalf("failed to build topology: %v", err)
 	}
@@ -419,4 +430,197 @@ func TestNodeEvent(t *testing.T) {
 	}
 }
 
+func TestLoadStorage(t *testing.T) {
+	sample := "2\n2 1\n1 4\n1000 99\n99 1000\nstorage\n500 0\n"
+	nw := network.NewSimpleNetwork()
+	topo, err := LoadFifo(strings.NewReader(sample), &nw)
+	if err != nil {
+		t.Fatalf("error '%v' while processing topology '%v', expected nil", err, sample)
+	}
+	if !cmp.Equal(topo.Storage, []uint64{500, 0}) {
+		t.Errorf("expected topo.Storage = [500 0], found %v", topo.Storage)
+	}
+	for _, bad := range []string{"1\n1 1\n0\nstorage\n", "1\n1 1\n0\nsnacks 3\n"} {
+		if _, err := LoadFifo(strings.NewReader(bad), &nw); err == nil {
+			t.Errorf("expected error for topology '%v', found nil", bad)
+		}
+	}
+}
+
+func TestLoadGroups(t *testing.T) {
+	sample := "2\n2 1\n1 4 2, 2 2 0.5\n1000 99\n99 1000\n"
+	reader := strings.NewReader(sample)
+	nw := network.NewSimpleNetwork()
+	topo, err := LoadFifo(reader, &nw)
+	if err != nil {
+		t.Fatalf("error '%v' while processing topology '%v', expected nil", err, sample)
+	}
+	testDC(t, 2, 1, topo.DataCenters[0])
+
+	dc := topo.DataCenters[1]
+	if n := dc.NumNodes(); n != 3 {
+		t.Fatalf("wrong number of nodes in dc[1]: expected 3, found %d", n)
+	}
+	cpus := []int{4, 2, 2}
+	speeds := []float64{2, 0.5, 0.5}
+	for i, node := range dc.Nodes() {
+		if node.freeCpus != cpus[i] {
+			t.Errorf("wrong number of free cpus on node[%v]: expected %v, found %v", i, cpus[i], node.freeCpus)
+		}
+		if node.Speed() != speeds[i] {
+			t.Errorf("wrong speed on node[%v]: expected %v, found %v", i, speeds[i], node.Speed())
+		}
+	}
+	keys := map[int]int{
+		1: 8,
+		2: 4,
+		3: 1,
+		4: 1,
+	}
+	for k, key := range keys {
+		if cap := dc.JobCapacity(k); cap != key {
+			t.Errorf("wrong JobCapacity(%d) for dc[1]: expected %d, found %d", k, key, cap)
+		}
+	}
+	if _, success := dc.Host(sampleTask{end: 10, cpus: 4}); !success {
+		t.Errorf("expected dc.Host(4) = true, found false")
+	}
+	if free := dc.JobAvailability(2); free != 2 {
+		t.Errorf("wrong JobAvailability(2) for dc[1]: expected 2, found %d", free)
+	}
+	if _, success := dc.Host(sampleTask{end: 10, cpus: 5}); success {
+		t.Errorf("expected dc.Host(5) = false, found true")
+	}
+
+	bad := "1\n2 1 0\n1\n"
+	if _, err := LoadFifo(strings.NewReader(bad), &nw); err == nil {
+		t.Errorf("expected error for topology '%v', found nil", bad)
+	}
+}
+
+func TestNodeMemory(t *testing.T) {
+	n := NewNode(4, 0)
+	n.memory, n.freeMemory = 1000, 1000
+	t1 := sampleTask{end: 10, cpus: 1, memory: 800}
+	t2 := sampleTask{end: 20, cpus: 1, memory: 300}
+
+	if !n.Host(t1) {
+		t.Fatalf("expected n.Host(1 CPU, 800 MB) = true, found false")
+	}
+	if n.freeMemory != 200 {
+		t.Errorf("expected n.freeMemory = 200, found %d", n.freeMemory)
+	}
+	if n.Host(t2) {
+		t.Errorf("expected n.Host(1 CPU, 300 MB) = false, found true")
+	}
+	if c := n.count(Resources{Cpus: 1, Memory: 100}, n.freeCpus, n.freeMemory); c != 2 {
+		t.Errorf("expected 2 tasks of 1 CPU and 100 MB to fit, found %d", c)
+	}
+	n.Process()
+	if n.freeMemory != 1000 || n.freeCpus != 4 {
+		t.Errorf("expected node to be free after Process(), found %d CPUs and %d MB", n.freeCpus, n.freeMemory)
+	}
+}
+
+func TestDCResources(t *testing.T) {
+	groups := [][]NodeGroup{
+		{{Computers: 2, Cores: 4, Memory: 1000, Speed: 1}},
+	}
+	speed := [][]uint64{
+		{0},
+	}
+	nw := network.NewSimpleNetwork()
+	topo, err := NewFifoGroups(groups, speed, &nw)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	dc := topo.DataCenters[0]
+	if total := dc.TotalResources(); total != (Resources{Cpus: 8, Memory: 2000}) {
+		t.Errorf("wrong TotalResources(): found %v", total)
+	}
+	demand := Resources{Cpus: 1, Memory: 500}
+	if c := dc.Capacity(demand); c != 4 {
+		t.Errorf("wrong Capacity(%v): expected 4, found %d", demand, c)
+	}
+	if c := dc.JobCapacity(1); c != 8 {
+		t.Errorf("wrong JobCapacity(1): expected 8, found %d", c)
+	}
+	if _, success := dc.Host(sampleTask{end: 10, cpus: 1, memory: 2000}); success {
+		t.Errorf("expected dc.Host(1 CPU, 2000 MB) = false, found true")
+	}
+	dc.Host(sampleTask{end: 10, cpus: 1, memory: 500})
+	if c := dc.Availability(demand); c != 3 {
+		t.Errorf("wrong Availability(%v): expected 3, found %d", demand, c)
+	}
+	if free := dc.FreeResources(); free != (Resources{Cpus: 7, Memory: 1500}) {
+		t.Errorf("wrong FreeResources(): found %v", free)
+	}
+}
+
+func TestDominantShare(t *testing.T) {
+	total := Resources{Cpus: 10, Memory: 1000}
+	if s := DominantShare(Resources{Cpus: 1, Memory: 500}, total); s != 0.5 {
+		t.Errorf("expected dominant share 0.5, found %v", s)
+	}
+	if s := DominantShare(Resources{Cpus: 2, Memory: 100}, total); s != 0.2 {
+		t.Errorf("expected dominant share 0.2, found %v", s)
+	}
+	if s := DominantShare(Resources{Cpus: 2, Memory: 100}, Resources{Cpus: 4}); s != 0.5 {
+		t.Errorf("expected dominant share 0.5, found %v", s)
+	}
+}
+
+// dummy malleable task to be used in tests
+type sampleMalleable struct {
+	sampleTask
+	minCpus int
+}
+
+func (t *sampleMalleable) Cpus() int       { return t.cpus }
+func (t *sampleMalleable) MinCpus() int    { return t.minCpus }
+func (t *sampleMalleable) Resize(cpus int) { t.cpus = cpus }
+
+func TestHostReduced(t *testing.T) {
+	cap := [][2]int{
+		{2, 4},
+	}
+	speed := [][]uint64{
+		{0},
+	}
+	nw := network.NewSimpleNetwork()
+	topo, err := NewFifo(cap, speed, &nw)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	dc := topo.DataCenters[0]
+	dc.Get(0).freeCpus = 1
+	dc.Get(1).freeCpus = 3
+
+	rigid := sampleTask{end: 10, cpus: 4}
+	if n, success := dc.Host(rigid); n != nil || !success {
+		t.Errorf("expected rigid task to be queued, found %v, %v", n, success)
+	}
+
+	task := &sampleMalleable{sampleTask: sampleTask{end: 10, cpus: 4}, minCpus: 2}
+	n, success := dc.Host(task)
+	if !success || n != dc.Get(1) {
+		t.Fatalf("expected malleable task hosted in node 1, found %v, %v", n, success)
+	}
+	if task.cpus != 3 {
+		t.Errorf("expected malleable task to run with 3 CPUs, found %d", task.cpus)
+	}
+	if free := dc.Get(1).freeCpus; free != 0 {
+		t.Errorf("expected node 1 to have no free CPUs, found %d", free)
+	}
+
+	small := &sampleMalleable{sampleTask: sampleTask{end: 10, cpus: 4}, minCpus: 2}
+	if n := dc.Get(0); n.HostReduced(small) {
+		t.Errorf("expected node 0 to fail hosting task requiring at least 2 CPUs")
+	}
+	wide := &sampleMalleable{sampleTask: sampleTask{end: 10, cpus: 8}, minCpus: 5}
+	if _, success := dc.Host(wide); success {
+		t.Errorf("expected dc.Host() to fail for task requiring at least 5 CPUs")
+	}
+}
+
 // TODO: add tests for errors
@@ -5,7 +5,9 @@ import (
 	"math"
 	"math/rand"
 	"os"
+	"strings"
 
+	"github.com/dsfalves/gdsim/file"
 	"github.com/dsfalves/gdsim/job"
 	"gonum.org/v1/gonum/stat/distuv"
 )
@@ -139,10 +141,82 @@ func (jc JobCreator) createJob(files []File) Job {
 	return j
 }
 
+// Returns the ids of files as a comma separated list, or "-" if files is empty.
+func fileIds(files []file.File) string {
+	if len(files) == 0 {
+		return "-"
+	}
+	ids := make([]string, len(files))
+	for i, f := range files {
+		ids[i] = f.Id()
+	}
+	return strings.Join(ids, ",")
+}
+
 func (j Job) String() string {
-	s := fmt.Sprintf("%v %v %v %v %v", j.id, j.Cpus, j.Submission, j.File.Id(), j.File.Size())
-	for _, t := range j.Tasks {
+	inputs := j.File.Id()
+	if len(j.Inputs) > 0 {
+		inputs = fileIds(j.Inputs)
+	}
+	s := fmt.Sprintf("%v %v %v %v %v", j.id, j.Cpus, j.Submission, inputs, j.File.Size())
+	if j.Memory > 0 {
+		s = fmt.Sprintf("%v memory=%v", s, j.Memory)
+	}
+	if j.MinCpus > 0 {
+		s = fmt.Sprintf("%v mincpus=%v", s, j.MinCpus)
+	}
+	if j.Speedup != nil {
+		s = fmt.Sprintf("%v speedup=%v", s, j.Speedup)
+	}
+	if j.Origin != "" {
+		s = fmt.Sprintf("%v origin=%v", s, j.Origin)
+	}
+	if j.Output > 0 {
+		s = fmt.Sprintf("%v output=%v", s, j.Output)
+	}
+	if j.Intermediate {
+		s = fmt.Sprintf("%v intermediate=true", s)
+	}
+	if j.Tenant != "" {
+		s = fmt.Sprintf("%v tenant=%v", s, j.Tenant)
+	}
+	if len(j.Allowed) > 0 {
+		s = fmt.Sprintf("%v allowed=%v", s, strings.Join(j.Allowed, ","))
+	}
+	if len(j.Forbidden) > 0 {
+		s = fmt.Sprintf("%v forbidden=%v", s, strings.Join(j.Forbidden, ","))
+	}
+	if len(j.AntiAffinity) > 0 {
+		s = fmt.Sprintf("%v antiaffinity=%v", s, strings.Join(j.AntiAffinity, ","))
+	}
+	if j.Deadline > 0 {
+		s = fmt.Sprintf("%v deadline=%v", s, j.Deadline)
+	}
+	s = tasksString(s, j.Tasks, "")
+	for _, stage := range j.Stages {
+		s = fmt.Sprintf("%v stage=%v", s, stage.Id)
+		if len(stage.Parents) > 0 {
+			s = fmt.Sprintf("%v:%v", s, strings.Join(stage.Parents, ","))
+		}
+		if stage.Shuffle > 0 {
+			s = fmt.Sprintf("%v shuffle=%v", s, stage.Shuffle)
+		}
+		s = tasksString(s, j.Tasks, stage.Id)
+		s = tasksString(s, stage.Tasks, stage.Id)
+	}
+	return s
+}
+
+// Appends to s the durations and partitions of the tasks in tasks that belong to stage.
+func tasksString(s string, tasks []job.Task, stage string) string {
+	for _, t := range tasks {
+		if t.Stage != stage {
+			continue
+		}
 		s = fmt.Sprintf("%v %v", s, t.Duration)
+		if len(t.Partitions) > 0 {
+			s = fmt.Sprintf("%v@%v", s, fileIds(t.Partitions))
+		}
 	}
 	return s
 }
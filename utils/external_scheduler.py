@@ -0,0 +1,34 @@
+#!/usr/bin/python
+'''
+Example of an external scheduler, run with `gdsim -scheduler EXTERNAL -external "python utils/external_scheduler.py" trace.jobs`.
+It assigns each task to the data center with the most free slots for its job, or the one holding most of its inputs when all are full.
+'''
+
+import json
+from sys import stdin, stdout
+
+VERSION = 1
+
+def assign(state):
+    '''
+    Returns the assignments of tasks to data centers for a state sent by the simulator.
+    '''
+    locations = {f['id']: f['locations'] for f in state.get('files', [])}
+    assignments = []
+    for job in state.get('jobs', []):
+        free = dict(job['availability'])
+        for task in job['tasks']:
+            best = max(free, key=lambda dc: free[dc])
+            if free[best] == 0:
+                held = [dc for f in task.get('inputs', []) for dc in locations.get(f, [])]
+                best = max(free, key=held.count)
+            free[best] = max(free[best] - 1, 0)
+            assignments.append({'job': job['id'], 'task': task['index'], 'datacenter': best})
+    return assignments
+
+for line in stdin:
+    state = json.loads(line)
+    if state['type'] == 'end':
+        break
+    stdout.write(json.dumps({'version': VERSION, 'assignments': assign(state)}) + '\n')
+    stdout.flush()